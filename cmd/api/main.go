@@ -21,15 +21,28 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/config"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/receipt"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/routes"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/user"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/webhook"
 )
 
+// shutdownTimeout is how long requests in progress get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Initialize MongoDB client
 	client, err := db.NewClient(config.Env.DatabaseURI)
@@ -37,14 +50,35 @@ func main() {
 		log.Fatalf("Error initializing MongoDB client %v", err)
 	}
 
-	// Create a root context for the application
-	rootCtx, cancel := context.WithCancel(context.Background())
+	// Create a root context for the application, cancelled on shutdown
+	rootCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	// Disconnect after server shutdown
+	defer func() {
+		if err := client.Disconnect(); err != nil {
+			log.Fatalf("Error disconnecting from MongoDB: %v", err)
+		}
+	}()
+
 	// Ensure defaults to database
 	user.SeedAdminUser(client, rootCtx)
 	db.EnsureIndexes(client, rootCtx, config.Env.DatabaseName)
 
+	// Continue the event log so reconnecting clients can catch up
+	sse.Start(rootCtx, client)
+
+	// Publish the events and print jobs of committed changes
+	outbox.Start(rootCtx, client)
+
+	// Post events to the webhooks subscribed to them
+	webhook.Start(rootCtx, client)
+
+	// Send queued kitchen tickets and receipts to the network printers
+	printer.Start(rootCtx, client, map[string]printer.Renderer{
+		printer.KindReceipt: receipt.RenderESCPOS,
+	})
+
 	// Setup gin router
 	r := gin.Default()
 
@@ -52,12 +86,23 @@ func main() {
 	routes.SetupRoutes(r, client)
 
 	// Start the server
-	r.Run(":" + config.Env.ServerPort)
-
-	// Disconnect after server shutdown
-	defer func() {
-		if err := client.Disconnect(); err != nil {
-			log.Fatalf("Error disconnecting from MongoDB: %v", err)
+	server := &http.Server{Addr: ":" + config.Env.ServerPort, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error starting server: %v", err)
 		}
 	}()
+
+	<-rootCtx.Done()
+	log.Println("Shutting down server...")
+
+	// Event streams never finish on their own, end them before waiting
+	// for the other requests
+	sse.Close()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
 }
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var Env = LoadConfig()
@@ -14,6 +17,55 @@ type Config struct {
 	DefaultAdminUsername string
 	DefaultAdminPassword string
 	Secret               string
+	ClientURL            string         // base URL of the customer ordering app encoded into table QR codes
+	TableTokenTTL        time.Duration  // lifetime of a table's QR ordering token
+	AccessTokenTTL       time.Duration  // lifetime of staff access tokens, renewed with a refresh token
+	RefreshTokenTTL      time.Duration  // how long a login lasts without being used
+	Shifts               []Shift        // named parts of the day tips are reported by
+	TipPools             map[string]int // percentage of every tip shared with a pool, e.g. kitchen=20
+	// Discounts and comps worth more than this (in minor units) need a manager's approval
+	DiscountApprovalThreshold int64
+	TaxInclusive              bool // menu prices include tax, otherwise tax is added on top
+	// Service charge added to bills in basis points, 0 disables it
+	ServiceChargeRate      int64
+	ServiceChargeMinCovers int64    // only parties of at least this many guests are charged
+	ServiceChargeZones     []string // only tables in these zones are charged, all when empty
+	ServiceChargeTaxable   bool
+	// Printed at the top and bottom of receipts
+	CafeName      string
+	CafeAddress   string // lines separated by "|"
+	CafeTaxID     string
+	ReceiptFooter string
+	// Network printers by station, e.g. kitchen=10.0.0.50:9100
+	Printers      map[string]string
+	PrinterRoutes map[string]string // menu category to station, other items go to the kitchen
+	PrintRetries  int64             // attempts before a print job is given up
+	// How long responses are kept to be replayed for retries with the same Idempotency-Key
+	IdempotencyTTL time.Duration
+	// Events kept for clients reconnecting with Last-Event-ID, and how often idle streams get a heartbeat
+	EventLogSize   int64
+	EventHeartbeat time.Duration
+	// Events queued per stream, and whether streams that fall behind get "disconnect"ed or events "drop"ped
+	EventQueueSize  int64
+	EventSlowPolicy string
+	InstanceID      string // names this instance among the API replicas, the host name when empty
+	// Attempts per webhook delivery, failed deliveries before a webhook is disabled, and the time a receiver gets to answer
+	WebhookRetries     int64
+	WebhookMaxFailures int64
+	WebhookTimeout     time.Duration
+	// Other sites allowed to open WebSocket connections authenticated by the access_token cookie
+	WebSocketOrigins []string
+	// Custom service requests a table can send within the window
+	CustomRequestLimit  int64
+	CustomRequestWindow time.Duration
+}
+
+// Shift is a named part of the day given as offsets from midnight. A shift
+// ending before it starts runs past midnight.
+type Shift struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
 }
 
 func LoadConfig() *Config {
@@ -24,6 +76,38 @@ func LoadConfig() *Config {
 		DefaultAdminUsername: getEnv("DEFAULT_ADMIN_USERNAME", "admin"),
 		DefaultAdminPassword: getEnv("DEFAULT_ADMIN_PASSWORD", "password"),
 		Secret:               getEnv("SECRET", "reallysecuresecret"),
+		ClientURL:            getEnv("CLIENT_URL", "http://localhost:3000"),
+		TableTokenTTL:        getEnvDuration("TABLE_TOKEN_TTL", 30*24*time.Hour),
+		AccessTokenTTL:       getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:      getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		Shifts:               getEnvShifts("SHIFTS", "morning=06:00-16:00,evening=16:00-06:00"),
+		TipPools:             getEnvPercentages("TIP_POOLS", ""),
+
+		DiscountApprovalThreshold: getEnvInt("DISCOUNT_APPROVAL_THRESHOLD", 1000),
+		TaxInclusive:              getEnvBool("TAX_INCLUSIVE", true),
+		ServiceChargeRate:         getEnvInt("SERVICE_CHARGE_RATE", 0),
+		ServiceChargeMinCovers:    getEnvInt("SERVICE_CHARGE_MIN_COVERS", 0),
+		ServiceChargeZones:        splitList(getEnv("SERVICE_CHARGE_ZONES", "")),
+		ServiceChargeTaxable:      getEnvBool("SERVICE_CHARGE_TAXABLE", false),
+		CafeName:                  getEnv("CAFE_NAME", "Cafe"),
+		CafeAddress:               getEnv("CAFE_ADDRESS", ""),
+		CafeTaxID:                 getEnv("CAFE_TAX_ID", ""),
+		ReceiptFooter:             getEnv("RECEIPT_FOOTER", "Thank you for your visit!"),
+		Printers:                  getEnvMap("PRINTERS", ""),
+		PrinterRoutes:             getEnvMap("PRINTER_ROUTES", ""),
+		PrintRetries:              getEnvInt("PRINT_RETRIES", 5),
+		IdempotencyTTL:            getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		EventLogSize:              getEnvInt("EVENT_LOG_SIZE", 10000),
+		EventHeartbeat:            getEnvDuration("EVENT_HEARTBEAT", 15*time.Second),
+		EventQueueSize:            getEnvInt("EVENT_QUEUE_SIZE", 64),
+		EventSlowPolicy:           getEnv("EVENT_SLOW_POLICY", "disconnect"),
+		InstanceID:                getEnv("INSTANCE_ID", ""),
+		WebhookRetries:            getEnvInt("WEBHOOK_RETRIES", 8),
+		WebhookMaxFailures:        getEnvInt("WEBHOOK_MAX_FAILURES", 5),
+		WebhookTimeout:            getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebSocketOrigins:          splitList(getEnv("WEBSOCKET_ORIGINS", "")),
+		CustomRequestLimit:        getEnvInt("CUSTOM_REQUEST_LIMIT", 3),
+		CustomRequestWindow:       getEnvDuration("CUSTOM_REQUEST_WINDOW", 10*time.Minute),
 	}
 
 	// Log loaded configuration (remove in production)
@@ -38,3 +122,134 @@ func getEnv(key string, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvDuration parses values like "720h" or "15m", falling back to the
+// default when the variable is unset or malformed.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvInt parses an integer, falling back to the default when the variable
+// is unset or malformed.
+func getEnvInt(key string, defaultValue int64) int64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// getEnvBool parses values like "true" or "0", falling back to the default
+// when the variable is unset or malformed.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s, using default %t", key, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvShifts parses shifts like "morning=06:00-16:00,evening=16:00-06:00".
+// Malformed entries are skipped.
+func getEnvShifts(key string, defaultValue string) []Shift {
+	var shifts []Shift
+	for _, entry := range splitList(getEnv(key, defaultValue)) {
+		name, hours, found := strings.Cut(entry, "=")
+		from, to, ok := strings.Cut(hours, "-")
+		if !found || !ok {
+			log.Printf("Invalid shift %q in %s, skipping", entry, key)
+			continue
+		}
+
+		start, err := parseTimeOfDay(from)
+		if err != nil {
+			log.Printf("Invalid shift %q in %s, skipping", entry, key)
+			continue
+		}
+		end, err := parseTimeOfDay(to)
+		if err != nil {
+			log.Printf("Invalid shift %q in %s, skipping", entry, key)
+			continue
+		}
+
+		shifts = append(shifts, Shift{Name: strings.TrimSpace(name), Start: start, End: end})
+	}
+	return shifts
+}
+
+// getEnvPercentages parses values like "kitchen=20,bar=5". Malformed
+// entries are skipped.
+func getEnvPercentages(key string, defaultValue string) map[string]int {
+	percentages := make(map[string]int)
+	for _, entry := range splitList(getEnv(key, defaultValue)) {
+		name, value, found := strings.Cut(entry, "=")
+		percent, err := strconv.Atoi(strings.TrimSpace(value))
+		if !found || err != nil || percent < 0 || percent > 100 {
+			log.Printf("Invalid percentage %q in %s, skipping", entry, key)
+			continue
+		}
+		percentages[strings.TrimSpace(name)] = percent
+	}
+	return percentages
+}
+
+// getEnvMap parses comma separated name=value pairs.
+func getEnvMap(key string, defaultValue string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range splitList(getEnv(key, defaultValue)) {
+		name, value, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			log.Printf("Invalid entry %q in %s, skipping", entry, key)
+			continue
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseTimeOfDay converts "HH:MM" into an offset from midnight. "24:00" is
+// accepted as the end of the day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// Approval holds the credentials of a manager approving an action taken by
+// another member of staff, such as a refund.
+type Approval struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ApproveAction returns the ID of the manager approving an action. Admins
+// approve their own actions, other roles need the credentials of an admin in
+// the request. It writes the error response itself and returns false when the
+// action is not approved. It lives here rather than in user, which imports
+// payment and so order, so that orders, refunds and sessions can all use it.
+func ApproveAction(
+	c *gin.Context,
+	client db.IMongoClient,
+	approval *Approval,
+) (primitive.ObjectID, bool) {
+	role, ok := GetRole(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+
+	if role == "admin" {
+		return GetUserID(c)
+	}
+
+	if approval == nil || approval.Username == "" || approval.Password == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Manager approval is required"})
+		return primitive.NilObjectID, false
+	}
+
+	var manager struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Password string             `bson:"password"`
+	}
+	err := client.GetCollection(config.Env.DatabaseName, "users").FindOne(
+		c.Request.Context(),
+		bson.D{
+			{Key: "username", Value: approval.Username},
+			{Key: "role", Value: "admin"},
+		},
+	).Decode(&manager)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Manager approval denied"})
+			return primitive.NilObjectID, false
+		}
+		utils.HandleMongoError(c, err)
+		return primitive.NilObjectID, false
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(manager.Password), []byte(approval.Password))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Manager approval denied"})
+		return primitive.NilObjectID, false
+	}
+
+	return manager.ID, true
+}
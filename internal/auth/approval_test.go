@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func TestApproveAction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	managerID := primitive.NewObjectID()
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	request := func(role string) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		c.Set("claims", jwt.MapClaims{"UserID": userID.Hex(), "Role": role})
+		return c, w
+	}
+	manager := mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: managerID},
+		{Key: "password", Value: string(password)},
+	})
+
+	mt.Run("admins approve their own actions", func(mt *mtest.T) {
+		c, _ := request("admin")
+
+		approverID, ok := ApproveAction(c, db.NewMockMongoClient(mt.Coll), nil)
+
+		assert.True(t, ok)
+		assert.Equal(t, userID, approverID)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("approval is required", func(mt *mtest.T) {
+		c, w := request("waiter")
+
+		_, ok := ApproveAction(c, db.NewMockMongoClient(mt.Coll), &Approval{Username: "manager"})
+
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Manager approval is required")
+	})
+
+	mt.Run("approved by a manager", func(mt *mtest.T) {
+		c, _ := request("waiter")
+		mt.AddMockResponses(manager)
+
+		approverID, ok := ApproveAction(c, db.NewMockMongoClient(mt.Coll), &Approval{Username: "manager", Password: "secret"})
+
+		assert.True(t, ok)
+		assert.Equal(t, managerID, approverID)
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		assert.Equal(t, "admin", filter.Document().Lookup("role").StringValue())
+	})
+
+	mt.Run("wrong password", func(mt *mtest.T) {
+		c, w := request("cashier")
+		mt.AddMockResponses(manager)
+
+		_, ok := ApproveAction(c, db.NewMockMongoClient(mt.Coll), &Approval{Username: "manager", Password: "wrong"})
+
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Manager approval denied")
+	})
+
+	mt.Run("not a manager", func(mt *mtest.T) {
+		c, w := request("cashier")
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch))
+
+		_, ok := ApproveAction(c, db.NewMockMongoClient(mt.Coll), &Approval{Username: "waiter", Password: "secret"})
+
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetUserID extracts the ID of the authenticated user from the claims set by
+// Authenticate. It writes the error response itself and returns false when
+// the claims are missing or malformed.
+func GetUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	jwtClaims, ok := getClaims(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+
+	// Extract UserID
+	userIDHex, ok := jwtClaims["UserID"].(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, false
+	}
+
+	// Convert the string back to primitive.ObjectID
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid ObjectID"})
+		return primitive.NilObjectID, false
+	}
+
+	return userID, true
+}
+
+// GetRole extracts the role of the authenticated user from the claims set by
+// Authenticate, writing the error response itself on failure.
+func GetRole(c *gin.Context) (string, bool) {
+	jwtClaims, ok := getClaims(c)
+	if !ok {
+		return "", false
+	}
+
+	role, ok := jwtClaims["Role"].(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid Role"})
+		return "", false
+	}
+
+	return role, true
+}
+
+// GetLoginID extracts the login the access token of the request belongs to,
+// writing the error response itself on failure.
+func GetLoginID(c *gin.Context) (primitive.ObjectID, bool) {
+	jwtClaims, ok := getClaims(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+
+	loginIDHex, _ := jwtClaims["sid"].(string)
+	loginID, err := primitive.ObjectIDFromHex(loginIDHex)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid login ID"})
+		return primitive.NilObjectID, false
+	}
+
+	return loginID, true
+}
+
+func getClaims(c *gin.Context) (jwt.MapClaims, bool) {
+	// Get claims from Gin context
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	// Type assert to jwt.MapClaims
+	jwtClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token data"})
+		return nil, false
+	}
+
+	return jwtClaims, true
+}
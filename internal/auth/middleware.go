@@ -1,15 +1,16 @@
 package auth
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"slices"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
-	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
 // Authenticate is a middleware function that validates
@@ -32,57 +33,98 @@ func Authenticate(allowedRoles []string) gin.HandlerFunc {
 		}
 
 		// Remove 'Bearer ' prefix from the token string
-		tokenString = tokenString[7:]
-
-		// Parse the token
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(
-			tokenString,
-			claims,
-			func(token *jwt.Token) (interface{}, error) {
-				return []byte(config.Env.Secret), nil
-			},
-		)
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+		authorize(c, tokenString[7:], allowedRoles)
+	}
+}
 
-		
-		// **Manually check expiration (exp)**
-		exp, ok := claims["ExpiresAt"].(float64)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expiration missing"})
-			c.Abort()
-			return
+// AuthenticateStream works like Authenticate for event streams. Browsers'
+// EventSource cannot set headers, so the token may also be sent as the
+// access_token query parameter or cookie.
+func AuthenticateStream(allowedRoles []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("access_token")
 		}
-
-		// Convert to Unix timestamp and check if expired
-		if int64(exp) < time.Now().Unix() {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
-			c.Abort()
-			return
+		if tokenString == "" {
+			tokenString, _ = c.Cookie("access_token")
 		}
-
-		// Get the role from the token
-		role, ok := claims["Role"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Role not found in token"})
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is required"})
 			c.Abort()
 			return
 		}
 
+		authorize(c, tokenString, allowedRoles)
+	}
+}
 
-		// Check if the user's role is in the allowed roles
-		if !slices.Contains(allowedRoles, role) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-			c.Abort()
-			return
+// Revoked reports whether the staff token a long-lived request, such as an
+// event stream, was authenticated with has been revoked since. Requests
+// without a staff token, such as customers', are never revoked. Database
+// errors are logged and not taken for a revocation, so streams outlive a
+// short outage.
+func Revoked(ctx context.Context, c *gin.Context) bool {
+	claims, _ := c.Get("claims")
+	jwtClaims, _ := claims.(jwt.MapClaims)
+	return ClaimsRevoked(ctx, jwtClaims)
+}
+
+// ClaimsRevoked works like Revoked with the claims of a request, for
+// goroutines that outlive the request's gin.Context, which gin reuses.
+func ClaimsRevoked(ctx context.Context, claims jwt.MapClaims) bool {
+	if claims == nil || store == nil {
+		return false
+	}
+
+	err := checkRevoked(ctx, store, claims)
+	if err == ErrTokenRevoked || err == ErrInvalidToken {
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to check whether a token was revoked: %v", err)
+	}
+	return false
+}
+
+// authorize checks the token and the user's role and continues with the
+// request, or aborts it.
+func authorize(c *gin.Context, tokenString string, allowedRoles []string) {
+	// Parse the token
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": tokenMessage(err)})
+		c.Abort()
+		return
+	}
+
+	// Logging out, deleting or demoting the user revokes the token at once
+	if store == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication is not set up"})
+		c.Abort()
+		return
+	}
+	if err := checkRevoked(c.Request.Context(), store, claims); err != nil {
+		if err == ErrTokenRevoked || err == ErrInvalidToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": tokenMessage(err)})
+		} else {
+			utils.HandleMongoError(c, err)
 		}
+		c.Abort()
+		return
+	}
 
-		// Continue to the next middleware/handler if role matches
-		c.Set("claims", claims)
-		c.Next()
+	// Get the role from the token
+	role := claims["Role"].(string)
+
+	// Check if the user's role is in the allowed roles
+	if !slices.Contains(allowedRoles, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+		return
 	}
+
+	// Continue to the next middleware/handler if role matches
+	c.Set("claims", claims)
+	c.Next()
 }
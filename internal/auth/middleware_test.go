@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func TestRevoked(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	t.Cleanup(func() { store = nil })
+
+	request := func(claims jwt.MapClaims) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if claims != nil {
+			c.Set("claims", claims)
+		}
+		return c
+	}
+	claims := jwt.MapClaims{
+		"UserID": primitive.NewObjectID().Hex(),
+		"Role":   "waiter",
+		"sid":    primitive.NewObjectID().Hex(),
+	}
+	count := func(n int32) bson.D {
+		return mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+	}
+
+	mt.Run("without a staff token", func(mt *mtest.T) {
+		Init(db.NewMockMongoClient(mt.Coll))
+
+		assert.False(t, Revoked(context.Background(), request(nil)))
+	})
+
+	mt.Run("login still active", func(mt *mtest.T) {
+		Init(db.NewMockMongoClient(mt.Coll))
+		mt.AddMockResponses(count(1), count(1))
+
+		assert.False(t, Revoked(context.Background(), request(claims)))
+	})
+
+	mt.Run("login revoked", func(mt *mtest.T) {
+		Init(db.NewMockMongoClient(mt.Coll))
+		mt.AddMockResponses(count(0))
+
+		assert.True(t, Revoked(context.Background(), request(claims)))
+	})
+
+	mt.Run("database error", func(mt *mtest.T) {
+		Init(db.NewMockMongoClient(mt.Coll))
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "down"}))
+
+		assert.False(t, Revoked(context.Background(), request(claims)))
+	})
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// RefreshToken is a login on one device. Only a hash of the current token is
+// stored, and it is replaced every time the token is used, so a token can be
+// used once. Access tokens name their login and stop working once it is
+// revoked.
+type RefreshToken struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `bson:"user_id"`
+	TokenHash    string             `bson:"token_hash"`
+	PreviousHash string             `bson:"previous_hash,omitempty"` // of the token the current one replaced
+	RotatedAt    time.Time          `bson:"rotated_at,omitempty"`
+	IP           string             `bson:"ip,omitempty"`
+	UserAgent    string             `bson:"user_agent,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at"`
+	LastUsedAt   time.Time          `bson:"last_used_at"`
+	ExpiresAt    time.Time          `bson:"expires_at"`
+	RevokedAt    *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// refreshGrace is how long the refresh token a refresh replaced still
+// returns the same new tokens.
+const refreshGrace = 30 * time.Second
+
+// Tokens are returned at login and on every refresh.
+type Tokens struct {
+	AccessToken      string `json:"token"`
+	ExpiresIn        int64  `json:"expiresIn"` // seconds
+	RefreshToken     string `json:"refreshToken"`
+	RefreshExpiresIn int64  `json:"refreshExpiresIn"` // seconds, extended on every refresh
+}
+
+// store is where Authenticate checks that tokens were not revoked.
+var store db.IMongoClient
+
+// Init gives Authenticate the database it checks tokens against.
+func Init(client db.IMongoClient) {
+	store = client
+}
+
+// IssueTokens starts a new login for a user and returns its tokens.
+func IssueTokens(
+	ctx context.Context,
+	client db.IMongoClient,
+	userID primitive.ObjectID,
+	role, ip, userAgent string,
+) (Tokens, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now()
+	login := RefreshToken{
+		UserID:     userID,
+		TokenHash:  hashToken(secret),
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(config.Env.RefreshTokenTTL),
+	}
+
+	result, err := client.GetCollection(config.Env.DatabaseName, "refresh_tokens").InsertOne(ctx, login)
+	if err != nil {
+		return Tokens{}, err
+	}
+	login.ID = result.InsertedID.(primitive.ObjectID)
+
+	return tokensFor(login, role, secret, now)
+}
+
+// Refresh exchanges a refresh token for new tokens, with the user's current
+// role. A refresh token can be used once: using the one it replaced again
+// ends the login, since either it was stolen or the client lost the new one,
+// and the user has to log in again. Clients refreshing twice at once, such
+// as two browser tabs, both get the same new refresh token as long as they
+// do so within half a minute.
+func Refresh(ctx context.Context, client db.IMongoClient, refreshToken string) (Tokens, error) {
+	loginID, secret, ok := splitRefreshToken(refreshToken)
+	if !ok {
+		return Tokens{}, ErrInvalidToken
+	}
+
+	collection := client.GetCollection(config.Env.DatabaseName, "refresh_tokens")
+
+	now := time.Now()
+	tokenHash := hashToken(secret)
+	newSecret := nextSecret(loginID, secret)
+
+	var login RefreshToken
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: loginID},
+			{Key: "token_hash", Value: tokenHash},
+			{Key: "revoked_at", Value: bson.M{"$exists": false}},
+			{Key: "expires_at", Value: bson.M{"$gt": now}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "token_hash", Value: hashToken(newSecret)},
+			{Key: "previous_hash", Value: tokenHash},
+			{Key: "rotated_at", Value: now},
+			{Key: "last_used_at", Value: now},
+			{Key: "expires_at", Value: now.Add(config.Env.RefreshTokenTTL)},
+		}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		login, err = refreshAgain(ctx, client, loginID, tokenHash, newSecret, now)
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	var user struct {
+		Role string `bson:"role"`
+	}
+	err = client.GetCollection(config.Env.DatabaseName, "users").
+		FindOne(ctx, bson.D{{Key: "_id", Value: login.UserID}}).
+		Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// The user was deleted
+			if err := Revoke(ctx, client, loginID); err != nil {
+				return Tokens{}, err
+			}
+			return Tokens{}, ErrTokenRevoked
+		}
+		return Tokens{}, err
+	}
+
+	return tokensFor(login, user.Role, newSecret, now)
+}
+
+// refreshAgain handles a refresh token that is not the current one of its
+// login. The token the current one replaced is accepted for half a minute,
+// for clients refreshing twice at once, and ends the login after that.
+// Other tokens are rejected, but can't end a login the caller never held.
+func refreshAgain(
+	ctx context.Context,
+	client db.IMongoClient,
+	loginID primitive.ObjectID,
+	tokenHash, newSecret string,
+	now time.Time,
+) (RefreshToken, error) {
+	var login RefreshToken
+	err := client.GetCollection(config.Env.DatabaseName, "refresh_tokens").
+		FindOne(ctx, bson.D{{Key: "_id", Value: loginID}}).
+		Decode(&login)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return RefreshToken{}, ErrInvalidToken
+		}
+		return RefreshToken{}, err
+	}
+
+	if login.PreviousHash != tokenHash {
+		return RefreshToken{}, ErrInvalidToken
+	}
+	if login.RevokedAt != nil || !login.ExpiresAt.After(now) {
+		return RefreshToken{}, ErrTokenRevoked
+	}
+
+	// Within the grace period the login still holds the token the first
+	// refresh returned, which is the one this refresh returns too
+	if now.Sub(login.RotatedAt) <= refreshGrace && login.TokenHash == hashToken(newSecret) {
+		return login, nil
+	}
+
+	if err := Revoke(ctx, client, loginID); err != nil {
+		return RefreshToken{}, err
+	}
+	return RefreshToken{}, ErrTokenRevoked
+}
+
+// Revoke ends a login, so its refresh token and access tokens stop working.
+func Revoke(ctx context.Context, client db.IMongoClient, loginID primitive.ObjectID) error {
+	_, err := client.GetCollection(config.Env.DatabaseName, "refresh_tokens").UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: loginID}, {Key: "revoked_at", Value: bson.M{"$exists": false}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}},
+	)
+	return err
+}
+
+// RevokeAll ends every login of a user and returns how many were ended.
+func RevokeAll(ctx context.Context, client db.IMongoClient, userID primitive.ObjectID) (int64, error) {
+	result, err := client.GetCollection(config.Env.DatabaseName, "refresh_tokens").UpdateMany(
+		ctx,
+		bson.D{{Key: "user_id", Value: userID}, {Key: "revoked_at", Value: bson.M{"$exists": false}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// checkRevoked makes sure the login of an access token was not revoked and
+// its user still exists with the role the token was issued for, so logging
+// out, deleting or demoting a user takes effect before the token expires.
+func checkRevoked(ctx context.Context, client db.IMongoClient, claims jwt.MapClaims) error {
+	userIDHex, _ := claims["UserID"].(string)
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	loginIDHex, _ := claims["sid"].(string)
+	loginID, err := primitive.ObjectIDFromHex(loginIDHex)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	count, err := client.GetCollection(config.Env.DatabaseName, "refresh_tokens").
+		CountDocuments(ctx, bson.D{
+			{Key: "_id", Value: loginID},
+			{Key: "user_id", Value: userID},
+			{Key: "revoked_at", Value: bson.M{"$exists": false}},
+		})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTokenRevoked
+	}
+
+	count, err = client.GetCollection(config.Env.DatabaseName, "users").
+		CountDocuments(ctx, bson.D{{Key: "_id", Value: userID}, {Key: "role", Value: claims["Role"]}})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// tokensFor signs an access token for a login and pairs it with the login's
+// refresh token.
+func tokensFor(login RefreshToken, role, secret string, now time.Time) (Tokens, error) {
+	accessToken, err := signAccessToken(login.UserID, role, login.ID, now)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:      accessToken,
+		ExpiresIn:        int64(config.Env.AccessTokenTTL.Seconds()),
+		RefreshToken:     login.ID.Hex() + "." + secret,
+		RefreshExpiresIn: int64(login.ExpiresAt.Sub(now).Seconds()),
+	}, nil
+}
+
+// splitRefreshToken splits a refresh token into the ID of its login and the
+// secret whose hash is stored.
+func splitRefreshToken(token string) (primitive.ObjectID, string, bool) {
+	idHex, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return primitive.NilObjectID, "", false
+	}
+
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return primitive.NilObjectID, "", false
+	}
+	return id, secret, true
+}
+
+// nextSecret derives the secret replacing a refresh token's, so refreshing
+// the same token twice returns the same new token without it being stored.
+func nextSecret(loginID primitive.ObjectID, secret string) string {
+	mac := hmac.New(sha256.New, []byte(config.Env.Secret))
+	mac.Write([]byte("refresh:" + loginID.Hex() + "." + secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashToken hashes a refresh token's secret for storage. The secret is
+// random, so a fast hash is enough.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// loginDocument is a stored login whose current token has the secret and
+// which replaced the previous one at rotatedAt.
+func loginDocument(id primitive.ObjectID, secret, previous string, rotatedAt time.Time) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "user_id", Value: primitive.NewObjectID()},
+		{Key: "token_hash", Value: hashToken(secret)},
+		{Key: "previous_hash", Value: hashToken(previous)},
+		{Key: "rotated_at", Value: rotatedAt},
+		{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+	}
+}
+
+func userDocument(role string) bson.D {
+	return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "role", Value: role}}
+}
+
+// commandNames returns the names of the commands sent to the database.
+func commandNames(mt *mtest.T) []string {
+	var names []string
+	for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+		names = append(names, event.CommandName)
+	}
+	return names
+}
+
+func TestRefresh(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	loginID := primitive.NewObjectID()
+	token := loginID.Hex() + ".secret"
+	next := nextSecret(loginID, "secret")
+
+	mt.Run("rotates the token", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: loginDocument(loginID, next, "secret", time.Now())}),
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, userDocument("waiter")),
+		)
+
+		tokens, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, loginID.Hex()+"."+next, tokens.RefreshToken)
+		claims, err := ParseToken(tokens.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "waiter", claims["Role"])
+	})
+
+	mt.Run("refreshing twice at once", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch,
+				loginDocument(loginID, next, "secret", time.Now().Add(-5*time.Second))),
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, userDocument("waiter")),
+		)
+
+		tokens, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, loginID.Hex()+"."+next, tokens.RefreshToken)
+	})
+
+	mt.Run("reusing a replaced token revokes the login", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch,
+				loginDocument(loginID, next, "secret", time.Now().Add(-time.Hour))),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		_, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.Equal(t, ErrTokenRevoked, err)
+		assert.Equal(t, []string{"findAndModify", "find", "update"}, commandNames(mt))
+	})
+
+	mt.Run("reusing a token replaced twice since revokes the login", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch,
+				loginDocument(loginID, "newer", "secret", time.Now())),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		_, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.Equal(t, ErrTokenRevoked, err)
+	})
+
+	mt.Run("unknown token leaves the login alone", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch,
+				loginDocument(loginID, next, "other", time.Now().Add(-time.Hour))),
+		)
+
+		_, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Equal(t, []string{"findAndModify", "find"}, commandNames(mt))
+	})
+
+	mt.Run("unknown login", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.refresh_tokens", mtest.FirstBatch),
+		)
+
+		_, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	mt.Run("malformed token", func(mt *mtest.T) {
+		_, err := Refresh(context.Background(), db.NewMockMongoClient(mt.Coll), "secret")
+
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Empty(t, commandNames(mt))
+	})
+}
+
+func TestNextSecret(t *testing.T) {
+	loginID := primitive.NewObjectID()
+
+	assert.Equal(t, nextSecret(loginID, "secret"), nextSecret(loginID, "secret"))
+	assert.NotEqual(t, nextSecret(loginID, "secret"), nextSecret(loginID, "other"))
+	assert.NotEqual(t, nextSecret(loginID, "secret"), nextSecret(primitive.NewObjectID(), "secret"))
+}
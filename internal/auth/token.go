@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrExpirationMissing = errors.New("token expiration missing")
+	ErrTokenExpired      = errors.New("token has expired")
+	ErrRoleMissing       = errors.New("role not found in token")
+	ErrTokenRevoked      = errors.New("token has been revoked")
+)
+
+// ParseToken validates a staff access token and returns its claims. The
+// token must be signed with the secret, not expired and carry a role.
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(config.Env.Secret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+			return nil, ErrExpirationMissing
+		default:
+			return nil, ErrInvalidToken
+		}
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if _, ok := claims["Role"].(string); !ok {
+		return nil, ErrRoleMissing
+	}
+
+	return claims, nil
+}
+
+// signAccessToken issues a short-lived access token for a user's login.
+func signAccessToken(
+	userID primitive.ObjectID,
+	role string,
+	loginID primitive.ObjectID,
+	now time.Time,
+) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"UserID": userID.Hex(),
+		"Role":   role,
+		"sid":    loginID.Hex(), // the login the token belongs to, checked on every request
+		"jti":    jti,
+		"iat":    now.Unix(),
+		"exp":    now.Add(config.Env.AccessTokenTTL).Unix(),
+	})
+
+	return token.SignedString([]byte(config.Env.Secret))
+}
+
+// tokenMessage returns the error shown to clients for a rejected token.
+func tokenMessage(err error) string {
+	switch err {
+	case ErrExpirationMissing:
+		return "Token expiration missing"
+	case ErrTokenExpired:
+		return "Token has expired"
+	case ErrRoleMissing:
+		return "Role not found in token"
+	case ErrTokenRevoked:
+		return "Token has been revoked, please log in again"
+	default:
+		return "Invalid token"
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+func sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Env.Secret))
+	assert.NoError(t, err)
+	return token
+}
+
+func TestParseToken(t *testing.T) {
+	userID := primitive.NewObjectID()
+	loginID := primitive.NewObjectID()
+
+	t.Run("valid", func(t *testing.T) {
+		token, err := signAccessToken(userID, "waiter", loginID, time.Now())
+		assert.NoError(t, err)
+
+		claims, err := ParseToken(token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, userID.Hex(), claims["UserID"])
+		assert.Equal(t, "waiter", claims["Role"])
+		assert.Equal(t, loginID.Hex(), claims["sid"])
+		assert.NotEmpty(t, claims["jti"])
+		exp, err := claims.GetExpirationTime()
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(config.Env.AccessTokenTTL), exp.Time, 5*time.Second)
+	})
+
+	t.Run("every token is unique", func(t *testing.T) {
+		now := time.Now()
+		first, _ := signAccessToken(userID, "waiter", loginID, now)
+		second, _ := signAccessToken(userID, "waiter", loginID, now)
+
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, _ := signAccessToken(userID, "waiter", loginID, time.Now().Add(-config.Env.AccessTokenTTL-time.Minute))
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrTokenExpired, err)
+	})
+
+	t.Run("issued in the future", func(t *testing.T) {
+		token := sign(t, jwt.MapClaims{
+			"Role": "admin",
+			"iat":  time.Now().Add(time.Hour).Unix(),
+			"exp":  time.Now().Add(2 * time.Hour).Unix(),
+		})
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	t.Run("old login token without exp", func(t *testing.T) {
+		token := sign(t, jwt.MapClaims{
+			"UserID":    userID.Hex(),
+			"Role":      "admin",
+			"ExpiresAt": time.Now().Add(time.Hour).Unix(),
+		})
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrExpirationMissing, err)
+	})
+
+	t.Run("missing role", func(t *testing.T) {
+		token := sign(t, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrRoleMissing, err)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"Role": "admin",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("not the secret"))
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+			"Role": "admin",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+		_, err := ParseToken(token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+}
+
+func TestSplitRefreshToken(t *testing.T) {
+	loginID := primitive.NewObjectID()
+
+	id, secret, ok := splitRefreshToken(loginID.Hex() + ".abc123")
+	assert.True(t, ok)
+	assert.Equal(t, loginID, id)
+	assert.Equal(t, "abc123", secret)
+
+	for _, token := range []string{"", "abc123", loginID.Hex(), loginID.Hex() + ".", "nothex.abc123"} {
+		_, _, ok := splitRefreshToken(token)
+		assert.False(t, ok, token)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	assert.Equal(t, hashToken("secret"), hashToken("secret"))
+	assert.NotEqual(t, hashToken("secret"), hashToken("other"))
+	assert.Len(t, hashToken("secret"), 64)
+	assert.NotContains(t, hashToken("secret"), "secret")
+}
@@ -0,0 +1,502 @@
+package bill
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// GetBillPreview builds a bill preview for a table
+//
+// @Summary Preview a table's bill
+// @Description Combines the active orders of a table into a bill. With the guests parameter the bill is also split evenly.
+// @Tags bill
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param guests query int false "Number of guests to split the bill evenly between"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Bill preview"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Internal Server Error"
+// @Router /bill/preview/{tableID} [get]
+func GetBillPreview(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tableID, err := primitive.ObjectIDFromHex(c.Param("tableID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		total, err := order.GetActiveTotal(c.Request.Context(), client, tableID)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		preview := gin.H{
+			"tableId":       total.TableID,
+			"sessionId":     total.SessionID,
+			"items":         total.Items,
+			"gross":         total.GrossPrice,
+			"discounts":     total.DiscountTotal,
+			"tax":           total.TaxTotal,
+			"total":         total.TotalPrice,
+			"serviceCharge": total.ServiceCharge,
+			"allServed":     total.AllServed,
+		}
+
+		if guestsStr := c.Query("guests"); guestsStr != "" {
+			guests, err := strconv.Atoi(guestsStr)
+			if err != nil || guests < 2 || guests > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guests. Use a number between 2 and 50."})
+				return
+			}
+			preview["splits"] = splitEvenly(total.TotalPrice, guests)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": preview,
+		})
+	}
+}
+
+// SplitBill splits the bill of a table
+//
+// @Summary Split a table's bill
+// @Description Splits the active orders of a table evenly across guests, by seat, or by selected item quantities.
+// @Description Splitting again replaces the table's open bill as long as none of its splits have been paid.
+// @Tags bill
+// @Accept json
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param split body splitRequest true "Split method and details"
+// @Security bearerToken
+// @Success 200 {object} Bill "Split bill"
+// @Failure 400 "Invalid request"
+// @Failure 404 "No active orders"
+// @Failure 409 "Orders not served or bill already partially paid"
+// @Failure 500 "Internal Server Error"
+// @Router /bill/{tableID} [post]
+func SplitBill(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tableID, err := primitive.ObjectIDFromHex(c.Param("tableID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request splitRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateBill(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		total, err := order.GetActiveTotal(ctx, client, tableID)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		if len(total.OrderIDs) == 0 || total.SessionID.IsZero() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table has no active orders"})
+			return
+		}
+
+		if !total.AllServed {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "All orders must be served before splitting the bill",
+			})
+			return
+		}
+
+		var splits []Split
+		switch request.Method {
+		case MethodEven:
+			if request.Guests == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Guests is required when splitting evenly"})
+				return
+			}
+			splits = splitEvenly(total.TotalPrice, request.Guests)
+		case MethodSeat:
+			splits, err = splitBySeat(total.Items)
+		case MethodItems:
+			splits, err = splitByItems(total.Items, request.Splits)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.Method != MethodEven {
+			shareDiscount(splits, total.OrderDiscount)
+			shareTax(splits, total.TaxAdded)
+			shareServiceCharge(splits, total.ServiceCharge)
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "bills")
+
+		bill := Bill{
+			TableID:   tableID,
+			SessionID: total.SessionID,
+			OrderIDs:  total.OrderIDs,
+			Method:    request.Method,
+			Items:     total.Items,
+			Total:     total.TotalPrice,
+			Splits:    splits,
+			Status:    StatusOpen,
+			CreatedAt: time.Now(),
+			CreatedBy: userID,
+		}
+		if len(total.Items) > 0 {
+			bill.Currency = total.Items[0].MenuItem.Currency
+		}
+
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			// Replace the previous split unless someone already paid their part
+			existing, err := FindOpen(sc, client, total.SessionID)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+			if err == nil {
+				paid, err := hasPayments(sc, client, existing)
+				if err != nil {
+					return err
+				}
+				if paid {
+					return errPartiallyPaid
+				}
+
+				_, err = collection.UpdateByID(sc, existing.ID, bson.D{{Key: "$set", Value: bson.D{
+					{Key: "status", Value: StatusCancelled},
+				}}})
+				if err != nil {
+					return err
+				}
+			}
+
+			result, err := collection.InsertOne(sc, bill)
+			if err != nil {
+				return err
+			}
+			bill.ID = result.InsertedID.(primitive.ObjectID)
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.BillCreated, TableID: tableID.Hex(), Data: bill})
+		})
+		if err != nil {
+			if err == errPartiallyPaid {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": bill,
+		})
+	}
+}
+
+// GetBillById retrieves a bill
+//
+// @Summary Get a bill
+// @Description Retrieves a bill and the payment status of its splits
+// @Tags bill
+// @Produce json
+// @Param id path string true "Bill ID"
+// @Security bearerToken
+// @Success 200 {object} Bill "Bill data"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Bill not found"
+// @Failure 500 "Internal Server Error"
+// @Router /bill/{id} [get]
+func GetBillById(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "bills")
+
+		var bill Bill
+		err = collection.FindOne(c.Request.Context(), bson.D{{Key: "_id", Value: docID}}).Decode(&bill)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Bill not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": bill,
+		})
+	}
+}
+
+// CancelBill cancels an open bill
+//
+// @Summary Cancel a split bill
+// @Description Cancels an open bill that no payment was taken against so the table can be closed as a whole again
+// @Tags bill
+// @Param id path string true "Bill ID"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Bill cancelled successfully"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Bill not found, not open or partially paid"
+// @Failure 500 "Internal Server Error"
+// @Router /bill/{id} [delete]
+func CancelBill(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "bills")
+
+		err = db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			var bill Bill
+			err := collection.FindOne(sc, bson.D{
+				{Key: "_id", Value: docID},
+				{Key: "status", Value: StatusOpen},
+			}).Decode(&bill)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return errNotCancelable
+				}
+				return err
+			}
+
+			paid, err := hasPayments(sc, client, bill)
+			if err != nil {
+				return err
+			}
+			if paid {
+				return errNotCancelable
+			}
+
+			_, err = collection.UpdateByID(sc, bill.ID, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: StatusCancelled},
+			}}})
+			if err != nil {
+				return err
+			}
+			bill.Status = StatusCancelled
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.BillUpdated, TableID: bill.TableID.Hex(), Data: bill})
+		})
+		if err != nil {
+			if err == errNotCancelable {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{"message": "Bill cancelled successfully"})
+	}
+}
+
+// CloseSplit marks a split of a bill as paid
+//
+// @Summary Close a bill split
+// @Description Allows admin and cashier roles to close a split once payments cover its amount.
+// @Description When the last split is paid the bill is settled and the table's orders are closed.
+// @Tags bill
+// @Produce json
+// @Param id path string true "Bill ID"
+// @Param splitID path string true "Split ID"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Split closed successfully"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Bill or split not found"
+// @Failure 409 "Orders changed since the bill was split or split not paid"
+// @Failure 500 "Internal Server Error"
+// @Router /bill/{id}/split/{splitID}/close [patch]
+func CloseSplit(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		billID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID!"})
+			return
+		}
+
+		splitID, err := primitive.ObjectIDFromHex(c.Param("splitID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Split ID!"})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "bills")
+
+		var bill Bill
+		var sessionClosed bool
+		err = db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			err := collection.FindOne(sc, bson.D{
+				{Key: "_id", Value: billID},
+				{Key: "status", Value: StatusOpen},
+			}).Decode(&bill)
+			if err != nil {
+				return err
+			}
+
+			total, err := order.GetActiveTotal(sc, client, bill.TableID)
+			if err != nil {
+				return err
+			}
+			if isStale(bill, total) {
+				return errStaleBill
+			}
+
+			var split *Split
+			for i := range bill.Splits {
+				if bill.Splits[i].ID == splitID {
+					split = &bill.Splits[i]
+				}
+			}
+			if split == nil {
+				return mongo.ErrNoDocuments
+			}
+
+			paid, err := utils.SumField(
+				sc,
+				client.GetCollection(config.Env.DatabaseName, "payments"),
+				bson.D{{Key: "split_id", Value: splitID}},
+				"amount",
+			)
+			if err != nil {
+				return err
+			}
+			if paid < split.Amount {
+				return errSplitUnpaid
+			}
+
+			now := time.Now()
+			result, err := collection.UpdateOne(
+				sc,
+				bson.D{
+					{Key: "_id", Value: billID},
+					{Key: "splits", Value: bson.M{"$elemMatch": bson.M{
+						"_id":     splitID,
+						"paid_at": bson.M{"$exists": false},
+					}}},
+				},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "splits.$.paid_at", Value: now},
+					{Key: "splits.$.paid_by", Value: userID},
+				}}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return mongo.ErrNoDocuments
+			}
+
+			for i := range bill.Splits {
+				if bill.Splits[i].ID == splitID {
+					bill.Splits[i].PaidAt = &now
+					bill.Splits[i].PaidBy = userID
+				}
+			}
+
+			if !bill.IsPaid() {
+				return publishBill(sc, client, bill, false)
+			}
+
+			// Every split is paid, settle the bill and close the table
+			bill.Status = StatusSettled
+			bill.SettledAt = &now
+			_, err = collection.UpdateByID(sc, billID, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: StatusSettled},
+				{Key: "settled_at", Value: now},
+			}}})
+			if err != nil {
+				return err
+			}
+
+			actor := order.Actor{UserID: userID, IP: c.ClientIP()}
+			sessionClosed, err = order.CloseSessionOrders(sc, client, bill.SessionID, actor)
+			if err != nil {
+				return err
+			}
+			return publishBill(sc, client, bill, sessionClosed)
+		})
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Bill or split not found, or already paid"})
+			case errStaleBill:
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "Orders changed since the bill was split, split it again",
+				})
+			case errSplitUnpaid:
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "Payments do not cover the split",
+				})
+			default:
+				utils.HandleMongoError(c, err)
+			}
+			return
+		}
+
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Split closed successfully",
+			"settled": bill.Status == StatusSettled,
+			"data":    bill,
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package bill
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+)
+
+const (
+	MethodEven  = "even"
+	MethodSeat  = "seat"
+	MethodItems = "items"
+
+	StatusOpen      = "open"
+	StatusSettled   = "settled"
+	StatusCancelled = "cancelled"
+)
+
+// Bill splits the active orders of a table session into parts that are paid
+// and closed independently. The session is settled once every split is paid.
+type Bill struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty"        json:"id"`
+	TableID   primitive.ObjectID   `bson:"table_id"             json:"tableId"`
+	SessionID primitive.ObjectID   `bson:"session_id"           json:"sessionId"`
+	OrderIDs  []primitive.ObjectID `bson:"order_ids"            json:"orderIds"`
+	Method    string               `bson:"method"               json:"method"`
+	Items     []order.OrderItem    `bson:"items"                json:"items"`
+	Total     int64                `bson:"total"                json:"total"`
+	Currency  string               `bson:"currency"             json:"currency"`
+	Splits    []Split              `bson:"splits"               json:"splits"`
+	Status    string               `bson:"status"               json:"status"`
+	CreatedAt time.Time            `bson:"created_at"           json:"createdAt"`
+	CreatedBy primitive.ObjectID   `bson:"created_by"           json:"createdBy"`
+	SettledAt *time.Time           `bson:"settled_at,omitempty" json:"settledAt"`
+	// Payments taken against splits, counted so they conflict with the bill
+	// being cancelled or split again
+	PaymentCount int `bson:"payment_count,omitempty" json:"paymentCount"`
+}
+
+type Split struct {
+	ID            primitive.ObjectID `bson:"_id"                     json:"id"`
+	Label         string             `bson:"label"                   json:"label"`
+	Seat          uint8              `bson:"seat,omitempty"          json:"seat,omitempty"`
+	Items         []order.OrderItem  `bson:"items,omitempty"         json:"items,omitempty"`
+	SharedAmount  int64              `bson:"shared_amount,omitempty" json:"sharedAmount,omitempty"`   // share of lines not assigned to a seat
+	Discount      int64              `bson:"discount,omitempty"      json:"discount,omitempty"`       // share of order-level discounts
+	Tax           int64              `bson:"tax,omitempty"           json:"tax,omitempty"`            // share of tax added to tax-exclusive prices
+	ServiceCharge int64              `bson:"service_charge,omitempty" json:"serviceCharge,omitempty"` // share of the service charge
+	Amount        int64              `bson:"amount"                  json:"amount"`
+	PaidAt        *time.Time         `bson:"paid_at,omitempty"       json:"paidAt"`
+	PaidBy        primitive.ObjectID `bson:"paid_by,omitempty"       json:"paidBy,omitempty"`
+}
+
+// IsPaid reports whether every split of the bill has been paid.
+func (b Bill) IsPaid() bool {
+	for _, split := range b.Splits {
+		if split.PaidAt == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPayments reports whether any split of the bill has been paid in full.
+// hasPayments also finds splits paid in part.
+func (b Bill) HasPayments() bool {
+	for _, split := range b.Splits {
+		if split.PaidAt != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type splitRequest struct {
+	Method string             `json:"method" validate:"required,oneof=even seat items"`
+	Guests int                `json:"guests" validate:"omitempty,gte=2,lte=50"`
+	Splits []itemSplitRequest `json:"splits" validate:"omitempty,dive"`
+}
+
+type itemSplitRequest struct {
+	Label string             `json:"label"`
+	Items []splitItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+type splitItemRequest struct {
+	MenuItemID string `json:"menuItemId" validate:"required"`
+	Quantity   uint8  `json:"quantity"   validate:"required,gt=0"`
+}
@@ -0,0 +1,381 @@
+package bill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+func validateBill(v *validator.Validate, request interface{}) error {
+	// Perform validation
+	if err := v.Struct(request); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			fmt.Println(err)
+			return nil
+		}
+
+		validationErrors := err.(validator.ValidationErrors)
+		for _, fieldErr := range validationErrors {
+			switch fieldErr.Tag() {
+			case "required":
+				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "oneof":
+				return fmt.Errorf("%s must be one of [%s]", fieldErr.Field(), fieldErr.Param())
+			case "gte", "min":
+				return fmt.Errorf("%s must be at least %s", fieldErr.Field(), fieldErr.Param())
+			case "lte":
+				return fmt.Errorf("%s must be at most %s", fieldErr.Field(), fieldErr.Param())
+			case "gt":
+				return fmt.Errorf("%s must be greater than %s", fieldErr.Field(), fieldErr.Param())
+			default:
+				return fmt.Errorf("%s is invalid", fieldErr.Field())
+			}
+		}
+	}
+	return nil
+}
+
+// shareEvenly divides an amount into n parts in minor units. The remainder is
+// spread one unit at a time over the first parts so the parts add up exactly.
+func shareEvenly(amount int64, n int) []int64 {
+	shares := make([]int64, n)
+	base := amount / int64(n)
+	remainder := amount % int64(n)
+
+	for i := range shares {
+		shares[i] = base
+		if int64(i) < remainder {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// splitEvenly splits the total into equal parts, one per guest.
+func splitEvenly(total int64, guests int) []Split {
+	splits := make([]Split, guests)
+	for i, amount := range shareEvenly(total, guests) {
+		splits[i] = Split{
+			ID:     primitive.NewObjectID(),
+			Label:  fmt.Sprintf("Guest %d", i+1),
+			Amount: amount,
+		}
+	}
+	return splits
+}
+
+// splitBySeat creates one split per seat with the lines assigned to it. Lines
+// without a seat are shared evenly between all seats.
+func splitBySeat(items []order.OrderItem) ([]Split, error) {
+	bySeat := make(map[uint8][]order.OrderItem)
+	var shared []order.OrderItem
+
+	for _, item := range items {
+		if item.Seat == 0 {
+			shared = append(shared, item)
+			continue
+		}
+		bySeat[item.Seat] = append(bySeat[item.Seat], item)
+	}
+
+	if len(bySeat) == 0 {
+		return nil, errors.New("No items are assigned to seats")
+	}
+
+	seats := make([]uint8, 0, len(bySeat))
+	for seat := range bySeat {
+		seats = append(seats, seat)
+	}
+	sort.Slice(seats, func(i, j int) bool { return seats[i] < seats[j] })
+
+	sharedShares := shareEvenly(lineTotal(shared), len(seats))
+
+	splits := make([]Split, len(seats))
+	for i, seat := range seats {
+		splits[i] = Split{
+			ID:           primitive.NewObjectID(),
+			Label:        fmt.Sprintf("Seat %d", seat),
+			Seat:         seat,
+			Items:        bySeat[seat],
+			SharedAmount: sharedShares[i],
+			Amount:       lineTotal(bySeat[seat]) + sharedShares[i],
+		}
+	}
+	return splits, nil
+}
+
+// splitByItems creates one split per requested selection of item quantities.
+// Lines left over after all selections go into a final "Remaining" split.
+func splitByItems(items []order.OrderItem, requests []itemSplitRequest) ([]Split, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("Splits are required when splitting by items")
+	}
+
+	pool := make([]order.OrderItem, len(items))
+	copy(pool, items)
+
+	splits := make([]Split, 0, len(requests)+1)
+
+	for i, request := range requests {
+		var taken []order.OrderItem
+
+		for _, selection := range request.Items {
+			menuItemID, err := primitive.ObjectIDFromHex(selection.MenuItemID)
+			if err != nil {
+				return nil, errors.New("Invalid Menu Item ID")
+			}
+
+			wanted := selection.Quantity
+			for j := range pool {
+				if wanted == 0 {
+					break
+				}
+				if pool[j].MenuItem.ID != menuItemID || pool[j].Quantity == 0 {
+					continue
+				}
+
+				take := min(wanted, pool[j].Quantity)
+				taken = append(taken, pool[j].Take(take))
+
+				pool[j] = pool[j].Take(pool[j].Quantity - take)
+				wanted -= take
+			}
+
+			if wanted > 0 {
+				return nil, fmt.Errorf("Not enough of item %s left to split", selection.MenuItemID)
+			}
+		}
+
+		label := request.Label
+		if label == "" {
+			label = fmt.Sprintf("Split %d", i+1)
+		}
+
+		splits = append(splits, Split{
+			ID:     primitive.NewObjectID(),
+			Label:  label,
+			Items:  taken,
+			Amount: lineTotal(taken),
+		})
+	}
+
+	var remaining []order.OrderItem
+	for _, line := range pool {
+		if line.Quantity > 0 {
+			remaining = append(remaining, line)
+		}
+	}
+
+	if len(remaining) > 0 {
+		splits = append(splits, Split{
+			ID:     primitive.NewObjectID(),
+			Label:  "Remaining",
+			Items:  remaining,
+			Amount: lineTotal(remaining),
+		})
+	}
+
+	return splits, nil
+}
+
+// lineTotal sums the lines after their discounts.
+func lineTotal(items []order.OrderItem) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.Net()
+	}
+	return total
+}
+
+// shareDiscount spreads order-level discounts over the splits in proportion
+// to their amounts, so the splits still add up to the bill's total.
+func shareDiscount(splits []Split, discount int64) {
+	for i, share := range apportion(splits, discount) {
+		splits[i].Discount = share
+		splits[i].Amount -= share
+	}
+}
+
+// shareTax spreads tax added on top of tax-exclusive prices over the splits
+// in proportion to their amounts.
+func shareTax(splits []Split, tax int64) {
+	for i, share := range apportion(splits, tax) {
+		splits[i].Tax = share
+		splits[i].Amount += share
+	}
+}
+
+// shareServiceCharge spreads the service charge over the splits in proportion
+// to their amounts.
+func shareServiceCharge(splits []Split, charge *session.ServiceCharge) {
+	if charge == nil {
+		return
+	}
+	for i, share := range apportion(splits, charge.Total) {
+		splits[i].ServiceCharge = share
+		splits[i].Amount += share
+	}
+}
+
+// apportion divides an amount between the splits in proportion to their
+// amounts. The last split takes the rounding remainder.
+func apportion(splits []Split, amount int64) []int64 {
+	if amount == 0 || len(splits) == 0 {
+		return nil
+	}
+
+	var total int64
+	for _, split := range splits {
+		total += split.Amount
+	}
+	if total == 0 {
+		return nil
+	}
+
+	shares := make([]int64, len(splits))
+	left := amount
+	for i := range splits {
+		share := amount * splits[i].Amount / total
+		if i == len(splits)-1 {
+			share = left
+		}
+		left -= share
+		shares[i] = share
+	}
+	return shares
+}
+
+// FindOpen returns the open bill of a session or mongo.ErrNoDocuments.
+func FindOpen(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+) (Bill, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "bills")
+
+	var bill Bill
+	err := collection.FindOne(ctx, bson.D{
+		{Key: "session_id", Value: sessionID},
+		{Key: "status", Value: StatusOpen},
+	}).Decode(&bill)
+
+	return bill, err
+}
+
+// hasPayments reports whether any split of the bill has been paid, in full or
+// in part.
+func hasPayments(ctx context.Context, client db.IMongoClient, bill Bill) (bool, error) {
+	if bill.HasPayments() {
+		return true, nil
+	}
+
+	splitIDs := make([]primitive.ObjectID, len(bill.Splits))
+	for i, split := range bill.Splits {
+		splitIDs[i] = split.ID
+	}
+
+	count, err := client.GetCollection(config.Env.DatabaseName, "payments").CountDocuments(
+		ctx,
+		bson.D{{Key: "split_id", Value: bson.M{"$in": splitIDs}}},
+		options.Count().SetLimit(1),
+	)
+	return count > 0, err
+}
+
+// CountPayment counts a payment taken against a split of an open bill.
+// Payments count themselves inside their transaction, so a payment and the
+// bill being cancelled or split again write the same document and one of
+// them is retried with the other's change. It returns mongo.ErrNoDocuments
+// when the bill is no longer open.
+func CountPayment(ctx context.Context, client db.IMongoClient, billID primitive.ObjectID) error {
+	result, err := client.GetCollection(config.Env.DatabaseName, "bills").UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: billID},
+			{Key: "status", Value: StatusOpen},
+		},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "payment_count", Value: 1}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+var (
+	errStaleBill   = errors.New("orders changed since the bill was split")
+	errSplitUnpaid = errors.New("payments do not cover the split")
+
+	errPartiallyPaid = errors.New("Table's bill is already partially paid")
+	errNotCancelable = errors.New("Bill not found, not open or already partially paid")
+)
+
+// isStale reports whether the active orders of the table changed since the
+// bill was split.
+func isStale(bill Bill, total order.OrderTotal) bool {
+	if total.TotalPrice != bill.Total || len(total.OrderIDs) != len(bill.OrderIDs) {
+		return true
+	}
+
+	billed := make(map[primitive.ObjectID]bool, len(bill.OrderIDs))
+	for _, id := range bill.OrderIDs {
+		billed[id] = true
+	}
+	for _, id := range total.OrderIDs {
+		if !billed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// publishBill adds the events of a paid split to the outbox of the
+// transaction closing it, including the closed orders and freed table once
+// the bill is settled.
+func publishBill(
+	ctx context.Context,
+	client db.IMongoClient,
+	bill Bill,
+	sessionClosed bool,
+) error {
+	tableID := bill.TableID.Hex()
+	events := []sse.Event{{Type: sse.BillUpdated, TableID: tableID, Data: bill}}
+
+	if bill.Status == StatusSettled {
+		events = append(events, sse.Event{
+			Type:    sse.OrderClosed,
+			TableID: tableID,
+			Data: map[string]any{
+				"sessionId":     bill.SessionID,
+				"sessionClosed": sessionClosed,
+			},
+		})
+		if sessionClosed {
+			events = append(events, sse.TableStatusEvent(tableID, bill.SessionID.Hex(), sse.StatusFree))
+		}
+	}
+
+	for _, event := range events {
+		if err := outbox.Publish(ctx, client, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package bill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+)
+
+var (
+	coffee = menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee", Price: 400}
+	cake   = menu.MenuItem{ID: primitive.NewObjectID(), Name: "Cake", Price: 650}
+)
+
+func amounts(splits []Split) []int64 {
+	result := make([]int64, len(splits))
+	for i, split := range splits {
+		result[i] = split.Amount
+	}
+	return result
+}
+
+func TestSplitEvenly(t *testing.T) {
+	splits := splitEvenly(1000, 3)
+
+	assert.Equal(t, []int64{334, 333, 333}, amounts(splits))
+	assert.Equal(t, "Guest 1", splits[0].Label)
+	assert.Equal(t, "Guest 3", splits[2].Label)
+}
+
+func TestSplitBySeat(t *testing.T) {
+	t.Run("shared lines are divided between seats", func(t *testing.T) {
+		splits, err := splitBySeat([]order.OrderItem{
+			{MenuItem: coffee, Quantity: 1, Seat: 2},
+			{MenuItem: cake, Quantity: 1},
+			{MenuItem: coffee, Quantity: 2, Seat: 1},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, splits, 2)
+		assert.Equal(t, "Seat 1", splits[0].Label)
+		assert.Equal(t, int64(325), splits[0].SharedAmount)
+		assert.Equal(t, []int64{1125, 725}, amounts(splits))
+	})
+
+	t.Run("no seats", func(t *testing.T) {
+		_, err := splitBySeat([]order.OrderItem{{MenuItem: cake, Quantity: 1}})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitByItems(t *testing.T) {
+	items := []order.OrderItem{
+		{MenuItem: coffee, Quantity: 1},
+		{MenuItem: coffee, Quantity: 2, Discount: &order.Discount{Type: order.DiscountPercent, Value: 50, Amount: 400}},
+		{MenuItem: cake, Quantity: 1},
+	}
+
+	t.Run("selections across lines with the rest remaining", func(t *testing.T) {
+		splits, err := splitByItems(items, []itemSplitRequest{
+			{Label: "Ana", Items: []splitItemRequest{{MenuItemID: coffee.ID.Hex(), Quantity: 2}}},
+			{Items: []splitItemRequest{{MenuItemID: cake.ID.Hex(), Quantity: 1}}},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, splits, 3)
+		assert.Equal(t, "Ana", splits[0].Label)
+		assert.Equal(t, "Split 2", splits[1].Label)
+		assert.Equal(t, "Remaining", splits[2].Label)
+		assert.Equal(t, []int64{600, 650, 200}, amounts(splits))
+		// The order lines themselves are not consumed
+		assert.Equal(t, uint8(2), items[1].Quantity)
+	})
+
+	t.Run("more than ordered", func(t *testing.T) {
+		_, err := splitByItems(items, []itemSplitRequest{
+			{Items: []splitItemRequest{{MenuItemID: cake.ID.Hex(), Quantity: 1}}},
+			{Items: []splitItemRequest{{MenuItemID: cake.ID.Hex(), Quantity: 1}}},
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid menu item", func(t *testing.T) {
+		_, err := splitByItems(items, []itemSplitRequest{
+			{Items: []splitItemRequest{{MenuItemID: "cake", Quantity: 1}}},
+		})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestIsStale(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	bill := Bill{Total: 1000, OrderIDs: []primitive.ObjectID{first, second}}
+
+	tests := []struct {
+		name  string
+		total order.OrderTotal
+		stale bool
+	}{
+		{"unchanged", order.OrderTotal{TotalPrice: 1000, OrderIDs: []primitive.ObjectID{second, first}}, false},
+		{"total changed", order.OrderTotal{TotalPrice: 1200, OrderIDs: []primitive.ObjectID{first, second}}, true},
+		{"order added", order.OrderTotal{TotalPrice: 1000, OrderIDs: []primitive.ObjectID{first, second, primitive.NewObjectID()}}, true},
+		{"order replaced", order.OrderTotal{TotalPrice: 1000, OrderIDs: []primitive.ObjectID{first, primitive.NewObjectID()}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.stale, isStale(bill, tt.total))
+		})
+	}
+}
+
+func TestShareDiscount(t *testing.T) {
+	splits := []Split{{Amount: 1000}, {Amount: 500}, {Amount: 500}}
+
+	shareDiscount(splits, 301)
+
+	assert.Equal(t, int64(150), splits[0].Discount)
+	assert.Equal(t, int64(75), splits[1].Discount)
+	// The last split takes the rounding remainder
+	assert.Equal(t, int64(76), splits[2].Discount)
+	assert.Equal(t, []int64{850, 425, 424}, amounts(splits))
+}
+
+func TestShareTax(t *testing.T) {
+	splits := []Split{{Amount: 1000}, {Amount: 0}, {Amount: 500}}
+
+	shareTax(splits, 151)
+
+	assert.Equal(t, []int64{100, 0, 51}, []int64{splits[0].Tax, splits[1].Tax, splits[2].Tax})
+	assert.Equal(t, []int64{1100, 0, 551}, amounts(splits))
+}
+
+func TestShareServiceCharge(t *testing.T) {
+	t.Run("shared by amount", func(t *testing.T) {
+		splits := []Split{{Amount: 300}, {Amount: 700}}
+
+		shareServiceCharge(splits, &session.ServiceCharge{Amount: 125, Total: 125})
+
+		assert.Equal(t, int64(37), splits[0].ServiceCharge)
+		assert.Equal(t, int64(88), splits[1].ServiceCharge)
+		assert.Equal(t, []int64{337, 788}, amounts(splits))
+	})
+
+	t.Run("no service charge", func(t *testing.T) {
+		splits := []Split{{Amount: 300}}
+
+		shareServiceCharge(splits, nil)
+
+		assert.Equal(t, []int64{300}, amounts(splits))
+	})
+}
+
+func TestHasPayments(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	bill := Bill{Splits: []Split{{ID: primitive.NewObjectID()}, {ID: primitive.NewObjectID()}}}
+
+	mt.Run("split paid in part", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.payments", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}))
+
+		paid, err := hasPayments(context.Background(), db.NewMockMongoClient(mt.Coll), bill)
+
+		assert.NoError(t, err)
+		assert.True(t, paid)
+		match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		splitIDs := match.Lookup("$match", "split_id", "$in").Array()
+		assert.Equal(t, bill.Splits[1].ID, splitIDs.Index(1).Value().ObjectID())
+	})
+
+	mt.Run("no payments", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.payments", mtest.FirstBatch))
+
+		paid, err := hasPayments(context.Background(), db.NewMockMongoClient(mt.Coll), bill)
+
+		assert.NoError(t, err)
+		assert.False(t, paid)
+	})
+
+	mt.Run("split paid in full", func(mt *mtest.T) {
+		paidAt := time.Now()
+		settled := Bill{Splits: []Split{{ID: primitive.NewObjectID(), PaidAt: &paidAt}}}
+
+		paid, err := hasPayments(context.Background(), db.NewMockMongoClient(mt.Coll), settled)
+
+		assert.NoError(t, err)
+		assert.True(t, paid)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestCountPayment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	billID := primitive.NewObjectID()
+
+	mt.Run("open bill", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		err := CountPayment(context.Background(), db.NewMockMongoClient(mt.Coll), billID)
+
+		assert.NoError(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, StatusOpen, update.Lookup("q", "status").StringValue())
+		assert.Equal(t, int32(1), update.Lookup("u", "$inc", "payment_count").Int32())
+	})
+
+	mt.Run("cancelled bill", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+
+		err := CountPayment(context.Background(), db.NewMockMongoClient(mt.Coll), billID)
+
+		assert.Equal(t, mongo.ErrNoDocuments, err)
+	})
+}
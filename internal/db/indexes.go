@@ -56,5 +56,227 @@ func EnsureIndexes(client IMongoClient, ctx context.Context, dbName string) {
 		log.Fatalf("Failed to create indexes for tables: %v", err)
 	}
 
+	sessionCollection := client.GetCollection(dbName, "sessions")
+
+	sessionIndexModels := []mongo.IndexModel{
+		{
+			// A table can only have one open session at a time
+			Keys: bson.D{{Key: "table_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "status", Value: "open"}}),
+		},
+		{
+			Keys: bson.D{{Key: "closed_at", Value: 1}},
+		},
+	}
+
+	_, err = sessionCollection.Indexes().CreateMany(ctx, sessionIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for sessions: %v", err)
+	}
+
+	orderCollection := client.GetCollection(dbName, "orders")
+
+	orderIndexModels := mongo.IndexModel{
+		Keys: bson.D{{Key: "session_id", Value: 1}},
+	}
+
+	_, err = orderCollection.Indexes().CreateOne(ctx, orderIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for orders: %v", err)
+	}
+
+	paymentCollection := client.GetCollection(dbName, "payments")
+
+	paymentIndexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "session_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "split_id", Value: 1}},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.D{{Key: "split_id", Value: bson.M{"$exists": true}}}),
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "tip_to", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.D{{Key: "tip", Value: bson.M{"$gt": 0}}}),
+		},
+	}
+
+	_, err = paymentCollection.Indexes().CreateMany(ctx, paymentIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for payments: %v", err)
+	}
+
+	refundCollection := client.GetCollection(dbName, "refunds")
+
+	refundIndexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "payment_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+		},
+	}
+
+	_, err = refundCollection.Indexes().CreateMany(ctx, refundIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for refunds: %v", err)
+	}
+
+	taxRateCollection := client.GetCollection(dbName, "tax_rates")
+
+	taxRateIndexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+
+	_, err = taxRateCollection.Indexes().CreateMany(ctx, taxRateIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for tax rates: %v", err)
+	}
+
+	printJobCollection := client.GetCollection(dbName, "print_jobs")
+
+	printJobIndexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			// Jobs left printing are claimed again once their claim runs out
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "claimed_until", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "station", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			// Jobs queued more than once by the outbox are printed once
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+	}
+
+	_, err = printJobCollection.Indexes().CreateMany(ctx, printJobIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for print jobs: %v", err)
+	}
+
+	orderHistoryCollection := client.GetCollection(dbName, "order_history")
+
+	_, err = orderHistoryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create indexes for order history: %v", err)
+	}
+
+	idempotencyCollection := client.GetCollection(dbName, "idempotency_keys")
+
+	// Stored responses are removed by MongoDB once they expire
+	_, err = idempotencyCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create indexes for idempotency keys: %v", err)
+	}
+
+	webhookDeliveryCollection := client.GetCollection(dbName, "webhook_deliveries")
+
+	webhookDeliveryIndexModels := []mongo.IndexModel{
+		{
+			// Each event is delivered once per webhook
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			// Deliveries left sending are claimed again once their claim runs out
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "claimed_until", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+
+	_, err = webhookDeliveryCollection.Indexes().CreateMany(ctx, webhookDeliveryIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for webhook deliveries: %v", err)
+	}
+
+	serviceRequestCollection := client.GetCollection(dbName, "service_requests")
+
+	serviceRequestIndexModels := []mongo.IndexModel{
+		{
+			// A table waits on one call-waiter and one request-bill request at a time
+			Keys: bson.D{{Key: "table_id", Value: 1}, {Key: "kind", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "pending", Value: true}}),
+		},
+		{
+			Keys: bson.D{{Key: "table_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "acknowledged_by", Value: 1}, {Key: "acknowledged_at", Value: 1}},
+		},
+	}
+
+	_, err = serviceRequestCollection.Indexes().CreateMany(ctx, serviceRequestIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for service requests: %v", err)
+	}
+
+	refreshTokenCollection := client.GetCollection(dbName, "refresh_tokens")
+
+	refreshTokenIndexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			// Logins are removed once they expire
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err = refreshTokenCollection.Indexes().CreateMany(ctx, refreshTokenIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for refresh tokens: %v", err)
+	}
+
+	outboxCollection := client.GetCollection(dbName, "outbox")
+
+	outboxIndexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			// Dispatched messages are kept a day for troubleshooting
+			Keys:    bson.D{{Key: "dispatched_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60),
+		},
+	}
+
+	_, err = outboxCollection.Indexes().CreateMany(ctx, outboxIndexModels)
+	if err != nil {
+		log.Fatalf("Failed to create indexes for outbox: %v", err)
+	}
+
 	log.Println("Indexes ensured successfully!")
 }
@@ -21,6 +21,12 @@ func (m *MockMongoClient) GetCollection(dbName, collectionName string) *mongo.Co
 	return m.collection
 }
 
+// StartSession mocks the StartSession method of IMongoClient using the client
+// the mocked collection belongs to.
+func (m *MockMongoClient) StartSession() (mongo.Session, error) {
+	return m.collection.Database().Client().StartSession()
+}
+
 // Disconnect mocks the Disconnect method of IMongoClient.
 func (m *MockMongoClient) Disconnect() error {
 	// No-op for mock
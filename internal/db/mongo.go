@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 
 type IMongoClient interface {
 	GetCollection(dbName, collectionName string) *mongo.Collection
+	StartSession() (mongo.Session, error)
 	Disconnect() error
 }
 
@@ -49,6 +51,62 @@ func (mc *MongoClient) GetCollection(dbName, collectionName string) *mongo.Colle
 	return mc.client.Database(dbName).Collection(collectionName)
 }
 
+// StartSession starts a client session for running multi-document transactions.
+func (mc *MongoClient) StartSession() (mongo.Session, error) {
+	if mc.client == nil {
+		log.Fatal("MongoClient is not initialized.")
+	}
+	return mc.client.StartSession()
+}
+
+// WithTransaction runs fn inside a MongoDB transaction. The transaction is
+// committed when fn returns nil and aborted otherwise; fn may be retried on
+// transient errors, or errors wrapped with Retry, so it must not have side
+// effects outside the database. Transactions require MongoDB to run as a
+// replica set.
+func WithTransaction(
+	ctx context.Context,
+	client IMongoClient,
+	fn func(ctx mongo.SessionContext) error,
+) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	for attempt := 1; ; attempt++ {
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+
+		var retry retryError
+		if errors.As(err, &retry) && attempt < maxRetries {
+			continue
+		}
+		return err
+	}
+}
+
+// maxRetries is how often a transaction is run for errors wrapped with
+// Retry before giving up.
+const maxRetries = 3
+
+// retryError is an error after which the transaction is run again.
+type retryError struct {
+	err error
+}
+
+func (e retryError) Error() string { return e.err.Error() }
+func (e retryError) Unwrap() error { return e.err }
+
+// Retry makes WithTransaction run the transaction again after fn failed with
+// err, for conflicts the server does not retry on its own, such as a unique
+// index violated by a transaction that committed in the meantime.
+func Retry(err error) error {
+	return retryError{err}
+}
+
 // Disconnect gracefully closes the MongoDB client connection.
 func (mc *MongoClient) Disconnect() error {
 	if mc.client == nil {
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWithTransaction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	conflict := errors.New("conflict")
+
+	mt.Run("retried errors", func(mt *mtest.T) {
+		runs := 0
+
+		err := WithTransaction(context.Background(), NewMockMongoClient(mt.Coll), func(sc mongo.SessionContext) error {
+			runs++
+			return Retry(conflict)
+		})
+
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, maxRetries, runs)
+	})
+
+	mt.Run("retried until it succeeds", func(mt *mtest.T) {
+		runs := 0
+
+		err := WithTransaction(context.Background(), NewMockMongoClient(mt.Coll), func(sc mongo.SessionContext) error {
+			runs++
+			if runs == 1 {
+				return Retry(conflict)
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+	})
+
+	mt.Run("other errors", func(mt *mtest.T) {
+		runs := 0
+
+		err := WithTransaction(context.Background(), NewMockMongoClient(mt.Coll), func(sc mongo.SessionContext) error {
+			runs++
+			return conflict
+		})
+
+		assert.Equal(t, conflict, err)
+		assert.Equal(t, 1, runs)
+	})
+}
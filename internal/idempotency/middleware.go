@@ -0,0 +1,229 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// Middleware makes requests carrying an Idempotency-Key header safe to retry.
+// Keys belong to the caller, the staff user or the table token, and to the
+// method and path. The first request with a key is handled and its response
+// stored; retries with the same key and body get the stored response back
+// instead of being handled again. Reusing a key with a different body is
+// rejected. Responses that may change on a retry, such as server errors,
+// authorization failures and conflicts, are not stored so the request can be
+// retried.
+func Middleware(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		collection := client.GetCollection(config.Env.DatabaseName, "idempotency_keys")
+		ctx := c.Request.Context()
+
+		now := time.Now()
+		record := Record{
+			Key:         key,
+			Caller:      caller(c),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hash(body),
+			Status:      statusProcessing,
+			LockedUntil: now.Add(lease),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(config.Env.IdempotencyTTL),
+		}
+		record.ID = record.id()
+
+		_, err = collection.InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			// A request that is still processing past its lease has most
+			// likely died with its instance, the retry handles it instead
+			err = collection.FindOneAndUpdate(
+				ctx,
+				bson.D{
+					{Key: "_id", Value: record.ID},
+					{Key: "request_hash", Value: record.RequestHash},
+					{Key: "status", Value: statusProcessing},
+					{Key: "locked_until", Value: bson.M{"$lt": now}},
+				},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "locked_until", Value: record.LockedUntil}}}},
+			).Err()
+			if err == mongo.ErrNoDocuments {
+				replay(c, collection, record)
+				return
+			}
+		}
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// The response is stored even when the client hung up, that is when
+		// it is most likely to retry
+		storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+		defer cancel()
+
+		handled := false
+		defer func() {
+			// The handler panicked, the key is released before the panic
+			// goes on to the recovery middleware
+			if !handled {
+				release(storeCtx, collection, record)
+			}
+		}()
+
+		c.Next()
+		handled = true
+
+		if !stored(recorder.Status()) {
+			release(storeCtx, collection, record)
+			return
+		}
+
+		// Only the request holding the lease stores its response
+		_, err = collection.UpdateOne(
+			storeCtx,
+			bson.D{{Key: "_id", Value: record.ID}, {Key: "locked_until", Value: record.LockedUntil}},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: statusCompleted},
+					{Key: "status_code", Value: recorder.Status()},
+					{Key: "content_type", Value: recorder.Header().Get("Content-Type")},
+					{Key: "body", Value: recorder.body.Bytes()},
+				}},
+				{Key: "$unset", Value: bson.D{{Key: "locked_until", Value: ""}}},
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to store response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// stored reports whether the response with a status is stored for retries.
+// Failures a retry may not run into again are forgotten.
+func stored(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+// release forgets a key whose request was not completed, so it can be
+// retried, unless another request took over its lease.
+func release(ctx context.Context, collection *mongo.Collection, record Record) {
+	_, err := collection.DeleteOne(
+		ctx,
+		bson.D{{Key: "_id", Value: record.ID}, {Key: "locked_until", Value: record.LockedUntil}},
+	)
+	if err != nil {
+		log.Printf("Failed to release idempotency key %q: %v", record.Key, err)
+	}
+}
+
+// caller identifies who made a request, so a key only ever replays the
+// responses of its own caller.
+func caller(c *gin.Context) string {
+	if claims, ok := c.Get("claims"); ok {
+		if claims, ok := claims.(jwt.MapClaims); ok {
+			if userID, ok := claims["UserID"].(string); ok {
+				return "user:" + userID
+			}
+		}
+	}
+	if token := table.TokenFromRequest(c); token != "" {
+		return "table:" + hash([]byte(token))
+	}
+	return ""
+}
+
+// replay answers a retry with the stored response of the first request made
+// with the key.
+func replay(c *gin.Context, collection *mongo.Collection, record Record) {
+	var first Record
+	err := collection.FindOne(c.Request.Context(), bson.D{{Key: "_id", Value: record.ID}}).Decode(&first)
+	if err != nil {
+		// The first request failed or expired in the meantime
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key is being retried, try again"})
+			c.Abort()
+			return
+		}
+		utils.HandleMongoError(c, err)
+		c.Abort()
+		return
+	}
+
+	switch {
+	case first.RequestHash != record.RequestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used with a different request body",
+		})
+	case first.Status != statusCompleted:
+		c.JSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key is still being processed"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(first.StatusCode, first.ContentType, first.Body)
+	}
+	c.Abort()
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
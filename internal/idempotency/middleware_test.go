@@ -0,0 +1,211 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// router serves POST /orders through the middleware with the given handler,
+// as the staff user when userID is set.
+func router(mt *mtest.T, userID string, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.POST("/orders", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("claims", jwt.MapClaims{"UserID": userID})
+		}
+	}, Middleware(db.NewMockMongoClient(mt.Coll)), handler)
+	return r
+}
+
+func post(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func created(c *gin.Context) {
+	c.JSON(http.StatusCreated, gin.H{"id": 1})
+}
+
+// commands returns the names of the commands sent to the database.
+func commands(mt *mtest.T) []string {
+	var names []string
+	for {
+		event := mt.GetStartedEvent()
+		if event == nil {
+			return names
+		}
+		names = append(names, event.CommandName)
+	}
+}
+
+// storedRecord is the record of a completed request made with the body.
+func storedRecord(body string, status int, response string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: "id"},
+		{Key: "request_hash", Value: hash([]byte(body))},
+		{Key: "status", Value: statusCompleted},
+		{Key: "status_code", Value: status},
+		{Key: "content_type", Value: "application/json; charset=utf-8"},
+		{Key: "body", Value: []byte(response)},
+	}
+}
+
+var duplicateKey = mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+
+func TestMiddleware(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("without a key", func(mt *mtest.T) {
+		w := post(router(mt, "", created), "", `{}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, commands(mt))
+	})
+
+	mt.Run("key too long", func(mt *mtest.T) {
+		w := post(router(mt, "", created), strings.Repeat("k", maxKeyLength+1), `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	mt.Run("first request is stored", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		w := post(router(mt, "", created), "key", `{}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []string{"insert", "update"}, commands(mt))
+	})
+
+	mt.Run("retry replays the response", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			duplicateKey,
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.idempotency_keys", mtest.FirstBatch, storedRecord(`{}`, 201, `{"id":1}`)),
+		)
+		handled := false
+
+		w := post(router(mt, "", func(c *gin.Context) { handled = true }), "key", `{}`)
+
+		assert.False(t, handled)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `{"id":1}`, w.Body.String())
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	})
+
+	mt.Run("retry with another body", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			duplicateKey,
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.idempotency_keys", mtest.FirstBatch, storedRecord(`{}`, 201, `{"id":1}`)),
+		)
+
+		w := post(router(mt, "", created), "key", `{"other":true}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	mt.Run("retry while processing", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			duplicateKey,
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "db.idempotency_keys", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "id"},
+				{Key: "request_hash", Value: hash([]byte(`{}`))},
+				{Key: "status", Value: statusProcessing},
+				{Key: "locked_until", Value: time.Now().Add(lease)},
+			}),
+		)
+
+		w := post(router(mt, "", created), "key", `{}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	mt.Run("retry takes over an expired lease", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			duplicateKey,
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: "id"}}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		w := post(router(mt, "", created), "key", `{}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []string{"insert", "findAndModify", "update"}, commands(mt))
+	})
+
+	mt.Run("conflicts are not stored", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		w := post(router(mt, "", func(c *gin.Context) {
+			c.JSON(http.StatusConflict, gin.H{"error": "conflict"})
+		}), "key", `{}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, []string{"insert", "delete"}, commands(mt))
+	})
+
+	mt.Run("panics release the key", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		w := post(router(mt, "", func(c *gin.Context) { panic("boom") }), "key", `{}`)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, []string{"insert", "delete"}, commands(mt))
+	})
+
+	mt.Run("keys belong to their caller", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		post(router(mt, "user1", created), "key", `{}`)
+		post(router(mt, "user2", created), "key", `{}`)
+
+		var ids []string
+		for {
+			event := mt.GetStartedEvent()
+			if event == nil {
+				break
+			}
+			if event.CommandName == "insert" {
+				ids = append(ids, event.Command.Lookup("documents", "0", "_id").StringValue())
+			}
+		}
+		assert.Len(t, ids, 2)
+		assert.NotEqual(t, ids[0], ids[1])
+	})
+}
+
+func TestStored(t *testing.T) {
+	assert.True(t, stored(http.StatusCreated))
+	assert.True(t, stored(http.StatusBadRequest))
+	assert.True(t, stored(http.StatusUnprocessableEntity))
+	assert.False(t, stored(http.StatusUnauthorized))
+	assert.False(t, stored(http.StatusForbidden))
+	assert.False(t, stored(http.StatusConflict))
+	assert.False(t, stored(http.StatusTooManyRequests))
+	assert.False(t, stored(http.StatusInternalServerError))
+}
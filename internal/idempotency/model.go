@@ -0,0 +1,39 @@
+package idempotency
+
+import "time"
+
+const (
+	Header = "Idempotency-Key"
+
+	statusProcessing = "processing"
+	statusCompleted  = "completed"
+
+	maxKeyLength = 255
+
+	lease        = time.Minute     // a request still processing after this is handled again by a retry
+	storeTimeout = 5 * time.Second // for storing or releasing a key once the request was handled
+)
+
+// Record is the first request made with an idempotency key and, once it has
+// been handled, its response. Records are removed by a TTL index once they
+// expire.
+type Record struct {
+	ID          string    `bson:"_id"` // hash of the caller, method, path and key
+	Key         string    `bson:"key"`
+	Caller      string    `bson:"caller,omitempty"` // staff user or hash of the table token
+	Method      string    `bson:"method"`
+	Path        string    `bson:"path"`
+	RequestHash string    `bson:"request_hash"` // hash of the request body
+	Status      string    `bson:"status"`
+	LockedUntil time.Time `bson:"locked_until,omitempty"` // lease of the request processing it
+	StatusCode  int       `bson:"status_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// id identifies a key within its caller, method and path.
+func (r Record) id() string {
+	return hash([]byte(r.Caller + " " + r.Method + " " + r.Path + " " + r.Key))
+}
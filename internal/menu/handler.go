@@ -16,6 +16,8 @@ import (
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/config"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
@@ -154,7 +156,15 @@ func CreateMenuItem(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Insert the item into the database
-		result, err := collection.InsertOne(ctx, item)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			result, err := collection.InsertOne(sc, item)
+			if err != nil {
+				return err
+			}
+			item.ID = result.InsertedID.(primitive.ObjectID)
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.MenuChanged, Data: gin.H{"action": "created", "item": item}})
+		})
 		if err != nil {
 			if mongo.IsDuplicateKeyError(err) {
 				c.JSON(http.StatusConflict, gin.H{
@@ -165,10 +175,11 @@ func CreateMenuItem(client db.IMongoClient) gin.HandlerFunc {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Item added successfully",
-			"id":      result.InsertedID,
+			"id":      item.ID,
 		})
 	}
 }
@@ -209,10 +220,15 @@ func DeleteMenuItem(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Delete menu item from database
-		result := collection.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: docID}})
-
 		var deletedItem MenuItem
-		err = result.Decode(&deletedItem)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			err := collection.FindOneAndDelete(sc, bson.D{{Key: "_id", Value: docID}}).Decode(&deletedItem)
+			if err != nil {
+				return err
+			}
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.MenuChanged, Data: gin.H{"action": "deleted", "item": deletedItem}})
+		})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
@@ -222,6 +238,8 @@ func DeleteMenuItem(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
+		outbox.Notify()
+
 		_ = os.Remove(deletedItem.Img)
 
 		c.JSON(http.StatusOK, nil)
@@ -0,0 +1,98 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/ws"
+)
+
+// bumpRequest are the arguments of the bump command. Lines are indexes into
+// the order's items.
+type bumpRequest struct {
+	OrderID string `json:"orderId" validate:"required"`
+	Lines   []int  `json:"lines"   validate:"required,min=1,dive,gte=0"`
+	Version *int64 `json:"version"`
+}
+
+// BumpItems is the WebSocket command station displays send once order lines
+// are prepared. It marks the lines ready and publishes an order.ready event
+// so waiters know to pick them up.
+func BumpItems(ctx context.Context, client db.IMongoClient, caller ws.Caller, data json.RawMessage) (any, error) {
+	var request bumpRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, ws.Errorf("Invalid request body")
+	}
+	if err := validateOrder(validate, request); err != nil {
+		return nil, ws.Errorf("%s", err.Error())
+	}
+
+	id, err := primitive.ObjectIDFromHex(request.OrderID)
+	if err != nil {
+		return nil, ws.Errorf("Invalid Order ID!")
+	}
+
+	collection := client.GetCollection(config.Env.DatabaseName, "orders")
+
+	var order Order
+	err = collection.FindOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "closed_at", Value: bson.M{"$exists": false}},
+	}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ws.Errorf("Order not found.")
+		}
+		return nil, err
+	}
+	if request.Version != nil && *request.Version != order.Version {
+		return nil, ws.Errorf("Order was changed by someone else, review the current order and try again")
+	}
+
+	readyAt := time.Now()
+	set := bson.D{}
+	for _, line := range request.Lines {
+		if line >= len(order.Items) {
+			return nil, ws.Errorf("Order has no line %d", line)
+		}
+		set = append(set, bson.E{Key: fmt.Sprintf("items.%d.ready_at", line), Value: readyAt})
+		order.Items[line].ReadyAt = &readyAt
+	}
+
+	actor := Actor{UserID: caller.UserID, IP: caller.IP}
+	entry := actor.Entry(order.ID, HistoryReady, bson.M{"lines": request.Lines})
+
+	// Lines are addressed by index, so the order must not have changed
+	saved, err := saveChange(ctx, client, &order, entry, sse.OrderReady, func(sc mongo.SessionContext) (bool, error) {
+		result, err := collection.UpdateOne(
+			sc,
+			bson.D{
+				{Key: "_id", Value: id},
+				versionFilter(order.Version),
+				{Key: "closed_at", Value: bson.M{"$exists": false}},
+			},
+			bson.D{{Key: "$set", Value: set}, incVersion},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ws.Errorf("Order was changed by someone else, review the current order and try again")
+	}
+
+	return order, nil
+}
@@ -0,0 +1,426 @@
+package order
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+type discountRequest struct {
+	MenuItemID string         `json:"menuItemId"` // empty for an order-level discount
+	Seat       uint8          `json:"seat"`
+	Type       string         `json:"type"       validate:"required,oneof=percent fixed comp"`
+	Value      int64          `json:"value"      validate:"gte=0"`
+	Reason     string         `json:"reason"     validate:"required,oneof=staff_meal complaint promo other"`
+	Note       string         `json:"note"       validate:"max=200"`
+	Approval   *auth.Approval `json:"approval"` // required above the approval threshold unless an admin applies it
+}
+
+// Gross returns the price of the line before its discount.
+func (item OrderItem) Gross() int64 {
+	return item.MenuItem.Price * int64(item.Quantity)
+}
+
+// Net returns the price of the line after its discount.
+func (item OrderItem) Net() int64 {
+	if item.Discount == nil {
+		return item.Gross()
+	}
+	return item.Gross() - item.Discount.Amount
+}
+
+// Take returns a copy of the line with the given quantity. A fixed discount
+// and the discounted amount are prorated to the new quantity.
+func (item OrderItem) Take(quantity uint8) OrderItem {
+	line := item
+	line.Quantity = quantity
+
+	if item.Discount != nil && item.Quantity > 0 {
+		discount := *item.Discount
+		if discount.Type == DiscountFixed {
+			discount.Value = discount.Value * int64(quantity) / int64(item.Quantity)
+		}
+		discount.Amount = discount.Amount * int64(quantity) / int64(item.Quantity)
+		line.Discount = &discount
+	}
+	return line
+}
+
+// discountAmount returns how much a discount takes off the base amount.
+func discountAmount(discount Discount, base int64) int64 {
+	switch discount.Type {
+	case DiscountPercent:
+		return base * discount.Value / 100
+	case DiscountFixed:
+		return min(discount.Value, base)
+	case DiscountComp:
+		return base
+	}
+	return 0
+}
+
+// priceOrder works out the discount amounts, gross price, total discount,
+// tax and amount due of an order. Order-level discounts apply to the lines'
+// price after their own discounts, and tax to the price after all discounts.
+func priceOrder(order *Order, rates []tax.Rate) {
+	var gross, lineDiscounts int64
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Discount != nil {
+			item.Discount.Amount = discountAmount(*item.Discount, item.Gross())
+			lineDiscounts += item.Discount.Amount
+		}
+		gross += item.Gross()
+	}
+
+	order.GrossPrice = gross
+	order.DiscountTotal = lineDiscounts
+	if order.Discount != nil {
+		order.Discount.Amount = discountAmount(*order.Discount, gross-lineDiscounts)
+		order.DiscountTotal += order.Discount.Amount
+	}
+
+	if order.Service == "" {
+		order.Service = tax.ServiceEatIn
+	}
+	order.TaxInclusive = config.Env.TaxInclusive
+	order.Taxes, order.TaxTotal = tax.Calculate(rates, taxLines(*order), order.Service, order.TaxInclusive)
+
+	order.TotalPrice = gross - order.DiscountTotal
+	if !order.TaxInclusive {
+		order.TotalPrice += order.TaxTotal
+	}
+}
+
+// taxLines returns the amount of every line after its discount and its share
+// of the order-level discount.
+func taxLines(order Order) []tax.Line {
+	var linesNet int64
+	for _, item := range order.Items {
+		linesNet += item.Net()
+	}
+
+	var orderDiscount int64
+	if order.Discount != nil {
+		orderDiscount = order.Discount.Amount
+	}
+
+	lines := make([]tax.Line, len(order.Items))
+	left := orderDiscount
+	for i, item := range order.Items {
+		share := left
+		if i < len(order.Items)-1 && linesNet > 0 {
+			share = orderDiscount * item.Net() / linesNet
+		}
+		left -= share
+
+		lines[i] = tax.Line{
+			MenuItemID: item.MenuItem.ID,
+			Category:   item.MenuItem.Category,
+			Amount:     item.Net() - share,
+		}
+	}
+	return lines
+}
+
+// stripDiscounts removes discounts sent along with order lines, which can
+// only be given through the discount endpoint.
+func stripDiscounts(items []OrderItem) {
+	for i := range items {
+		items[i].Discount = nil
+	}
+}
+
+// findLine returns the index of the first line of the menu item at the
+// seat, or -1.
+func findLine(items []OrderItem, menuItemID primitive.ObjectID, seat uint8) int {
+	for i, item := range items {
+		if item.MenuItem.ID == menuItemID && item.Seat == seat {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyDiscount discounts an order or one of its lines
+//
+// @Summary Apply a discount
+// @Description Applies a percent or fixed discount, or a comp, to an order line (menuItemId and seat) or to the whole order.
+// @Description Applying a discount replaces the previous one. Discounts above DISCOUNT_APPROVAL_THRESHOLD need an admin's credentials in the approval field.
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param If-Match header string false "Order version the change is based on"
+// @Param discount body discountRequest true "Discount details"
+// @Security bearerToken
+// @Success 200 {object} Order "Discounted order"
+// @Failure 400 "Invalid request"
+// @Failure 403 "Manager approval required or denied"
+// @Failure 404 "Order or line not found"
+// @Failure 409 "Order is closed or changed since the If-Match version"
+// @Failure 500 "Internal Server Error"
+// @Router /order/discount/{id} [post]
+func ApplyDiscount(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request discountRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch {
+		case request.Type == DiscountPercent && (request.Value == 0 || request.Value > 100):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Percent discounts must be between 1 and 100"})
+			return
+		case request.Type == DiscountFixed && request.Value == 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fixed discounts must have a value"})
+			return
+		case request.Type == DiscountComp:
+			request.Value = 0
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		order, ok := findOpenOrder(c, client, id)
+		if !ok || !checkVersion(c, order) {
+			return
+		}
+
+		discount := &Discount{
+			Type:      request.Type,
+			Value:     request.Value,
+			Reason:    request.Reason,
+			Note:      request.Note,
+			AppliedBy: userID,
+			AppliedAt: time.Now(),
+		}
+
+		if request.MenuItemID != "" {
+			menuItemID, err := primitive.ObjectIDFromHex(request.MenuItemID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Menu Item ID"})
+				return
+			}
+
+			line := findLine(order.Items, menuItemID, request.Seat)
+			if line < 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order has no such line"})
+				return
+			}
+			order.Items[line].Discount = discount
+		} else {
+			order.Discount = discount
+		}
+
+		rates, err := tax.LoadRates(c.Request.Context(), client)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		priceOrder(&order, rates)
+
+		if discount.Amount > config.Env.DiscountApprovalThreshold {
+			approverID, ok := auth.ApproveAction(c, client, request.Approval)
+			if !ok {
+				return
+			}
+			discount.ApprovedBy = approverID
+		}
+
+		entry := ActorOf(c).Entry(order.ID, HistoryDiscounted, bson.M{
+			"menu_item_id": request.MenuItemID,
+			"seat":         request.Seat,
+			"discount":     discount,
+			"version":      order.Version + 1,
+		})
+		if !savePricing(c, client, &order, entry) {
+			return
+		}
+
+		c.Header("ETag", etag(order.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Discount applied successfully",
+			"data":    order,
+		})
+	}
+}
+
+// RemoveDiscount removes a discount from an order or one of its lines
+//
+// @Summary Remove a discount
+// @Description Removes the discount of an order line (menuItemId and seat) or, without menuItemId, the order-level discount.
+// @Tags order
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param If-Match header string false "Order version the change is based on"
+// @Param menuItemId query string false "Menu item ID of the discounted line"
+// @Param seat query int false "Seat of the discounted line"
+// @Security bearerToken
+// @Success 200 {object} Order "Order without the discount"
+// @Failure 400 "Invalid request"
+// @Failure 404 "Order or line not found"
+// @Failure 409 "Order is closed or changed since the If-Match version"
+// @Failure 500 "Internal Server Error"
+// @Router /order/discount/{id} [delete]
+func RemoveDiscount(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		order, ok := findOpenOrder(c, client, id)
+		if !ok || !checkVersion(c, order) {
+			return
+		}
+
+		details := bson.M{}
+		if menuItemParam := c.Query("menuItemId"); menuItemParam != "" {
+			menuItemID, err := primitive.ObjectIDFromHex(menuItemParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Menu Item ID"})
+				return
+			}
+
+			seat, err := strconv.Atoi(c.DefaultQuery("seat", "0"))
+			if err != nil || seat < 0 || seat > 255 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seat"})
+				return
+			}
+
+			line := findLine(order.Items, menuItemID, uint8(seat))
+			if line < 0 || order.Items[line].Discount == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Line has no discount"})
+				return
+			}
+			details["menu_item_id"] = menuItemParam
+			details["seat"] = seat
+			details["discount"] = order.Items[line].Discount
+			order.Items[line].Discount = nil
+		} else {
+			if order.Discount == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order has no discount"})
+				return
+			}
+			details["discount"] = order.Discount
+			order.Discount = nil
+		}
+
+		rates, err := tax.LoadRates(c.Request.Context(), client)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		priceOrder(&order, rates)
+
+		details["version"] = order.Version + 1
+		if !savePricing(c, client, &order, ActorOf(c).Entry(order.ID, HistoryDiscountRemoved, details)) {
+			return
+		}
+
+		c.Header("ETag", etag(order.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Discount removed successfully",
+			"data":    order,
+		})
+	}
+}
+
+// findOpenOrder loads an order that has not been closed yet, writing the
+// error response itself when there is none.
+func findOpenOrder(c *gin.Context, client db.IMongoClient, id primitive.ObjectID) (Order, bool) {
+	var order Order
+	err := client.GetCollection(config.Env.DatabaseName, "orders").
+		FindOne(c.Request.Context(), bson.D{{Key: "_id", Value: id}}).
+		Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found."})
+			return Order{}, false
+		}
+		utils.HandleMongoError(c, err)
+		return Order{}, false
+	}
+
+	if order.ClosedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Closed orders can only be refunded"})
+		return Order{}, false
+	}
+
+	return order, true
+}
+
+// savePricing stores the lines, voids, discounts and prices of an open order
+// together with its history entry and bumps its version. The order must not
+// have changed since it was read.
+func savePricing(c *gin.Context, client db.IMongoClient, order *Order, entry HistoryEntry) bool {
+	saved, err := saveChange(c.Request.Context(), client, order, entry, sse.OrderUpdated, func(sc mongo.SessionContext) (bool, error) {
+		result, err := client.GetCollection(config.Env.DatabaseName, "orders").UpdateOne(
+			sc,
+			bson.D{
+				{Key: "_id", Value: order.ID},
+				versionFilter(order.Version),
+				{Key: "closed_at", Value: bson.M{"$exists": false}},
+			},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "items", Value: order.Items},
+				{Key: "voids", Value: order.Voids},
+				{Key: "discount", Value: order.Discount},
+				{Key: "gross_price", Value: order.GrossPrice},
+				{Key: "discount_total", Value: order.DiscountTotal},
+				{Key: "tax_inclusive", Value: order.TaxInclusive},
+				{Key: "taxes", Value: order.Taxes},
+				{Key: "tax_total", Value: order.TaxTotal},
+				{Key: "total_price", Value: order.TotalPrice},
+			}}, incVersion},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount > 0, nil
+	})
+	if err != nil {
+		utils.HandleMongoError(c, err)
+		return false
+	}
+
+	if !saved {
+		conflictOrCurrent(c, client, order.ID)
+		return false
+	}
+	return true
+}
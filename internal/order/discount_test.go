@@ -0,0 +1,113 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+)
+
+func TestDiscountAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		discount Discount
+		want     int64
+	}{
+		{"percent", Discount{Type: DiscountPercent, Value: 15}, 150},
+		{"fixed", Discount{Type: DiscountFixed, Value: 300}, 300},
+		{"fixed above the price", Discount{Type: DiscountFixed, Value: 1500}, 1000},
+		{"comp", Discount{Type: DiscountComp}, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, discountAmount(tt.discount, 1000))
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Price: 400}
+
+	t.Run("fixed discount is prorated", func(t *testing.T) {
+		line := OrderItem{MenuItem: coffee, Quantity: 4, Discount: &Discount{Type: DiscountFixed, Value: 400, Amount: 400}}
+
+		taken := line.Take(1)
+
+		assert.Equal(t, int64(100), taken.Discount.Value)
+		assert.Equal(t, int64(100), taken.Discount.Amount)
+		assert.Equal(t, int64(300), taken.Net())
+		assert.Equal(t, int64(400), line.Discount.Amount)
+	})
+
+	t.Run("percent keeps its value", func(t *testing.T) {
+		line := OrderItem{MenuItem: coffee, Quantity: 2, Discount: &Discount{Type: DiscountPercent, Value: 50, Amount: 400}}
+
+		taken := line.Take(1)
+
+		assert.Equal(t, int64(50), taken.Discount.Value)
+		assert.Equal(t, int64(200), taken.Discount.Amount)
+	})
+}
+
+func TestPriceOrderDiscounts(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Price: 400}
+	cake := menu.MenuItem{ID: primitive.NewObjectID(), Price: 600}
+
+	order := Order{
+		Items: []OrderItem{
+			{MenuItem: coffee, Quantity: 2, Discount: &Discount{Type: DiscountComp}},
+			{MenuItem: cake, Quantity: 2, Discount: &Discount{Type: DiscountFixed, Value: 200}},
+		},
+		Discount: &Discount{Type: DiscountPercent, Value: 10},
+	}
+
+	priceOrder(&order, nil)
+
+	assert.Equal(t, int64(2000), order.GrossPrice)
+	assert.Equal(t, int64(800), order.Items[0].Discount.Amount)
+	assert.Equal(t, int64(200), order.Items[1].Discount.Amount)
+	// The order discount applies after the line discounts
+	assert.Equal(t, int64(100), order.Discount.Amount)
+	assert.Equal(t, int64(1100), order.DiscountTotal)
+	assert.Equal(t, int64(900), order.TotalPrice)
+}
+
+func TestStripDiscounts(t *testing.T) {
+	items := []OrderItem{{Quantity: 1, Discount: &Discount{Type: DiscountComp}}, {Quantity: 1}}
+
+	stripDiscounts(items)
+
+	assert.Nil(t, items[0].Discount)
+	assert.Nil(t, items[1].Discount)
+}
+
+func TestFindLine(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID()}
+	items := []OrderItem{{MenuItem: coffee, Seat: 1}, {MenuItem: coffee, Seat: 2}}
+
+	assert.Equal(t, 1, findLine(items, coffee.ID, 2))
+	assert.Equal(t, -1, findLine(items, coffee.ID, 0))
+	assert.Equal(t, -1, findLine(items, primitive.NewObjectID(), 1))
+}
+
+func TestTaxLines(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Category: "drinks", Price: 300}
+	cake := menu.MenuItem{ID: primitive.NewObjectID(), Category: "food", Price: 600}
+
+	lines := taxLines(Order{
+		Items: []OrderItem{
+			{MenuItem: coffee, Quantity: 1},
+			{MenuItem: cake, Quantity: 1, Discount: &Discount{Type: DiscountFixed, Amount: 100}},
+		},
+		Discount: &Discount{Type: DiscountFixed, Amount: 100},
+	})
+
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "drinks", lines[0].Category)
+	// The order discount is shared 300:500, the last line takes the remainder
+	assert.Equal(t, int64(263), lines[0].Amount)
+	assert.Equal(t, int64(437), lines[1].Amount)
+}
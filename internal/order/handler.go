@@ -1,6 +1,7 @@
 package order
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -17,41 +18,56 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
 var validate = validator.New()
 
 type orderRequest struct {
-	Items []OrderItem `json:"items" validate:"required"`
+	Items   []OrderItem `json:"items"   validate:"required"`
+	Service string      `json:"service" validate:"omitempty,oneof=eat_in takeaway"`
+}
+
+type updateOrderRequest struct {
+	orderRequest
+	Version *int64 `json:"version"` // when not sent in the If-Match header
 }
 
 // CreateOrder creates an order and saves it in the database
 //
 // @Summary Create a new order
-// @Description Creates a new order for a specific table and saves it in the database
+// @Description Creates a new order for a specific table and saves it in the database. Only the IDs of the lines'
+// @Description menu items are read, lines are priced and taxed with the items as they are on the menu.
 // @Tags order
 // @Param table path int true "Table number"
+// @Param token query string true "Table token from the table's QR code (or X-Table-Token header)"
 // @Param order body orderRequest true "Order details"
-// @Success 200 {object} map[string]interface{} "Order created successfully"
-// @Failure 400  "Invalid request"
+// @Success 200 {object} map[string]interface{} "Order created successfully, with its version, also sent as the ETag header"
+// @Failure 400  "Invalid request or items not on the menu"
+// @Failure 401  "Invalid or expired table token"
 // @Failure 500  "Internal Server Error"
 // @Router /order/{table} [post]
 func CreateOrder(client db.IMongoClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		table := c.Param("tableID")
+		tableParam := c.Param("tableID")
 
-		if table == "" {
+		if tableParam == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid Parameter",
 			})
 			return
 		}
 
-		tableID, err := primitive.ObjectIDFromHex(table)
+		tableID, err := primitive.ObjectIDFromHex(tableParam)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid Table ID",
@@ -59,19 +75,19 @@ func CreateOrder(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
-		ok, err := checkTable(tableID, c, client)
+		// Customers can only order to the table whose QR code they scanned
+		orderTable, err := table.VerifyToken(c.Request.Context(), client, tableID, table.TokenFromRequest(c))
 		if err != nil {
+			if errors.Is(err, table.ErrInvalidToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid or expired table token, please scan the table's QR code again",
+				})
+				return
+			}
 			utils.HandleMongoError(c, err)
 			return
 		}
 
-		if ok != true {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Table not found, Please provide a valid Table ID",
-			})
-			return
-		}
-
 		var request orderRequest
 
 		// Bind the request body to the order struct
@@ -89,22 +105,7 @@ func CreateOrder(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
-		totalPrice := int64(0)
-
-		// Validate Items
-		for _, orderItem := range request.Items {
-			if err := menu.ValidateMenu(validate, orderItem.MenuItem); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf(
-						"Validation failed for item %s: %s",
-						orderItem.MenuItem.Name,
-						err.Error(),
-					),
-				})
-				return
-			}
-			totalPrice += orderItem.MenuItem.Price * int64(orderItem.Quantity)
-		}
+		stripDiscounts(request.Items)
 
 		// Validate the struct
 		if err := validateOrder(validate, request); err != nil {
@@ -112,6 +113,20 @@ func CreateOrder(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		// Only the IDs of the client's menu items are used, the items are
+		// priced and taxed as they are on the menu
+		if err := loadMenuItems(ctx, client, request.Items); err != nil {
+			if err == errNotOnMenu {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Order includes items that are not on the menu"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
 		order := &Order{}
 
 		order.Items = request.Items
@@ -121,26 +136,69 @@ func CreateOrder(client db.IMongoClient) gin.HandlerFunc {
 		order.ServedAt = nil
 		order.HandledBy = primitive.NilObjectID
 		order.ClosedBy = primitive.NilObjectID
-		order.TotalPrice = totalPrice
+		order.Service = request.Service
+		order.Version = 1
+
+		rates, err := tax.LoadRates(ctx, client)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		priceOrder(order, rates)
 
 		// Get the collection
 		collection := client.GetCollection(config.Env.DatabaseName, "orders")
 
-		// Get context from the request
-		ctx := c.Request.Context()
+		// The order, its session, its tickets and its events are saved
+		// together, so none of them is lost or sent for an order that was
+		// never created
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			// Attach the order to the party's visit, opening one on the first order
+			tableSession, opened, err := session.GetOrOpen(sc, client, tableID)
+			if err != nil {
+				return err
+			}
+			order.SessionID = tableSession.ID
+
+			if opened {
+				event := sse.TableStatusEvent(tableID.Hex(), tableSession.ID.Hex(), sse.StatusOccupied)
+				if err := outbox.Publish(sc, client, event); err != nil {
+					return err
+				}
+			}
+
+			// Insert the item into the database
+			result, err := collection.InsertOne(sc, order)
+			if err != nil {
+				return err
+			}
+			order.ID = result.InsertedID.(primitive.ObjectID)
 
-		// Insert the item into the database
-		result, err := collection.InsertOne(ctx, order)
+			err = recordHistory(sc, client, ActorOf(c).Entry(order.ID, HistoryCreated, bson.M{
+				"items":       order.Items,
+				"service":     order.Service,
+				"total_price": order.TotalPrice,
+			}))
+			if err != nil {
+				return err
+			}
+
+			if err := outbox.Print(sc, client, printer.Tickets(ticketOf(*order, orderTable.Name))...); err != nil {
+				return err
+			}
+			return outbox.Publish(sc, client, orderEvent(sse.OrderCreated, *order))
+		})
 		if err != nil {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
 
-		sse.Notify(table)
-
+		c.Header("ETag", etag(order.Version))
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Order created successfuly",
-			"id":      result.InsertedID,
+			"id":      order.ID,
+			"version": order.Version,
 		})
 	}
 }
@@ -373,18 +431,41 @@ func ServeOrder(client db.IMongoClient) gin.HandlerFunc {
 		}
 
 		// Prepare the update statement
+		servedAt := time.Now()
 		update := bson.D{
 			{Key: "$set", Value: bson.D{
-				{Key: "served_at", Value: time.Now()},
+				{Key: "served_at", Value: servedAt},
 				{Key: "handled_by", Value: userID},
 			}},
+			incVersion,
 		}
 
-		// Find order and if exists update
-		result := collection.FindOneAndUpdate(ctx, filter, update)
-
 		var order Order
-		err = result.Decode(&order)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			// Find order and if exists update
+			err := collection.FindOneAndUpdate(sc, filter, update).Decode(&order)
+			if err != nil {
+				return err
+			}
+
+			if err := recordHistory(sc, client, ActorOf(c).Entry(order.ID, HistoryServed, nil)); err != nil {
+				return err
+			}
+
+			// The first waiter to serve a session without an assigned waiter takes it over
+			if !order.SessionID.IsZero() {
+				if err := session.AssignWaiterIfEmpty(sc, client, order.SessionID, userID); err != nil {
+					return err
+				}
+			}
+
+			// The order was read before the update
+			served := order
+			served.ServedAt = &servedAt
+			served.HandledBy = userID
+			served.Version++
+			return outbox.Publish(sc, client, orderEvent(sse.OrderServed, served))
+		})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(
@@ -396,6 +477,7 @@ func ServeOrder(client db.IMongoClient) gin.HandlerFunc {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
 
 		c.JSON(http.StatusOK, gin.H{"message": "Order served successfully"})
 	}
@@ -404,12 +486,14 @@ func ServeOrder(client db.IMongoClient) gin.HandlerFunc {
 // CloseOrder marks an order as complete
 //
 // @Summary Mark an order as complete
-// @Description Allows admin and cashier roles to marks all orders complete for a given table ID
+// @Description Allows admin and cashier roles to close the served orders of the open session of a given table ID.
+// @Description The session is closed once none of its orders remain open. Served orders must be covered by payments.
 // @Tags order
 // @Param id path string true "Table ID"
 // @Security bearerToken
 // @Success 200 {object} map[string]interface{} "Order completed successfully"
 // @Failure 404  "Order not found"
+// @Failure 409  "Payments do not cover the balance"
 // @Failure 500  "Internal Server Error"
 // @Router /order/close/{tableID} [patch]
 func CloseOrder(client db.IMongoClient) gin.HandlerFunc {
@@ -423,101 +507,115 @@ func CloseOrder(client db.IMongoClient) gin.HandlerFunc {
 		}
 
 		// Convert parameter ID
-		id, _ := primitive.ObjectIDFromHex(idParam)
-
-		// Get claims from Gin context
-		claims, exists := c.Get("claims")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		id, err := primitive.ObjectIDFromHex(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
 			return
 		}
 
-		// Type assert to jwt.MapClaims
-		jwtClaims, ok := claims.(jwt.MapClaims)
+		userID, ok := auth.GetUserID(c)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token data"})
 			return
 		}
 
-		// Extract UserID
-		userIDHex, ok := jwtClaims["UserID"].(string)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
-			return
-		}
-		// Convert the string back to primitive.ObjectID
-		userID, err := primitive.ObjectIDFromHex(userIDHex)
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		tableSession, err := session.FindOpen(ctx, client, id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid ObjectID"})
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table has no open session"})
+				return
+			}
+			utils.HandleMongoError(c, err)
 			return
 		}
 
-		// Filters by id and checks if its served
-		filter := bson.D{
-			{Key: "table_id", Value: id},
-			{Key: "served_at", Value: bson.M{"$exists": true}},
-			{Key: "closed_at", Value: bson.M{"$exists": false}},
-		}
+		closeSessionOrders(c, client, tableSession, userID)
+	}
+}
 
-		update := bson.D{
-			{Key: "$set", Value: bson.D{
-				{Key: "closed_at", Value: time.Now()},
-				{Key: "closed_by", Value: userID},
-			}},
+// CloseSession closes a table session and its served orders
+//
+// @Summary Close a table session
+// @Description Allows admin and cashier roles to close the served orders of a session.
+// @Description The session is closed once none of its orders remain open.
+// @Tags session
+// @Param id path string true "Session ID"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Session closed successfully"
+// @Failure 400  "Invalid ID"
+// @Failure 404  "Session not found or orders must be served first"
+// @Failure 500  "Internal Server Error"
+// @Router /session/{id}/close [patch]
+func CloseSession(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
 		}
 
-		// Get the collection from the database
-		collection := client.GetCollection(config.Env.DatabaseName, "orders")
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
 
 		// Get context from the request
 		ctx := c.Request.Context()
 
-		// Updates the first document that has the specified "_id" value
-		result, err := collection.UpdateMany(ctx, filter, update)
+		var tableSession session.Session
+		err = client.GetCollection(config.Env.DatabaseName, "sessions").FindOne(ctx, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: session.StatusOpen},
+		}).Decode(&tableSession)
 		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or already closed"})
+				return
+			}
 			utils.HandleMongoError(c, err)
 			return
 		}
 
-		// Check if a document was actually updated
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or must be served first"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Order closed succesfully",
-		})
+		closeSessionOrders(c, client, tableSession, userID)
 	}
 }
 
 // UpdateOrder updates an existing order
 //
 // @Summary Update an existing order
-// @Description Allows admin, cashier, and waiter roles to update an order
+// @Description Allows admin, cashier, and waiter roles to replace the lines of an order that has not been served yet.
+// @Description The version the client last saw is required in the If-Match header (or the version field), so concurrent
+// @Description edits are not overwritten: when the order changed in the meantime the current order is returned with 409.
+// @Description Served orders can only be changed by voiding lines, closed ones by refunds.
 // @Tags order
 // @Param id path string true "Order ID"
-// @Param order body orderRequest true "Order update details"
+// @Param If-Match header string false "Order version the update is based on"
+// @Param order body updateOrderRequest true "Order update details"
 // @Security bearerToken
 // @Success 200 {object} map[string]interface{} "Order updated successfully"
 // @Failure 400  "Invalid request"
 // @Failure 404  "Order not found"
+// @Failure 409  "Order changed in the meantime, served or closed"
+// @Failure 428  "Order version required"
 // @Failure 500  "Internal Server Error"
 // @Router /order/{id} [patch]
 func UpdateOrder(client db.IMongoClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idParam := c.Param("id")
-		if idParam == "" {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid ID!",
 			})
 			return
 		}
 
-		id, _ := primitive.ObjectIDFromHex(idParam)
-		filter := bson.D{{Key: "_id", Value: id}}
-
-		var request orderRequest
+		var request updateOrderRequest
 
 		// Bind the request body to the order struct
 		if err := c.ShouldBindJSON(&request); err != nil {
@@ -527,7 +625,10 @@ func UpdateOrder(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
-		totalPrice := int64(0)
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		// Validate Items
 		for _, orderItem := range request.Items {
@@ -541,14 +642,21 @@ func UpdateOrder(client db.IMongoClient) gin.HandlerFunc {
 				})
 				return
 			}
-			totalPrice += orderItem.MenuItem.Price * int64(orderItem.Quantity)
 		}
 
-		update := bson.D{
-			{Key: "$set", Value: bson.D{
-				{Key: "items", Value: request.Items},
-				{Key: "total_price", Value: totalPrice},
-			}},
+		// The header wins over the body, as for any conditional request
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if version == nil {
+			version = request.Version
+		}
+		if version == nil {
+			c.JSON(http.StatusPreconditionRequired, gin.H{
+				"error": "The order version is required in the If-Match header or the version field",
+			})
+			return
 		}
 
 		// Get the collection from the database
@@ -557,27 +665,94 @@ func UpdateOrder(client db.IMongoClient) gin.HandlerFunc {
 		// Get context from the request
 		ctx := c.Request.Context()
 
-		// Updates the first document that has the specified "_id" value
-		result, err := collection.UpdateOne(ctx, filter, update)
+		// The order-level discount is kept and repriced with the new lines
+		order, ok := findOpenOrder(c, client, id)
+		if !ok {
+			return
+		}
+
+		if order.ServedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Served orders can only be changed by voiding lines"})
+			return
+		}
+
+		if *version != order.Version {
+			versionConflict(c, order)
+			return
+		}
+
+		rates, err := tax.LoadRates(ctx, client)
 		if err != nil {
 			utils.HandleMongoError(c, err)
 			return
 		}
 
-		// Check if a document was actually updated
-		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found."})
+		stripDiscounts(request.Items)
+		before := order.Items
+		order.Items = request.Items
+		if request.Service != "" {
+			order.Service = request.Service
+		}
+		priceOrder(&order, rates)
+
+		// Only an order nobody changed, served or closed since it was read is updated
+		filter := bson.D{
+			{Key: "_id", Value: id},
+			versionFilter(order.Version),
+			{Key: "served_at", Value: bson.M{"$exists": false}},
+			{Key: "closed_at", Value: bson.M{"$exists": false}},
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "items", Value: order.Items},
+				{Key: "discount", Value: order.Discount},
+				{Key: "gross_price", Value: order.GrossPrice},
+				{Key: "discount_total", Value: order.DiscountTotal},
+				{Key: "service", Value: order.Service},
+				{Key: "tax_inclusive", Value: order.TaxInclusive},
+				{Key: "taxes", Value: order.Taxes},
+				{Key: "tax_total", Value: order.TaxTotal},
+				{Key: "total_price", Value: order.TotalPrice},
+			}},
+			incVersion,
+		}
+
+		entry := ActorOf(c).Entry(order.ID, HistoryUpdated, bson.M{
+			"before":  before,
+			"after":   order.Items,
+			"changes": diffItems(before, order.Items),
+			"version": order.Version + 1,
+		})
+
+		saved, err := saveChange(ctx, client, &order, entry, sse.OrderUpdated, func(sc mongo.SessionContext) (bool, error) {
+			result, err := collection.UpdateOne(sc, filter, update)
+			if err != nil {
+				return false, err
+			}
+			return result.MatchedCount > 0, nil
+		})
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		if !saved {
+			conflictOrCurrent(c, client, id)
 			return
 		}
+
+		c.Header("ETag", etag(order.Version))
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Order updated succesfully",
+			"data":    order,
 		})
 	}
 }
 
 // GetStatistics calculates and serves order statistics for a given date range
 // @Summary Get statistics for a given date range.
-// @Description Fetches statistics for a specific date range.
+// @Description Fetches statistics for a specific date range, with gross revenue, discounts and net revenue,
+// @Description a breakdown of discounts by reason and of payments by tender, and service charges kept apart from revenue.
 // @Tags Statistics
 // @Security bearerToken
 // @Accept json
@@ -627,6 +802,34 @@ func GetStatistics(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
+		stats.Discounts, err = getDiscountStats(c, collection, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+			return
+		}
+
+		stats.Payments, err = getPaymentStats(
+			c,
+			client.GetCollection(config.Env.DatabaseName, "payments"),
+			from,
+			to,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+			return
+		}
+
+		stats.ServiceCharges, err = getServiceChargeStats(
+			c,
+			client.GetCollection(config.Env.DatabaseName, "sessions"),
+			from,
+			to,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+			return
+		}
+
 		// Return the stats in the response
 		c.JSON(http.StatusOK, gin.H{
 			"data": stats,
@@ -645,8 +848,6 @@ func GetStatistics(client db.IMongoClient) gin.HandlerFunc {
 // @Router /order/:tableID [get]
 func GetActiveOrdersByTableID(client db.IMongoClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var orders []Order
-
 		id := c.Param("tableID")
 		if id == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -663,62 +864,11 @@ func GetActiveOrdersByTableID(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
-		// Get the collection from the database
-		collection := client.GetCollection(config.Env.DatabaseName, "orders")
-
-		// Get context from the request
-		ctx := c.Request.Context()
-
-		// Build the query
-		query := bson.D{}
-
-		// Check for closed_at status
-		query = append(query, bson.E{Key: "closed_at", Value: bson.M{"$exists": false}})
-
-		// Match the table ID
-		query = append(query, bson.E{Key: "table_id", Value: docID})
-
-		// Find all documents that fits the query
-		cursor, err := collection.Find(ctx, query)
+		total, err := GetActiveTotal(c.Request.Context(), client, docID)
 		if err != nil {
 			utils.HandleMongoError(c, err)
 			return
 		}
-		defer cursor.Close(ctx)
-
-		// Decode the results into the order slice
-		if err := cursor.All(ctx, &orders); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to parse database response.",
-			})
-			return
-		}
-
-		var total OrderTotal
-		total.TableID = docID
-		total.Items = []OrderItem{}
-		total.TotalPrice = 0
-
-		itemIndexMap := make(map[primitive.ObjectID]int)
-
-		for _, order := range orders {
-			for _, item := range order.Items {
-				menuItemID := item.MenuItem.ID
-				if idx, exists := itemIndexMap[menuItemID]; exists {
-					total.Items[idx].Quantity += item.Quantity
-				} else {
-					total.Items = append(total.Items, item)
-					itemIndexMap[menuItemID] = len(total.Items) - 1
-				}
-			}
-		}
-
-		// Calculate total price
-		var totalPrice int64
-		for _, item := range total.Items {
-			totalPrice += item.MenuItem.Price * int64(item.Quantity)
-		}
-		total.TotalPrice = totalPrice
 
 		// Return the orders in the response
 		c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,193 @@
+package order
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+const (
+	HistoryCreated         = "created"
+	HistoryUpdated         = "updated"
+	HistoryServed          = "served"
+	HistoryReady           = "ready"
+	HistoryClosed          = "closed"
+	HistoryVoided          = "voided"
+	HistoryDiscounted      = "discounted"
+	HistoryDiscountRemoved = "discount_removed"
+	HistoryMoved           = "moved"
+	HistoryTransferredOut  = "transferred_out"
+	HistoryTransferredIn   = "transferred_in"
+	HistoryMerged          = "merged"
+)
+
+// HistoryEntry is an append-only record of a change made to an order.
+type HistoryEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"      json:"id"`
+	OrderID   primitive.ObjectID `bson:"order_id"           json:"orderId"`
+	Action    string             `bson:"action"             json:"action"`
+	ActorID   primitive.ObjectID `bson:"actor_id,omitempty" json:"actorId"` // empty for customers ordering at the table
+	IP        string             `bson:"ip,omitempty"       json:"ip,omitempty"`
+	Details   bson.M             `bson:"details,omitempty"  json:"details,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"         json:"createdAt"`
+}
+
+// Actor is who made a change and where the request came from.
+type Actor struct {
+	UserID primitive.ObjectID
+	IP     string
+}
+
+// ActorOf returns the authenticated user and client IP of a request. The
+// user is empty for requests without a token, such as customers ordering.
+func ActorOf(c *gin.Context) Actor {
+	actor := Actor{IP: c.ClientIP()}
+
+	claims, _ := c.Get("claims")
+	if jwtClaims, ok := claims.(jwt.MapClaims); ok {
+		userIDHex, _ := jwtClaims["UserID"].(string)
+		actor.UserID, _ = primitive.ObjectIDFromHex(userIDHex)
+	}
+	return actor
+}
+
+// Entry returns a history entry of a change made by the actor.
+func (a Actor) Entry(orderID primitive.ObjectID, action string, details bson.M) HistoryEntry {
+	return HistoryEntry{
+		OrderID: orderID,
+		Action:  action,
+		ActorID: a.UserID,
+		IP:      a.IP,
+		Details: details,
+	}
+}
+
+// LineChange is the quantity of an order line before and after an edit.
+type LineChange struct {
+	MenuItemID primitive.ObjectID `bson:"menu_item_id"        json:"menuItemId"`
+	Name       string             `bson:"name"                json:"name"`
+	Seat       uint8              `bson:"seat,omitempty"      json:"seat,omitempty"`
+	Modifiers  []string           `bson:"modifiers,omitempty" json:"modifiers,omitempty"`
+	Before     int                `bson:"before"              json:"before"`
+	After      int                `bson:"after"               json:"after"`
+}
+
+// diffItems returns the lines whose quantity differs between two versions of
+// an order, with lines of the same menu item, seat and modifiers combined.
+func diffItems(before, after []OrderItem) []LineChange {
+	type lineKey struct {
+		menuItemID primitive.ObjectID
+		seat       uint8
+		modifiers  string
+	}
+
+	var changes []LineChange
+	index := make(map[lineKey]int)
+
+	add := func(item OrderItem, before, after int) {
+		key := lineKey{item.MenuItem.ID, item.Seat, strings.Join(item.Modifiers, "\x00")}
+		i, ok := index[key]
+		if !ok {
+			i = len(changes)
+			index[key] = i
+			changes = append(changes, LineChange{
+				MenuItemID: item.MenuItem.ID,
+				Name:       item.MenuItem.Name,
+				Seat:       item.Seat,
+				Modifiers:  item.Modifiers,
+			})
+		}
+		changes[i].Before += before
+		changes[i].After += after
+	}
+
+	for _, item := range before {
+		add(item, int(item.Quantity), 0)
+	}
+	for _, item := range after {
+		add(item, 0, int(item.Quantity))
+	}
+
+	return slices.DeleteFunc(changes, func(change LineChange) bool {
+		return change.Before == change.After
+	})
+}
+
+// recordHistory appends entries to the order history. Pass the transaction's
+// session context to record them atomically with the change itself.
+func recordHistory(ctx context.Context, client db.IMongoClient, entries ...HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	collection := client.GetCollection(config.Env.DatabaseName, "order_history")
+
+	now := time.Now()
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = now
+		}
+		docs[i] = entry
+	}
+
+	_, err := collection.InsertMany(ctx, docs)
+	return err
+}
+
+// GetHistory returns the history of an order
+//
+// @Summary Get the history of an order
+// @Description Lists every recorded change of an order, oldest first: creation, edits with the lines before and after,
+// @Description serving, closing, voids, discounts, moves, transfers and merges, with who made them and from which IP.
+// @Tags order
+// @Produce json
+// @Param id path string true "Order ID"
+// @Security bearerToken
+// @Success 200 {array} HistoryEntry "History of the order"
+// @Failure 400 "Invalid ID"
+// @Failure 500 "Internal Server Error"
+// @Router /order/{id}/history [get]
+func GetHistory(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		cursor, err := client.GetCollection(config.Env.DatabaseName, "order_history").Find(
+			ctx,
+			bson.D{{Key: "order_id", Value: id}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+		)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		history := []HistoryEntry{}
+		if err := cursor.All(ctx, &history); err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": history})
+	}
+}
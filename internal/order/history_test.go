@@ -0,0 +1,136 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+)
+
+func TestDiffItems(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee"}
+	cake := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Cake"}
+	tea := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Tea"}
+
+	before := []OrderItem{
+		{MenuItem: coffee, Quantity: 1},
+		{MenuItem: coffee, Quantity: 1},
+		{MenuItem: coffee, Quantity: 1, Modifiers: []string{"oat milk"}},
+		{MenuItem: cake, Quantity: 1},
+	}
+	after := []OrderItem{
+		{MenuItem: coffee, Quantity: 1},
+		{MenuItem: coffee, Quantity: 2, Modifiers: []string{"oat milk"}},
+		{MenuItem: cake, Quantity: 1, Seat: 2},
+		{MenuItem: tea, Quantity: 1},
+	}
+
+	changes := diffItems(before, after)
+
+	assert.Equal(t, []LineChange{
+		// Lines of the same item, seat and modifiers are combined
+		{MenuItemID: coffee.ID, Name: "Coffee", Before: 2, After: 1},
+		{MenuItemID: coffee.ID, Name: "Coffee", Modifiers: []string{"oat milk"}, Before: 1, After: 2},
+		{MenuItemID: cake.ID, Name: "Cake", Before: 1, After: 0},
+		{MenuItemID: cake.ID, Name: "Cake", Seat: 2, Before: 0, After: 1},
+		{MenuItemID: tea.ID, Name: "Tea", Before: 0, After: 1},
+	}, changes)
+
+	assert.Empty(t, diffItems(before, before))
+}
+
+func TestRecordHistory(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("entries are timestamped", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		entry := Actor{UserID: primitive.NewObjectID(), IP: "10.0.0.7"}.Entry(primitive.NewObjectID(), HistoryServed, nil)
+
+		err := recordHistory(context.Background(), db.NewMockMongoClient(mt.Coll), entry, entry)
+
+		assert.NoError(t, err)
+		docs := mt.GetStartedEvent().Command.Lookup("documents").Array()
+		values, _ := docs.Values()
+		assert.Len(t, values, 2)
+		stored := docs.Index(0).Value().Document()
+		assert.Equal(t, HistoryServed, stored.Lookup("action").StringValue())
+		assert.Equal(t, "10.0.0.7", stored.Lookup("ip").StringValue())
+		assert.False(t, stored.Lookup("created_at").Time().IsZero())
+	})
+
+	mt.Run("nothing to record", func(mt *mtest.T) {
+		err := recordHistory(context.Background(), db.NewMockMongoClient(mt.Coll))
+
+		assert.NoError(t, err)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestGetHistory(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	orderID := primitive.NewObjectID()
+
+	get := func(mt *mtest.T, id string) *httptest.ResponseRecorder {
+		return serve("admin", http.MethodGet, "/order/:id/history", GetHistory(db.NewMockMongoClient(mt.Coll)), "/order/"+id+"/history", "", nil)
+	}
+
+	mt.Run("oldest first", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(
+			document(HistoryEntry{ID: primitive.NewObjectID(), OrderID: orderID, Action: HistoryCreated}),
+			document(HistoryEntry{ID: primitive.NewObjectID(), OrderID: orderID, Action: HistoryServed}),
+		))
+
+		w := get(mt, orderID.Hex())
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []HistoryEntry `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Data, 2)
+		assert.Equal(t, HistoryServed, response.Data[1].Action)
+
+		find := mt.GetStartedEvent().Command
+		assert.Equal(t, orderID, find.Lookup("filter", "order_id").ObjectID())
+		assert.Equal(t, int32(1), find.Lookup("sort", "created_at").Int32())
+	})
+
+	mt.Run("no history", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor())
+
+		w := get(mt, orderID.Hex())
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"data":[]}`, w.Body.String())
+	})
+
+	mt.Run("invalid ID", func(mt *mtest.T) {
+		w := get(mt, "latest")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestActorOf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.RemoteAddr = "10.0.0.7:5123"
+
+	// Customers ordering at the table have no token
+	assert.Equal(t, Actor{IP: "10.0.0.7"}, ActorOf(c))
+
+	userID := primitive.NewObjectID()
+	c.Set("claims", jwt.MapClaims{"UserID": userID.Hex(), "Role": "waiter"})
+	assert.Equal(t, userID, ActorOf(c).UserID)
+}
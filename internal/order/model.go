@@ -6,27 +6,99 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+	DiscountComp    = "comp" // makes the line or order free
+
+	ReasonStaffMeal = "staff_meal"
+	ReasonComplaint = "complaint"
+	ReasonPromo     = "promo"
+	ReasonOther     = "other"
 )
 
 type OrderItem struct {
-	MenuItem menu.MenuItem `bson:"menu_item" json:"menuItem"`
-	Quantity uint8         `bson:"quantity" json:"quantity" validate:"required,qt=0"`
+	MenuItem  menu.MenuItem `bson:"menu_item" json:"menuItem"`
+	Quantity  uint8         `bson:"quantity" json:"quantity" validate:"required,qt=0"`
+	Seat      uint8         `bson:"seat,omitempty" json:"seat,omitempty"`           // seat number at the table, 0 when shared
+	Modifiers []string      `bson:"modifiers,omitempty" json:"modifiers,omitempty"` // preparation notes, e.g. "oat milk"
+	Discount  *Discount     `bson:"discount,omitempty" json:"discount,omitempty"`
+	ReadyAt   *time.Time    `bson:"ready_at,omitempty" json:"readyAt,omitempty"` // when a station bumped the line as prepared
+}
+
+// Discount reduces the price of an order line or of a whole order. Value is
+// a percentage for percent discounts and an amount in minor units for fixed
+// ones. Amount is the resulting reduction in minor units.
+type Discount struct {
+	Type       string             `bson:"type"                  json:"type"`
+	Value      int64              `bson:"value,omitempty"       json:"value,omitempty"`
+	Reason     string             `bson:"reason"                json:"reason"`
+	Note       string             `bson:"note,omitempty"        json:"note,omitempty"`
+	Amount     int64              `bson:"amount"                json:"amount"`
+	AppliedBy  primitive.ObjectID `bson:"applied_by"            json:"appliedBy"`
+	ApprovedBy primitive.ObjectID `bson:"approved_by,omitempty" json:"approvedBy,omitempty"` // set when above the approval threshold
+	AppliedAt  time.Time          `bson:"applied_at"            json:"appliedAt"`
 }
 
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"       json:"id"`
-	Items      []OrderItem        `bson:"items"               json:"items"       validate:"required"`
-	TotalPrice int64              `bson:"total_price"          json:"totalPrice"`
-	TableID    primitive.ObjectID `bson:"table_id"         json:"tableId"`
-	ServedAt   *time.Time         `bson:"served_at,omitempty"  json:"servedAt"`
-	CreatedAt  time.Time          `bson:"created_at"           json:"createdAt"`
-	HandledBy  primitive.ObjectID `bson:"handled_by,omitempty" json:"handledBy"`
-	ClosedAt   *time.Time         `bson:"closed_at,omitempty"  json:"closedAt"`
-	ClosedBy   primitive.ObjectID `bson:"closed_by,omitempty"  json:"closedBy"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"       json:"id"`
+	Items         []OrderItem        `bson:"items"               json:"items"       validate:"required"`
+	GrossPrice    int64              `bson:"gross_price"          json:"grossPrice"`         // before discounts
+	Discount      *Discount          `bson:"discount,omitempty"   json:"discount,omitempty"` // order-level discount
+	DiscountTotal int64              `bson:"discount_total"       json:"discountTotal"`      // line and order discounts
+	Service       string             `bson:"service,omitempty"    json:"service"`            // eat_in or takeaway
+	TaxInclusive  bool               `bson:"tax_inclusive"        json:"taxInclusive"`       // whether prices included tax when priced
+	Taxes         []tax.TaxLine      `bson:"taxes,omitempty"      json:"taxes"`              // tax breakdown per rate
+	TaxTotal      int64              `bson:"tax_total"            json:"taxTotal"`
+	TotalPrice    int64              `bson:"total_price"          json:"totalPrice"` // amount due
+	TableID       primitive.ObjectID `bson:"table_id"         json:"tableId"`
+	SessionID     primitive.ObjectID `bson:"session_id,omitempty" json:"sessionId"`
+	ServedAt      *time.Time         `bson:"served_at,omitempty"  json:"servedAt"`
+	CreatedAt     time.Time          `bson:"created_at"           json:"createdAt"`
+	HandledBy     primitive.ObjectID `bson:"handled_by,omitempty" json:"handledBy"`
+	ClosedAt      *time.Time         `bson:"closed_at,omitempty"  json:"closedAt"`
+	ClosedBy      primitive.ObjectID `bson:"closed_by,omitempty"  json:"closedBy"`
+	Voids         []Void             `bson:"voids,omitempty"      json:"voids,omitempty"`    // lines taken off after serving
+	Refunded      int64              `bson:"refunded,omitempty"   json:"refunded,omitempty"` // refunded so far, positive
+	Version       int64              `bson:"version"              json:"version"`            // incremented on every change, sent back in If-Match
+}
+
+// Void records lines taken off an order after it was served, e.g. a dish
+// sent back to the kitchen.
+type Void struct {
+	Item       OrderItem          `bson:"item"                  json:"item"`
+	Reason     string             `bson:"reason"                json:"reason"`
+	VoidedBy   primitive.ObjectID `bson:"voided_by"             json:"voidedBy"`
+	ApprovedBy primitive.ObjectID `bson:"approved_by,omitempty" json:"approvedBy,omitempty"`
+	VoidedAt   time.Time          `bson:"voided_at"             json:"voidedAt"`
 }
 
 type OrderTotal struct {
-	TableID    primitive.ObjectID `bson:"table_id" json:"tableId"`
-	Items      []OrderItem        `bson:"items" json:"items"`
-	TotalPrice int64              `bson:"total_price" json:"totalPrice"`
+	TableID       primitive.ObjectID     `bson:"table_id" json:"tableId"`
+	SessionID     primitive.ObjectID     `bson:"session_id,omitempty" json:"sessionId"`
+	OrderIDs      []primitive.ObjectID   `bson:"order_ids" json:"orderIds"`
+	Items         []OrderItem            `bson:"items" json:"items"`
+	GrossPrice    int64                  `bson:"gross_price" json:"grossPrice"`
+	DiscountTotal int64                  `bson:"discount_total" json:"discountTotal"`
+	OrderDiscount int64                  `bson:"order_discount" json:"orderDiscount"` // order-level discounts, not tied to lines
+	TaxTotal      int64                  `bson:"tax_total" json:"taxTotal"`
+	TaxAdded      int64                  `bson:"tax_added" json:"taxAdded"` // tax added on top of tax-exclusive prices, not tied to lines
+	ServiceCharge *session.ServiceCharge `bson:"service_charge,omitempty" json:"serviceCharge,omitempty"`
+	TotalPrice    int64                  `bson:"total_price" json:"totalPrice"` // including the service charge
+	AllServed     bool                   `bson:"all_served" json:"allServed"`
+}
+
+// Balance is what a table session owes and has paid so far, in minor units.
+type Balance struct {
+	SessionID     primitive.ObjectID     `json:"sessionId"`
+	Currency      string                 `json:"currency"`
+	Total         int64                  `json:"total"`  // all orders of the session and the service charge
+	Served        int64                  `json:"served"` // orders that have been served and their share of the service charge
+	ServiceCharge *session.ServiceCharge `json:"serviceCharge,omitempty"`
+	Paid          int64                  `json:"paid"`
+	Outstanding   int64                  `json:"outstanding"` // total minus paid
 }
@@ -7,20 +7,57 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
 )
 
 type AggregatedStat struct {
 	GroupKey          string  `bson:"group_key" json:"groupKey"` // Will be day/week/month as a string
 	TotalOrders       int     `bson:"total_orders" json:"totalOrders"`
-	TotalRevenue      float64 `bson:"total_revenue" json:"totalRevenue"`
+	GrossRevenue      float64 `bson:"gross_revenue" json:"grossRevenue"` // before discounts
+	TotalDiscounts    float64 `bson:"total_discounts" json:"totalDiscounts"`
+	TotalRevenue      float64 `bson:"total_revenue" json:"totalRevenue"` // net of discounts and refunds
 	AverageOrderValue float64 `bson:"average_order_value" json:"averageOrderValue"`
+	TotalRefunds      float64 `bson:"total_refunds" json:"totalRefunds"` // negative, already included in revenue
 }
 
 type Stats struct {
 	TotalOrders int `json:"totalOrders"`
+	GrossRevenue int `json:"grossRevenue"`
+	TotalDiscounts int `json:"totalDiscounts"`
 	TotalRevenue int `json:"totalRevenue"`
 	AverageOrderValue int `json:"averageOrderValue"`
+	TotalRefunds int `json:"totalRefunds"`
 	AggregatedStats []AggregatedStat `json:"aggregatedStats"`
+	Payments []TenderStat `json:"payments"`
+	Discounts []DiscountStat `json:"discounts"`
+	ServiceCharges ServiceChargeStat `json:"serviceCharges"` // not part of revenue
+}
+
+// ServiceChargeStat sums the service charges of sessions closed in a period.
+type ServiceChargeStat struct {
+	Sessions int   `bson:"sessions" json:"sessions"` // sessions charged
+	Amount   int64 `bson:"amount"   json:"amount"`
+	Tax      int64 `bson:"tax"      json:"tax"`
+	Total    int64 `bson:"total"    json:"total"`   // amount plus tax added on top
+	Removed  int   `bson:"removed"  json:"removed"` // sessions a manager took the charge off
+}
+
+// DiscountStat sums the discounts and comps given for one reason.
+type DiscountStat struct {
+	Reason    string `bson:"_id"       json:"reason"`
+	Discounts int    `bson:"discounts" json:"discounts"`
+	Comps     int    `bson:"comps"     json:"comps"`
+	Amount    int64  `bson:"amount"    json:"amount"`
+}
+
+// TenderStat is the breakdown of payments taken with one tender type.
+type TenderStat struct {
+	Tender   string `bson:"_id"      json:"tender"`
+	Payments int    `bson:"payments" json:"payments"`
+	Amount   int64  `bson:"amount"   json:"amount"`
+	Change   int64  `bson:"change"   json:"change"`
+	Refunded int64  `bson:"refunded" json:"refunded"` // negative, already included in amount
 }
 
 func getStats(
@@ -78,33 +115,70 @@ func getStats(
 		return Stats{}, fmt.Errorf("unsupported groupBy value: %s", groupBy)
 	}
 
+	// Refunds are merged in as negative revenue entries dated when they
+	// were made
+	refundEntries := bson.M{
+		"coll": "refunds",
+		"pipeline": []bson.M{
+			{"$match": bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}},
+			{"$project": bson.M{
+				"created_at":     1,
+				"total_price":    "$amount",
+				"gross_price":    bson.M{"$literal": 0},
+				"discount_total": bson.M{"$literal": 0},
+				"refund":         bson.M{"$literal": true},
+			}},
+		},
+	}
+	orderValue := bson.M{"$cond": []interface{}{"$refund", nil, "$total_price"}}
+	refundValue := bson.M{"$cond": []interface{}{"$refund", "$total_price", 0}}
+	isOrder := bson.M{"$cond": []interface{}{"$refund", 0, 1}}
+
 	// Define the facet stage with two pipelines
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: matchFilter}},
+		{{Key: "$project", Value: bson.M{
+			"created_at":  1,
+			"total_price": 1,
+			// Orders placed before discounts existed only have a total price
+			"gross_price":    bson.M{"$ifNull": []interface{}{"$gross_price", "$total_price"}},
+			"discount_total": bson.M{"$ifNull": []interface{}{"$discount_total", 0}},
+			"refund":         bson.M{"$literal": false},
+		}}},
+		{{Key: "$unionWith", Value: refundEntries}},
 		{{
 			Key: "$facet", Value: bson.M{
 				"grouped": []bson.M{
 					{"$group": bson.M{
 						"_id":                 groupID,
-						"total_orders":        bson.M{"$sum": 1},
+						"total_orders":        bson.M{"$sum": isOrder},
+						"gross_revenue":       bson.M{"$sum": "$gross_price"},
+						"total_discounts":     bson.M{"$sum": "$discount_total"},
 						"total_revenue":       bson.M{"$sum": "$total_price"},
-						"average_order_value": bson.M{"$avg": "$total_price"},
+						"average_order_value": bson.M{"$avg": orderValue},
+						"total_refunds":       bson.M{"$sum": refundValue},
 						"created_at":          bson.M{"$first": "$created_at"},
 					}},
 					{"$project": bson.M{
 						"group_key":           groupKeyExpr,
 						"total_orders":        1,
+						"gross_revenue":       1,
+						"total_discounts":     1,
 						"total_revenue":       1,
 						"average_order_value": 1,
+						"total_refunds":       1,
 					}},
 					{"$sort": bson.M{"group_key": 1}},
 				},
 				"overall": []bson.M{
 					{"$group": bson.M{
 						"_id":                 nil,
-						"total_orders":        bson.M{"$sum": 1},
+						"total_orders":        bson.M{"$sum": isOrder},
+						"gross_revenue":       bson.M{"$sum": "$gross_price"},
+						"total_discounts":     bson.M{"$sum": "$discount_total"},
 						"total_revenue":       bson.M{"$sum": "$total_price"},
-						"average_order_value": bson.M{"$avg": "$total_price"},
+						"average_order_value": bson.M{"$avg": orderValue},
+						"total_refunds":       bson.M{"$sum": refundValue},
 					}},
 				},
 			},
@@ -121,8 +195,11 @@ func getStats(
 		Grouped []AggregatedStat `bson:"grouped"`
 		Overall []struct {
 			TotalOrders       int     `bson:"total_orders"`
+			GrossRevenue      float64 `bson:"gross_revenue"`
+			TotalDiscounts    float64 `bson:"total_discounts"`
 			TotalRevenue      float64 `bson:"total_revenue"`
 			AverageOrderValue float64 `bson:"average_order_value"`
+			TotalRefunds      float64 `bson:"total_refunds"`
 		} `bson:"overall"`
 	}
 
@@ -134,11 +211,159 @@ func getStats(
 	if len(facetResult) > 0 {
 		if len(facetResult[0].Overall) > 0 {
 			finalStats.TotalOrders = facetResult[0].Overall[0].TotalOrders
+			finalStats.GrossRevenue = int(facetResult[0].Overall[0].GrossRevenue)
+			finalStats.TotalDiscounts = int(facetResult[0].Overall[0].TotalDiscounts)
 			finalStats.TotalRevenue = int(facetResult[0].Overall[0].TotalRevenue)
 			finalStats.AverageOrderValue = int(facetResult[0].Overall[0].AverageOrderValue)
+			finalStats.TotalRefunds = int(facetResult[0].Overall[0].TotalRefunds)
 		}
 		finalStats.AggregatedStats = facetResult[0].Grouped
 	}
 
 	return finalStats, nil
 }
+
+// getPaymentStats breaks down the payments taken in the date range by
+// tender type, net of refunds paid out with each tender.
+func getPaymentStats(
+	ctx context.Context,
+	collection *mongo.Collection,
+	from time.Time,
+	to time.Time,
+) ([]TenderStat, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"created_at": bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$unionWith", Value: bson.M{
+			"coll": "refunds",
+			"pipeline": []bson.M{
+				{"$match": bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}},
+				{"$project": bson.M{
+					"tender": 1,
+					"amount": 1,
+					"refund": bson.M{"$literal": true},
+				}},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$tender",
+			"payments": bson.M{"$sum": bson.M{"$cond": []interface{}{"$refund", 0, 1}}},
+			"amount":   bson.M{"$sum": "$amount"},
+			"change":   bson.M{"$sum": "$change"},
+			"refunded": bson.M{"$sum": bson.M{"$cond": []interface{}{"$refund", "$amount", 0}}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"amount": -1}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tenders := []TenderStat{}
+	if err := cursor.All(ctx, &tenders); err != nil {
+		return nil, err
+	}
+
+	return tenders, nil
+}
+
+// getDiscountStats sums the line and order-level discounts of the orders
+// closed in the date range by reason.
+func getDiscountStats(
+	ctx context.Context,
+	collection *mongo.Collection,
+	from time.Time,
+	to time.Time,
+) ([]DiscountStat, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"created_at":     bson.M{"$gte": from, "$lt": to},
+			"closed_at":      bson.M{"$exists": true},
+			"discount_total": bson.M{"$gt": 0},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"discounts": bson.M{"$concatArrays": []interface{}{
+				bson.M{"$map": bson.M{
+					"input": bson.M{"$filter": bson.M{
+						"input": "$items",
+						"cond":  bson.M{"$gt": []interface{}{"$$this.discount", nil}},
+					}},
+					"in": "$$this.discount",
+				}},
+				bson.M{"$cond": []interface{}{
+					bson.M{"$gt": []interface{}{"$discount", nil}},
+					[]interface{}{"$discount"},
+					[]interface{}{},
+				}},
+			}},
+		}}},
+		{{Key: "$unwind", Value: "$discounts"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$discounts.reason",
+			"discounts": bson.M{"$sum": 1},
+			"comps": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$eq": []interface{}{"$discounts.type", DiscountComp}}, 1, 0,
+			}}},
+			"amount": bson.M{"$sum": "$discounts.amount"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"amount": -1}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	discounts := []DiscountStat{}
+	if err := cursor.All(ctx, &discounts); err != nil {
+		return nil, err
+	}
+
+	return discounts, nil
+}
+
+// getServiceChargeStats sums the service charges recorded on the sessions
+// closed in the date range.
+// Needs sessions collection
+func getServiceChargeStats(
+	ctx context.Context,
+	collection *mongo.Collection,
+	from time.Time,
+	to time.Time,
+) (ServiceChargeStat, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status":    session.StatusClosed,
+			"closed_at": bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"sessions": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$service_charge", nil}}, 1, 0,
+			}}},
+			"amount": bson.M{"$sum": "$service_charge.amount"},
+			"tax":    bson.M{"$sum": "$service_charge.tax_total"},
+			"total":  bson.M{"$sum": "$service_charge.total"},
+			"removed": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$service_charge_removal", nil}}, 1, 0,
+			}}},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ServiceChargeStat{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []ServiceChargeStat
+	if err := cursor.All(ctx, &results); err != nil || len(results) == 0 {
+		return ServiceChargeStat{}, err
+	}
+
+	return results[0], nil
+}
@@ -0,0 +1,528 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+type moveRequest struct {
+	FromTableID string `json:"fromTableId" validate:"required"`
+	ToTableID   string `json:"toTableId"   validate:"required"`
+}
+
+type transferItem struct {
+	MenuItemID string `json:"menuItemId" validate:"required"`
+	Quantity   uint8  `json:"quantity"   validate:"required,gt=0"`
+}
+
+type transferRequest struct {
+	OrderID   string         `json:"orderId"   validate:"required"`
+	ToTableID string         `json:"toTableId" validate:"required"`
+	Items     []transferItem `json:"items"     validate:"required,min=1,dive"`
+}
+
+type mergeRequest struct {
+	SourceTableID string `json:"sourceTableId" validate:"required"`
+	TargetTableID string `json:"targetTableId" validate:"required"`
+}
+
+// MoveTable moves a party and all of its open orders to another table
+//
+// @Summary Move a table
+// @Description Moves the open session of a table and all of its open orders to a free table in a single transaction
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param move body moveRequest true "Source and target tables"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Table moved successfully"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Table or session not found"
+// @Failure 409  "Target table is occupied"
+// @Failure 500  "Internal Server Error"
+// @Router /order/move [patch]
+func MoveTable(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request moveRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		fromID, toID, ok := parseTablePair(c, request.FromTableID, request.ToTableID)
+		if !ok {
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		var moved []primitive.ObjectID
+
+		err := db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			source, err := session.FindOpen(sc, client, fromID)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return &requestError{http.StatusNotFound, "Source table has no open session"}
+				}
+				return err
+			}
+
+			if err := checkTableExists(sc, client, toID); err != nil {
+				return err
+			}
+
+			if _, err := session.FindOpen(sc, client, toID); err != mongo.ErrNoDocuments {
+				if err == nil {
+					return &requestError{
+						http.StatusConflict,
+						"Target table is occupied, merge the tables instead",
+					}
+				}
+				return err
+			}
+
+			if err := session.MoveToTable(sc, client, source.ID, toID); err != nil {
+				return err
+			}
+
+			moved, err = reassignOpenOrders(sc, client, source.ID, toID, source.ID)
+			if err != nil {
+				return err
+			}
+
+			entries := make([]HistoryEntry, len(moved))
+			for i, orderID := range moved {
+				entries[i] = HistoryEntry{
+					OrderID: orderID,
+					Action:  HistoryMoved,
+					ActorID: userID,
+					IP:      c.ClientIP(),
+					Details: bson.M{"from_table_id": fromID, "to_table_id": toID},
+				}
+			}
+			if err := recordHistory(sc, client, entries...); err != nil {
+				return err
+			}
+
+			return publishMove(sc, client, fromID, toID,
+				gin.H{"fromTableId": fromID, "toTableId": toID, "orderIds": moved},
+				sse.TableStatusEvent(fromID.Hex(), "", sse.StatusFree),
+				sse.TableStatusEvent(toID.Hex(), "", sse.StatusOccupied),
+			)
+		})
+		if err != nil {
+			handleTransactionError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Table moved successfully",
+			"orders":  moved,
+		})
+	}
+}
+
+// TransferItems transfers order lines to another table
+//
+// @Summary Transfer order lines between tables
+// @Description Moves the given quantities of an open order's lines into a new order on another table in a single transaction
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param transfer body transferRequest true "Order, target table and lines to transfer"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Items transferred successfully"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Order or table not found"
+// @Failure 500  "Internal Server Error"
+// @Router /order/transfer [patch]
+func TransferItems(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request transferRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderID, err := primitive.ObjectIDFromHex(request.OrderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Order ID"})
+			return
+		}
+
+		toID, err := primitive.ObjectIDFromHex(request.ToTableID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+			return
+		}
+
+		quantities := make(map[primitive.ObjectID]int)
+		for _, item := range request.Items {
+			menuItemID, err := primitive.ObjectIDFromHex(item.MenuItemID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Menu Item ID"})
+				return
+			}
+			quantities[menuItemID] += int(item.Quantity)
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "orders")
+
+		var source Order
+		var newOrderID primitive.ObjectID
+
+		err = db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			err := collection.FindOne(sc, bson.D{
+				{Key: "_id", Value: orderID},
+				{Key: "closed_at", Value: bson.M{"$exists": false}},
+			}).Decode(&source)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return &requestError{http.StatusNotFound, "Order not found or already closed"}
+				}
+				return err
+			}
+
+			if source.TableID == toID {
+				return &requestError{http.StatusBadRequest, "Order is already on the target table"}
+			}
+
+			if err := checkTableExists(sc, client, toID); err != nil {
+				return err
+			}
+
+			remaining, transferred, ok := splitItems(source.Items, quantities)
+			if !ok {
+				return &requestError{
+					http.StatusBadRequest,
+					"Order does not contain the requested item quantities",
+				}
+			}
+
+			target, opened, err := session.GetOrOpen(sc, client, toID)
+			if err != nil {
+				return err
+			}
+
+			var events []sse.Event
+			if opened {
+				events = append(events, sse.TableStatusEvent(toID.Hex(), target.ID.Hex(), sse.StatusOccupied))
+			}
+
+			// Transferring every line moves the order itself
+			if len(remaining) == 0 {
+				newOrderID = source.ID
+				_, err := collection.UpdateByID(sc, source.ID, bson.D{{Key: "$set", Value: bson.D{
+					{Key: "table_id", Value: toID},
+					{Key: "session_id", Value: target.ID},
+				}}, incVersion})
+				if err != nil {
+					return err
+				}
+
+				err = recordHistory(sc, client, HistoryEntry{
+					OrderID: source.ID,
+					Action:  HistoryMoved,
+					ActorID: userID,
+					IP:      c.ClientIP(),
+					Details: bson.M{"from_table_id": source.TableID, "to_table_id": toID},
+				})
+				if err != nil {
+					return err
+				}
+				return publishTransfer(sc, client, source, toID, newOrderID, events...)
+			}
+
+			// The order-level discount stays with the lines left on the source order
+			rates, err := tax.LoadRates(sc, client)
+			if err != nil {
+				return err
+			}
+
+			source.Items = remaining
+			priceOrder(&source, rates)
+
+			_, err = collection.UpdateByID(sc, source.ID, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "items", Value: source.Items},
+				{Key: "discount", Value: source.Discount},
+				{Key: "gross_price", Value: source.GrossPrice},
+				{Key: "discount_total", Value: source.DiscountTotal},
+				{Key: "tax_inclusive", Value: source.TaxInclusive},
+				{Key: "taxes", Value: source.Taxes},
+				{Key: "tax_total", Value: source.TaxTotal},
+				{Key: "total_price", Value: source.TotalPrice},
+			}}, incVersion})
+			if err != nil {
+				return err
+			}
+
+			// The new order keeps the timing of the original so statistics stay accurate
+			newOrder := Order{
+				Items:     transferred,
+				TableID:   toID,
+				SessionID: target.ID,
+				ServedAt:  source.ServedAt,
+				CreatedAt: source.CreatedAt,
+				HandledBy: source.HandledBy,
+				Service:   source.Service,
+				Version:   1,
+			}
+			priceOrder(&newOrder, rates)
+
+			result, err := collection.InsertOne(sc, newOrder)
+			if err != nil {
+				return err
+			}
+			newOrderID = result.InsertedID.(primitive.ObjectID)
+
+			err = recordHistory(
+				sc,
+				client,
+				HistoryEntry{
+					OrderID: source.ID,
+					Action:  HistoryTransferredOut,
+					ActorID: userID,
+					IP:      c.ClientIP(),
+					Details: bson.M{
+						"to_table_id": toID,
+						"to_order_id": newOrderID,
+						"items":       transferred,
+					},
+				},
+				HistoryEntry{
+					OrderID: newOrderID,
+					Action:  HistoryTransferredIn,
+					ActorID: userID,
+					IP:      c.ClientIP(),
+					Details: bson.M{
+						"from_table_id": source.TableID,
+						"from_order_id": source.ID,
+						"items":         transferred,
+					},
+				},
+			)
+			if err != nil {
+				return err
+			}
+
+			return publishTransfer(sc, client, source, toID, newOrderID, events...)
+		})
+		if err != nil {
+			handleTransactionError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Items transferred successfully",
+			"id":      newOrderID,
+		})
+	}
+}
+
+// MergeTables merges two tables into one bill
+//
+// @Summary Merge two tables
+// @Description Moves the open orders and guests of the source table's session into the target table's session in a single transaction
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param merge body mergeRequest true "Source and target tables"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Tables merged successfully"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Table or session not found"
+// @Failure 500  "Internal Server Error"
+// @Router /order/merge [patch]
+func MergeTables(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request mergeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sourceID, targetID, ok := parseTablePair(c, request.SourceTableID, request.TargetTableID)
+		if !ok {
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		var merged []primitive.ObjectID
+
+		err := db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			source, err := session.FindOpen(sc, client, sourceID)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return &requestError{http.StatusNotFound, "Source table has no open session"}
+				}
+				return err
+			}
+
+			target, err := session.FindOpen(sc, client, targetID)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return &requestError{http.StatusNotFound, "Target table has no open session"}
+				}
+				return err
+			}
+
+			merged, err = reassignOpenOrders(sc, client, source.ID, targetID, target.ID)
+			if err != nil {
+				return err
+			}
+
+			if err := session.MergeInto(sc, client, source, target, userID); err != nil {
+				return err
+			}
+
+			entries := make([]HistoryEntry, len(merged))
+			for i, orderID := range merged {
+				entries[i] = HistoryEntry{
+					OrderID: orderID,
+					Action:  HistoryMerged,
+					ActorID: userID,
+					IP:      c.ClientIP(),
+					Details: bson.M{
+						"from_table_id":   sourceID,
+						"to_table_id":     targetID,
+						"from_session_id": source.ID,
+						"to_session_id":   target.ID,
+					},
+				}
+			}
+			if err := recordHistory(sc, client, entries...); err != nil {
+				return err
+			}
+
+			return publishMove(sc, client, sourceID, targetID,
+				gin.H{"fromTableId": sourceID, "toTableId": targetID, "orderIds": merged},
+				sse.TableStatusEvent(sourceID.Hex(), "", sse.StatusFree),
+			)
+		})
+		if err != nil {
+			handleTransactionError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Tables merged successfully",
+			"orders":  merged,
+		})
+	}
+}
+
+// publishMove tells subscribers of both tables about orders moving from one
+// to the other, followed by any other events of the move, through the outbox
+// of the transaction moving them.
+func publishMove(
+	ctx context.Context,
+	client db.IMongoClient,
+	fromID, toID primitive.ObjectID,
+	data gin.H,
+	events ...sse.Event,
+) error {
+	events = append([]sse.Event{
+		{Type: sse.OrderMoved, TableID: fromID.Hex(), Data: data},
+		{Type: sse.OrderMoved, TableID: toID.Hex(), Data: data},
+	}, events...)
+
+	for _, event := range events {
+		if err := outbox.Publish(ctx, client, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishTransfer publishes the move of lines of an order to another table,
+// followed by the other events.
+func publishTransfer(
+	ctx context.Context,
+	client db.IMongoClient,
+	source Order,
+	toID, newOrderID primitive.ObjectID,
+	events ...sse.Event,
+) error {
+	return publishMove(ctx, client, source.TableID, toID, gin.H{
+		"fromTableId": source.TableID,
+		"toTableId":   toID,
+		"orderId":     source.ID,
+		"newOrderId":  newOrderID,
+	}, events...)
+}
+
+// requestError aborts a transaction with a response for the client.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// handleTransactionError writes the response for an error returned from a
+// transaction, falling back to the generic database error handling.
+func handleTransactionError(c *gin.Context, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		c.JSON(reqErr.status, gin.H{"error": reqErr.message})
+		return
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Target table is occupied"})
+		return
+	}
+	utils.HandleMongoError(c, err)
+}
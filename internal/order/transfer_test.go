@@ -0,0 +1,83 @@
+package order
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+)
+
+func TestSplitItems(t *testing.T) {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee", Price: 400}
+	cake := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Cake", Price: 600}
+	items := []OrderItem{
+		{MenuItem: coffee, Quantity: 3, Discount: &Discount{Type: DiscountFixed, Value: 300, Amount: 300}},
+		{MenuItem: cake, Quantity: 1},
+	}
+
+	t.Run("part of a line", func(t *testing.T) {
+		remaining, taken, ok := splitItems(items, map[primitive.ObjectID]int{coffee.ID: 1})
+
+		assert.True(t, ok)
+		assert.Len(t, taken, 1)
+		assert.Equal(t, uint8(1), taken[0].Quantity)
+		assert.Equal(t, int64(100), taken[0].Discount.Amount)
+		assert.Len(t, remaining, 2)
+		assert.Equal(t, uint8(2), remaining[0].Quantity)
+		assert.Equal(t, int64(200), remaining[0].Discount.Amount)
+		// The original lines are left untouched
+		assert.Equal(t, int64(300), items[0].Discount.Amount)
+	})
+
+	t.Run("whole lines", func(t *testing.T) {
+		remaining, taken, ok := splitItems(items, map[primitive.ObjectID]int{coffee.ID: 3, cake.ID: 1})
+
+		assert.True(t, ok)
+		assert.Empty(t, remaining)
+		assert.Len(t, taken, 2)
+	})
+
+	t.Run("more than ordered", func(t *testing.T) {
+		_, _, ok := splitItems(items, map[primitive.ObjectID]int{cake.ID: 2})
+
+		assert.False(t, ok)
+	})
+
+	t.Run("item not on the order", func(t *testing.T) {
+		_, _, ok := splitItems(items, map[primitive.ObjectID]int{primitive.NewObjectID(): 1})
+
+		assert.False(t, ok)
+	})
+}
+
+func TestHandleTransactionError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"request error", &requestError{http.StatusNotFound, "Source table has no open session"}, http.StatusNotFound},
+		{"occupied table", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, http.StatusConflict},
+		{"database error", errors.New("connection reset"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			handleTransactionError(c, tt.err)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -1,20 +1,34 @@
 package order
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/kerimcanbalkan/cafe-orderAPI/config"
-	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
-	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
-func validateOrder(v *validator.Validate, order orderRequest) error {
+func validateOrder(v *validator.Validate, request interface{}) error {
 	// Perform validation
-	if err := v.Struct(order); err != nil {
+	if err := v.Struct(request); err != nil {
 
 		if _, ok := err.(*validator.InvalidValidationError); ok {
 			fmt.Println(err)
@@ -26,6 +40,16 @@ func validateOrder(v *validator.Validate, order orderRequest) error {
 			switch fieldErr.Tag() {
 			case "required":
 				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "min":
+				return fmt.Errorf("%s must have at least %s entries", fieldErr.Field(), fieldErr.Param())
+			case "gt":
+				return fmt.Errorf("%s must be greater than %s", fieldErr.Field(), fieldErr.Param())
+			case "gte":
+				return fmt.Errorf("%s must be at least %s", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				return fmt.Errorf("%s must be at most %s characters", fieldErr.Field(), fieldErr.Param())
+			case "oneof":
+				return fmt.Errorf("%s must be one of [%s]", fieldErr.Field(), fieldErr.Param())
 			default:
 				return fmt.Errorf("%s is invalid", fieldErr.Field())
 			}
@@ -34,20 +58,577 @@ func validateOrder(v *validator.Validate, order orderRequest) error {
 	return nil
 }
 
-func checkTable(tableID primitive.ObjectID, c *gin.Context, client db.IMongoClient) (bool, error) {
-	collection := client.GetCollection(config.Env.DatabaseName, "tables")
-	ctx := c.Request.Context()
+// ErrNotServed is returned when a session has open orders but none of them
+// have been served yet.
+var ErrNotServed = errors.New("order not found or must be served first")
 
-	result := collection.FindOne(ctx, bson.D{{Key: "_id", Value: tableID}})
+// errUnpaid is returned when closing orders that are not paid for.
+var errUnpaid = errors.New("payments do not cover the balance")
 
-	var table table.Table
-	err := result.Decode(&table)
+// errNotOnMenu is returned when an order line's item is not on the menu.
+var errNotOnMenu = errors.New("order includes items that are not on the menu")
+
+// loadMenuItems replaces the menu items of the lines with those on the menu,
+// so their prices, currencies and tax categories never come from the client.
+// It returns errNotOnMenu when an item is not on the menu.
+func loadMenuItems(ctx context.Context, client db.IMongoClient, items []OrderItem) error {
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		if !slices.Contains(ids, item.MenuItem.ID) {
+			ids = append(ids, item.MenuItem.ID)
+		}
+	}
+
+	cursor, err := client.GetCollection(config.Env.DatabaseName, "menu").
+		Find(ctx, bson.D{{Key: "_id", Value: bson.M{"$in": ids}}})
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
+		return err
+	}
+	var menuItems []menu.MenuItem
+	if err := cursor.All(ctx, &menuItems); err != nil {
+		return err
+	}
+
+	onMenu := make(map[primitive.ObjectID]menu.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		onMenu[menuItem.ID] = menuItem
+	}
+	for i := range items {
+		menuItem, ok := onMenu[items[i].MenuItem.ID]
+		if !ok {
+			return errNotOnMenu
 		}
+		items[i].MenuItem = menuItem
+	}
+	return nil
+}
+
+// CloseSessionOrders closes the served orders of a session. The session
+// itself is closed once none of its orders remain open, so a party that left
+// without ordering can be cleared as well. It reports whether the session
+// was closed.
+func CloseSessionOrders(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+	actor Actor,
+) (bool, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "orders")
+
+	// Filters by session and checks if its served
+	filter := bson.D{
+		{Key: "session_id", Value: sessionID},
+		{Key: "served_at", Value: bson.M{"$exists": true}},
+		{Key: "closed_at", Value: bson.M{"$exists": false}},
+	}
+
+	// The closed orders are looked up first to record them in their history
+	var served []Order
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return false, err
+	}
+	if err := cursor.All(ctx, &served); err != nil {
 		return false, err
 	}
 
+	ids := make([]primitive.ObjectID, len(served))
+	for i, order := range served {
+		ids[i] = order.ID
+	}
+	filter = append(filter, bson.E{Key: "_id", Value: bson.M{"$in": ids}})
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "closed_at", Value: time.Now()},
+			{Key: "closed_by", Value: actor.UserID},
+		}},
+		incVersion,
+	}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	entries := make([]HistoryEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = actor.Entry(id, HistoryClosed, bson.M{"session_id": sessionID})
+	}
+	if err := recordHistory(ctx, client, entries...); err != nil {
+		return false, err
+	}
+
+	remaining, err := collection.CountDocuments(ctx, bson.D{
+		{Key: "session_id", Value: sessionID},
+		{Key: "closed_at", Value: bson.M{"$exists": false}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Check if a document was actually updated
+	if result.MatchedCount == 0 && remaining > 0 {
+		return false, ErrNotServed
+	}
+
+	if result.ModifiedCount > 0 {
+		if err := outbox.Print(ctx, client, printer.Receipt(sessionID)...); err != nil {
+			return false, err
+		}
+	}
+
+	if remaining > 0 {
+		return false, nil
+	}
+
+	// The service charge is recorded on the session for reporting
+	balance, err := GetSessionBalance(ctx, client, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, session.Close(ctx, client, sessionID, actor.UserID, balance.ServiceCharge)
+}
+
+// closeSessionOrders closes the served orders of a session and writes the
+// response.
+func closeSessionOrders(
+	c *gin.Context,
+	client db.IMongoClient,
+	tableSession session.Session,
+	userID primitive.ObjectID,
+) {
+	actor := Actor{UserID: userID, IP: c.ClientIP()}
+
+	var balance Balance
+	var sessionClosed bool
+	err := db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+		// Tables paying separately are settled split by split
+		openBills, err := client.GetCollection(config.Env.DatabaseName, "bills").
+			CountDocuments(sc, bson.D{
+				{Key: "session_id", Value: tableSession.ID},
+				{Key: "status", Value: "open"},
+			})
+		if err != nil {
+			return err
+		}
+		if openBills > 0 {
+			return &requestError{http.StatusConflict, "Table has a split bill, close each split instead"}
+		}
+
+		// Served orders can only be closed once they are paid for
+		balance, err = GetSessionBalance(sc, client, tableSession.ID)
+		if err != nil {
+			return err
+		}
+		if balance.Paid < balance.Served {
+			return errUnpaid
+		}
+
+		sessionClosed, err = CloseSessionOrders(sc, client, tableSession.ID, actor)
+		if err != nil {
+			if err == ErrNotServed {
+				return &requestError{http.StatusNotFound, "Order not found or must be served first"}
+			}
+			return err
+		}
+
+		err = outbox.Publish(sc, client, sse.Event{
+			Type:    sse.OrderClosed,
+			TableID: tableSession.TableID.Hex(),
+			Data: gin.H{
+				"sessionId":     tableSession.ID,
+				"sessionClosed": sessionClosed,
+			},
+		})
+		if err != nil || !sessionClosed {
+			return err
+		}
+		return outbox.Publish(
+			sc,
+			client,
+			sse.TableStatusEvent(tableSession.TableID.Hex(), tableSession.ID.Hex(), sse.StatusFree),
+		)
+	})
+	if err == errUnpaid {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Payments do not cover the balance",
+			"outstanding": balance.Served - balance.Paid,
+			"currency":    balance.Currency,
+		})
+		return
+	}
+	if err != nil {
+		handleTransactionError(c, err)
+		return
+	}
+	outbox.Notify()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Order closed succesfully",
+		"sessionClosed": sessionClosed,
+	})
+}
+
+// splitItems takes the requested quantity of each menu item out of the order
+// lines. It returns the lines left on the order, the lines taken out and
+// false when the order does not contain enough of an item.
+func splitItems(
+	items []OrderItem,
+	quantities map[primitive.ObjectID]int,
+) ([]OrderItem, []OrderItem, bool) {
+	wanted := make(map[primitive.ObjectID]int, len(quantities))
+	for id, quantity := range quantities {
+		wanted[id] = quantity
+	}
+
+	remaining := []OrderItem{}
+	taken := []OrderItem{}
+
+	for _, item := range items {
+		take := min(wanted[item.MenuItem.ID], int(item.Quantity))
+		wanted[item.MenuItem.ID] -= take
+
+		if take > 0 {
+			taken = append(taken, item.Take(uint8(take)))
+		}
+		if int(item.Quantity) > take {
+			remaining = append(remaining, item.Take(item.Quantity-uint8(take)))
+		}
+	}
+
+	for _, left := range wanted {
+		if left > 0 {
+			return nil, nil, false
+		}
+	}
+
+	return remaining, taken, true
+}
+
+// parseTablePair parses the two distinct table IDs of a move or merge request,
+// writing the error response on failure.
+func parseTablePair(c *gin.Context, first, second string) (primitive.ObjectID, primitive.ObjectID, bool) {
+	firstID, err := primitive.ObjectIDFromHex(first)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	secondID, err := primitive.ObjectIDFromHex(second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	if firstID == secondID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and target tables must be different"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return firstID, secondID, true
+}
+
+// checkTableExists returns a not found request error unless the table exists.
+func checkTableExists(ctx context.Context, client db.IMongoClient, tableID primitive.ObjectID) error {
+	count, err := client.GetCollection(config.Env.DatabaseName, "tables").
+		CountDocuments(ctx, bson.D{{Key: "_id", Value: tableID}})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return &requestError{http.StatusNotFound, "Table not found"}
+	}
+	return nil
+}
+
+// reassignOpenOrders moves the open orders of a session to another table and
+// session and returns their IDs.
+func reassignOpenOrders(
+	ctx context.Context,
+	client db.IMongoClient,
+	fromSessionID primitive.ObjectID,
+	toTableID primitive.ObjectID,
+	toSessionID primitive.ObjectID,
+) ([]primitive.ObjectID, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "orders")
+
+	filter := bson.D{
+		{Key: "session_id", Value: fromSessionID},
+		{Key: "closed_at", Value: bson.M{"$exists": false}},
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	_, err = collection.UpdateMany(
+		ctx,
+		bson.D{{Key: "_id", Value: bson.M{"$in": ids}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "table_id", Value: toTableID},
+			{Key: "session_id", Value: toSessionID},
+		}}, incVersion},
+	)
+	return ids, err
+}
+
+// GetActiveTotal combines the active (not closed) orders of a table into a
+// single list of lines, merging quantities of the same menu item and seat.
+func GetActiveTotal(
+	ctx context.Context,
+	client db.IMongoClient,
+	tableID primitive.ObjectID,
+) (OrderTotal, error) {
+	var orders []Order
+
+	// Get the collection from the database
+	collection := client.GetCollection(config.Env.DatabaseName, "orders")
+
+	query := bson.D{
+		{Key: "closed_at", Value: bson.M{"$exists": false}},
+		{Key: "table_id", Value: tableID},
+	}
+
+	// Find all documents that fits the query
+	cursor, err := collection.Find(ctx, query)
+	if err != nil {
+		return OrderTotal{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the results into the order slice
+	if err := cursor.All(ctx, &orders); err != nil {
+		return OrderTotal{}, err
+	}
+
+	var total OrderTotal
+	total.TableID = tableID
+	total.Items = []OrderItem{}
+	total.OrderIDs = []primitive.ObjectID{}
+	total.AllServed = true
+
+	type lineKey struct {
+		menuItemID primitive.ObjectID
+		seat       uint8
+		modifiers  string
+	}
+	itemIndexMap := make(map[lineKey]int)
+
+	for _, order := range orders {
+		total.OrderIDs = append(total.OrderIDs, order.ID)
+		if !order.SessionID.IsZero() {
+			total.SessionID = order.SessionID
+		}
+		if order.ServedAt == nil {
+			total.AllServed = false
+		}
+
+		// Orders placed before discounts existed have no gross price
+		if order.GrossPrice == 0 {
+			order.GrossPrice = order.TotalPrice
+		}
+		total.GrossPrice += order.GrossPrice
+		total.DiscountTotal += order.DiscountTotal
+		total.TotalPrice += order.TotalPrice
+		if order.Discount != nil {
+			total.OrderDiscount += order.Discount.Amount
+		}
+		total.TaxTotal += order.TaxTotal
+		if !order.TaxInclusive {
+			total.TaxAdded += order.TaxTotal
+		}
+
+		for _, item := range order.Items {
+			// Discounted lines are kept apart so their discount stays accurate
+			if item.Discount != nil {
+				total.Items = append(total.Items, item)
+				continue
+			}
+
+			key := lineKey{item.MenuItem.ID, item.Seat, strings.Join(item.Modifiers, "\x00")}
+			if idx, exists := itemIndexMap[key]; exists {
+				total.Items[idx].Quantity += item.Quantity
+			} else {
+				total.Items = append(total.Items, item)
+				itemIndexMap[key] = len(total.Items) - 1
+			}
+		}
+	}
+
+	if total.SessionID.IsZero() {
+		return total, nil
+	}
+
+	tableSession, err := session.Find(ctx, client, total.SessionID)
+	if err != nil {
+		return OrderTotal{}, err
+	}
+
+	// The service charge is worked out on what the orders come to before tax added on top
+	total.ServiceCharge, err = session.ServiceChargeFor(ctx, client, tableSession, total.TotalPrice-total.TaxAdded)
+	if err != nil {
+		return OrderTotal{}, err
+	}
+	if total.ServiceCharge != nil {
+		total.TotalPrice += total.ServiceCharge.Total
+	}
+
+	return total, nil
+}
+
+// GetSessionBalance sums the orders of a session and the payments taken
+// against it.
+func GetSessionBalance(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+) (Balance, error) {
+	var orders []Order
+
+	cursor, err := client.GetCollection(config.Env.DatabaseName, "orders").
+		Find(ctx, bson.D{{Key: "session_id", Value: sessionID}})
+	if err != nil {
+		return Balance{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &orders); err != nil {
+		return Balance{}, err
+	}
+
+	balance := Balance{SessionID: sessionID}
+	var taxAdded int64
+	for _, order := range orders {
+		if !order.TaxInclusive {
+			taxAdded += order.TaxTotal
+		}
+		balance.Total += order.TotalPrice
+		if order.ServedAt != nil {
+			balance.Served += order.TotalPrice
+		}
+		if balance.Currency == "" && len(order.Items) > 0 {
+			balance.Currency = order.Items[0].MenuItem.Currency
+		}
+	}
+
+	tableSession, err := session.Find(ctx, client, sessionID)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	balance.ServiceCharge, err = session.ServiceChargeFor(ctx, client, tableSession, balance.Total-taxAdded)
+	if err != nil {
+		return Balance{}, err
+	}
+	if charge := balance.ServiceCharge; charge != nil {
+		// Served orders carry their share of the charge, all of it once everything is served
+		balance.Served += charge.Total * balance.Served / balance.Total
+		balance.Total += charge.Total
+	}
+
+	balance.Paid, err = utils.SumField(
+		ctx,
+		client.GetCollection(config.Env.DatabaseName, "payments"),
+		bson.D{{Key: "session_id", Value: sessionID}},
+		"amount",
+	)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	balance.Outstanding = max(balance.Total-balance.Paid, 0)
+	return balance, nil
+}
+
+// ticketOf lists the lines of an order for kitchen tickets.
+func ticketOf(order Order, tableName string) printer.Ticket {
+	ticket := printer.Ticket{
+		OrderID:   order.ID,
+		Table:     tableName,
+		Service:   order.Service,
+		CreatedAt: order.CreatedAt,
+	}
+	for _, item := range order.Items {
+		ticket.Items = append(ticket.Items, printer.TicketItem{
+			Name:      item.MenuItem.Name,
+			Category:  item.MenuItem.Category,
+			Quantity:  item.Quantity,
+			Seat:      item.Seat,
+			Modifiers: item.Modifiers,
+		})
+	}
+	return ticket
+}
+
+// saveChange saves a change of an order in one transaction with its history
+// entry and event, so listeners neither miss a saved change nor hear of one
+// that was not saved. save writes the change and reports whether the order
+// was still at the version it was read at. Once the change is saved the
+// order's version is bumped.
+func saveChange(
+	ctx context.Context,
+	client db.IMongoClient,
+	order *Order,
+	entry HistoryEntry,
+	eventType string,
+	save func(sc mongo.SessionContext) (bool, error),
+) (bool, error) {
+	changed := *order
+	changed.Version++
+
+	saved := false
+	err := db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+		var err error
+		saved, err = save(sc)
+		if err != nil || !saved {
+			return err
+		}
+
+		if err := recordHistory(sc, client, entry); err != nil {
+			return err
+		}
+		return outbox.Publish(sc, client, orderEvent(eventType, changed))
+	})
+	if err != nil || !saved {
+		return false, err
+	}
+	outbox.Notify()
+
+	*order = changed
 	return true, nil
 }
+
+// orderEvent is an order event with the stations preparing its lines, so
+// station displays can follow only their own orders.
+func orderEvent(eventType string, order Order) sse.Event {
+	var stations []string
+	for _, item := range order.Items {
+		if station := printer.Route(item.MenuItem.Category); !slices.Contains(stations, station) {
+			stations = append(stations, station)
+		}
+	}
+
+	return sse.Event{
+		Type:     eventType,
+		TableID:  order.TableID.Hex(),
+		Stations: stations,
+		Data:     order,
+	}
+}
@@ -0,0 +1,69 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+func TestOrderEvent(t *testing.T) {
+	routes := config.Env.PrinterRoutes
+	t.Cleanup(func() { config.Env.PrinterRoutes = routes })
+	config.Env.PrinterRoutes = map[string]string{"drinks": "bar"}
+
+	order := Order{
+		TableID: primitive.NewObjectID(),
+		Items: []OrderItem{
+			{MenuItem: menu.MenuItem{Category: "drinks"}, Quantity: 1},
+			{MenuItem: menu.MenuItem{Category: "food"}, Quantity: 1},
+			{MenuItem: menu.MenuItem{Category: "drinks"}, Quantity: 2},
+		},
+	}
+
+	event := orderEvent(sse.OrderCreated, order)
+
+	assert.Equal(t, sse.OrderCreated, event.Type)
+	assert.Equal(t, order.TableID.Hex(), event.TableID)
+	assert.Equal(t, []string{"bar", printer.StationKitchen}, event.Stations)
+	assert.Equal(t, order, event.Data)
+}
+
+func TestLoadMenuItems(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee", Price: 400, Currency: "EUR", Category: "drinks"}
+
+	mt.Run("priced as on the menu", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(document(coffee)))
+		items := []OrderItem{
+			{MenuItem: menu.MenuItem{ID: coffee.ID, Price: 1, Category: "zero-rated"}, Quantity: 2},
+			{MenuItem: menu.MenuItem{ID: coffee.ID}, Quantity: 1, Seat: 2},
+		}
+
+		err := loadMenuItems(context.Background(), db.NewMockMongoClient(mt.Coll), items)
+
+		assert.NoError(t, err)
+		assert.Equal(t, coffee, items[0].MenuItem)
+		assert.Equal(t, coffee, items[1].MenuItem)
+		ids := mt.GetStartedEvent().Command.Lookup("filter", "_id", "$in").Array()
+		values, _ := ids.Values()
+		assert.Len(t, values, 1)
+	})
+
+	mt.Run("not on the menu", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor())
+		items := []OrderItem{{MenuItem: coffee, Quantity: 1}}
+
+		err := loadMenuItems(context.Background(), db.NewMockMongoClient(mt.Coll), items)
+
+		assert.Equal(t, errNotOnMenu, err)
+	})
+}
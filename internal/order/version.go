@@ -0,0 +1,97 @@
+package order
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// incVersion bumps the version of the orders changed by an update.
+var incVersion = bson.E{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}
+
+// versionFilter matches orders still at the given version. Orders created
+// before versioning have no version and count as version 0.
+func versionFilter(version int64) bson.E {
+	if version == 0 {
+		return bson.E{Key: "version", Value: bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.E{Key: "version", Value: version}
+}
+
+// etag formats an order version as an ETag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch returns the order version of the If-Match header, if there is one.
+// It writes the error response itself when the header is malformed.
+func ifMatch(c *gin.Context) (*int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return nil, true
+	}
+
+	value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match must be an order version"})
+		return nil, false
+	}
+	return &version, true
+}
+
+// checkVersion rejects a change made to an outdated copy of the order when
+// the client sent the version it last saw in an If-Match header.
+func checkVersion(c *gin.Context, order Order) bool {
+	version, ok := ifMatch(c)
+	if !ok {
+		return false
+	}
+	if version != nil && *version != order.Version {
+		versionConflict(c, order)
+		return false
+	}
+	return true
+}
+
+// versionConflict tells the client its copy of the order is outdated and
+// sends the current one back.
+func versionConflict(c *gin.Context, current Order) {
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "Order was changed by someone else, review the current order and try again",
+		"data":  current,
+	})
+}
+
+// conflictOrCurrent writes the response to an update that matched no order,
+// which was either changed, closed or removed in the meantime.
+func conflictOrCurrent(c *gin.Context, client db.IMongoClient, id primitive.ObjectID) {
+	var current Order
+	err := client.GetCollection(config.Env.DatabaseName, "orders").
+		FindOne(c.Request.Context(), bson.D{{Key: "_id", Value: id}}).
+		Decode(&current)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found."})
+			return
+		}
+		utils.HandleMongoError(c, err)
+		return
+	}
+
+	if current.ClosedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Closed orders can only be refunded"})
+		return
+	}
+	versionConflict(c, current)
+}
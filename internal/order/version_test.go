@@ -0,0 +1,53 @@
+package order
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVersionFilter(t *testing.T) {
+	assert.Equal(t, bson.E{Key: "version", Value: int64(3)}, versionFilter(3))
+	// Orders from before versioning have no version field
+	assert.Equal(t, bson.E{Key: "version", Value: bson.M{"$in": bson.A{0, nil}}}, versionFilter(0))
+}
+
+func TestCheckVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		status  int
+		current string
+	}{
+		{"no header", "", true, http.StatusOK, ""},
+		{"current version", `"4"`, true, http.StatusOK, ""},
+		{"weak etag", `W/"4"`, true, http.StatusOK, ""},
+		{"outdated version", `"3"`, false, http.StatusConflict, `"4"`},
+		{"malformed", `"latest"`, false, http.StatusBadRequest, ""},
+		{"negative", `"-1"`, false, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+			}
+
+			ok := checkVersion(c, Order{Version: 4})
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.current, w.Header().Get("ETag"))
+		})
+	}
+}
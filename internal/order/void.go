@@ -0,0 +1,135 @@
+package order
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+type voidRequest struct {
+	Items    []transferItem `json:"items"    validate:"required,min=1,dive"`
+	Reason   string         `json:"reason"   validate:"required,max=200"`
+	Approval *auth.Approval `json:"approval"` // required unless an admin voids the lines
+}
+
+// VoidItems takes lines off an order that has not been closed yet
+//
+// @Summary Void order lines
+// @Description Takes the given quantities of menu items off an open order, served or not, and reprices it.
+// @Description Voided lines are kept on the order with the reason. Voids need an admin's credentials in the approval field
+// @Description unless an admin voids them. Closed orders can only be refunded.
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param If-Match header string false "Order version the void is based on"
+// @Param void body voidRequest true "Lines to void and reason"
+// @Security bearerToken
+// @Success 200 {object} Order "Order without the voided lines"
+// @Failure 400 "Invalid request"
+// @Failure 403 "Manager approval required or denied"
+// @Failure 404 "Order not found"
+// @Failure 409 "Order is closed or changed since the If-Match version"
+// @Failure 500 "Internal Server Error"
+// @Router /order/void/{id} [post]
+func VoidItems(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request voidRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateOrder(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		quantities := make(map[primitive.ObjectID]int)
+		for _, item := range request.Items {
+			menuItemID, err := primitive.ObjectIDFromHex(item.MenuItemID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Menu Item ID"})
+				return
+			}
+			quantities[menuItemID] += int(item.Quantity)
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		order, ok := findOpenOrder(c, client, id)
+		if !ok || !checkVersion(c, order) {
+			return
+		}
+
+		remaining, voided, ok := splitItems(order.Items, quantities)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Order does not contain the requested item quantities",
+			})
+			return
+		}
+
+		approverID, ok := auth.ApproveAction(c, client, request.Approval)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		for _, item := range voided {
+			order.Voids = append(order.Voids, Void{
+				Item:       item,
+				Reason:     request.Reason,
+				VoidedBy:   userID,
+				ApprovedBy: approverID,
+				VoidedAt:   now,
+			})
+		}
+
+		rates, err := tax.LoadRates(c.Request.Context(), client)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		order.Items = remaining
+		priceOrder(&order, rates)
+
+		entry := ActorOf(c).Entry(order.ID, HistoryVoided, bson.M{
+			"items":       voided,
+			"reason":      request.Reason,
+			"approved_by": approverID,
+			"version":     order.Version + 1,
+		})
+		if !savePricing(c, client, &order, entry) {
+			return
+		}
+
+		c.Header("ETag", etag(order.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Items voided successfully",
+			"data":    order,
+		})
+	}
+}
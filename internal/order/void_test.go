@@ -0,0 +1,131 @@
+package order
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+)
+
+// serve sends a request to the handler as a member of staff with the role.
+func serve(role, method, path string, handler gin.HandlerFunc, target, body string, header http.Header) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, func(c *gin.Context) {
+		c.Set("claims", jwt.MapClaims{"UserID": primitive.NewObjectID().Hex(), "Role": role})
+	}, handler)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func cursor(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch, docs...)
+}
+
+func document(v any) bson.D {
+	raw, _ := bson.Marshal(v)
+	var doc bson.D
+	_ = bson.Unmarshal(raw, &doc)
+	return doc
+}
+
+func TestVoidItems(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee", Price: 400}
+	order := Order{
+		ID:      primitive.NewObjectID(),
+		TableID: primitive.NewObjectID(),
+		Items:   []OrderItem{{MenuItem: coffee, Quantity: 3}},
+		Version: 2,
+	}
+	target := "/order/void/" + order.ID.Hex()
+	body := `{"items":[{"menuItemId":"` + coffee.ID.Hex() + `","quantity":1}],"reason":"spilled"}`
+	version := func(v string) http.Header { return http.Header{"If-Match": {v}} }
+
+	void := func(mt *mtest.T, role, body string, header http.Header) *httptest.ResponseRecorder {
+		return serve(role, http.MethodPost, "/order/void/:id", VoidItems(db.NewMockMongoClient(mt.Coll)), target, body, header)
+	}
+
+	mt.Run("admin voids a line", func(mt *mtest.T) {
+		updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		mt.AddMockResponses(cursor(document(order)), cursor(), updated,
+			mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		w := void(mt, "admin", body, version(`"2"`))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(2), update.Lookup("q", "version").Int64())
+		assert.Equal(t, int64(800), update.Lookup("u", "$set", "total_price").Int64())
+		assert.Equal(t, "spilled", update.Lookup("u", "$set", "voids").Array().Index(0).Value().Document().Lookup("reason").StringValue())
+	})
+
+	mt.Run("changed before it was saved", func(mt *mtest.T) {
+		current := order
+		current.Version = 3
+		mt.AddMockResponses(cursor(document(order)), cursor(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(), cursor(document(current)))
+
+		w := void(mt, "admin", body, nil)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	})
+
+	mt.Run("outdated If-Match", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(document(order)))
+
+		w := void(mt, "admin", body, version(`"1"`))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	})
+
+	mt.Run("closed order", func(mt *mtest.T) {
+		closed := order
+		closedAt := time.Now()
+		closed.ClosedAt = &closedAt
+		mt.AddMockResponses(cursor(document(closed)))
+
+		w := void(mt, "admin", body, nil)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	mt.Run("more than ordered", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(document(order)))
+
+		w := void(mt, "admin", strings.Replace(body, `"quantity":1`, `"quantity":4`, 1), nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	mt.Run("waiters need approval", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(document(order)))
+
+		w := void(mt, "waiter", body, nil)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+)
+
+const (
+	KindEvent = "event" // published to SSE, WebSocket and webhook subscribers
+	KindPrint = "print" // queued at a printer
+
+	StatusPending    = "pending"
+	StatusDispatched = "dispatched"
+)
+
+// Message is a side effect of a change, written in the same transaction as
+// the change and dispatched once it has committed. Its ID is the
+// deduplication key of the event or print job it turns into.
+type Message struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Kind          string             `bson:"kind"`
+	Event         *Event             `bson:"event,omitempty"`
+	Job           *printer.Job       `bson:"job,omitempty"`
+	Status        string             `bson:"status"`
+	Attempts      int64              `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	DispatchedAt  *time.Time         `bson:"dispatched_at,omitempty"`
+}
+
+// Event is an event to publish. Data is kept as JSON, the way subscribers
+// receive it.
+type Event struct {
+	Type     string   `bson:"type"`
+	TableID  string   `bson:"table_id,omitempty"`
+	Stations []string `bson:"stations,omitempty"`
+	Data     []byte   `bson:"data"`
+}
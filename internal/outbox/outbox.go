@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+const (
+	pollInterval = time.Second
+	lease        = 30 * time.Second // a claimed message is dispatched again after this unless marked dispatched
+	maxBackoff   = time.Minute
+)
+
+// wake is signalled by Notify so committed messages don't wait for the next
+// poll.
+var wake = make(chan struct{}, 1)
+
+// Publish adds an event to the outbox. Pass the transaction's session context
+// so the event is only published if the transaction commits.
+func Publish(ctx context.Context, client db.IMongoClient, event sse.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	return add(ctx, client, Message{
+		Kind: KindEvent,
+		Event: &Event{
+			Type:     event.Type,
+			TableID:  event.TableID,
+			Stations: event.Stations,
+			Data:     data,
+		},
+	})
+}
+
+// Print adds print jobs to the outbox, like Publish.
+func Print(ctx context.Context, client db.IMongoClient, jobs ...printer.Job) error {
+	for _, job := range jobs {
+		if err := add(ctx, client, Message{Kind: KindPrint, Job: &job}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func add(ctx context.Context, client db.IMongoClient, message Message) error {
+	now := time.Now()
+	message.Status = StatusPending
+	message.NextAttemptAt = now
+	message.CreatedAt = now
+
+	_, err := client.GetCollection(config.Env.DatabaseName, "outbox").InsertOne(ctx, message)
+	return err
+}
+
+// Notify wakes the dispatcher. Call it once the transaction that added
+// messages has committed.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start dispatches the messages of the outbox in the background until the
+// context is cancelled. Messages are dispatched at least once: one whose
+// instance stopped while dispatching it is dispatched again once its lease
+// runs out, and its ID keeps it from being published or printed twice.
+func Start(ctx context.Context, client db.IMongoClient) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+
+			for dispatchNext(ctx, client) {
+			}
+		}
+	}()
+}
+
+// dispatchNext claims the oldest message that is due and dispatches it. It
+// reports whether a message was claimed.
+func dispatchNext(ctx context.Context, client db.IMongoClient) bool {
+	collection := client.GetCollection(config.Env.DatabaseName, "outbox")
+
+	now := time.Now()
+	var message Message
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.D{
+			{Key: "status", Value: StatusPending},
+			{Key: "next_attempt_at", Value: bson.M{"$lte": now}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "next_attempt_at", Value: now.Add(lease)}}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&message)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Printf("Failed to claim outbox message: %v", err)
+		}
+		return false
+	}
+
+	var update bson.D
+	if err := dispatch(ctx, client, message); err != nil {
+		log.Printf("Failed to dispatch outbox message %s: %v", message.ID.Hex(), err)
+		message.Attempts++
+		update = bson.D{
+			{Key: "attempts", Value: message.Attempts},
+			{Key: "last_error", Value: err.Error()},
+			{Key: "next_attempt_at", Value: time.Now().Add(backoff(message.Attempts))},
+		}
+	} else {
+		update = bson.D{
+			{Key: "status", Value: StatusDispatched},
+			{Key: "dispatched_at", Value: time.Now()},
+		}
+	}
+
+	_, err = collection.UpdateByID(ctx, message.ID, bson.D{{Key: "$set", Value: update}})
+	if err != nil {
+		log.Printf("Failed to update outbox message %s: %v", message.ID.Hex(), err)
+	}
+	return true
+}
+
+// dispatch publishes or queues a message, keyed by its ID.
+func dispatch(ctx context.Context, client db.IMongoClient, message Message) error {
+	key := message.ID.Hex()
+
+	switch {
+	case message.Event != nil:
+		return sse.PublishOnce(key, sse.Event{
+			Type:     message.Event.Type,
+			TableID:  message.Event.TableID,
+			Stations: message.Event.Stations,
+			Data:     json.RawMessage(message.Event.Data),
+			Time:     message.CreatedAt,
+		})
+	case message.Job != nil:
+		job := *message.Job
+		job.Key = key
+		return printer.Enqueue(ctx, client, job)
+	default:
+		// Nothing to dispatch, marked dispatched so it isn't claimed again
+		log.Printf("Outbox message %s has no %s to dispatch", key, message.Kind)
+		return nil
+	}
+}
+
+// backoff doubles the wait after every failed attempt, up to a minute.
+func backoff(attempts int64) time.Duration {
+	wait := time.Second << min(attempts, 6)
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, backoff(1))
+	assert.Equal(t, 4*time.Second, backoff(2))
+	assert.Equal(t, 32*time.Second, backoff(5))
+	assert.Equal(t, time.Minute, backoff(6))
+	assert.Equal(t, time.Minute, backoff(100))
+}
+
+func TestNotify(t *testing.T) {
+	// Notifying never blocks, however often the dispatcher is behind
+	Notify()
+	Notify()
+
+	select {
+	case <-wake:
+	default:
+		t.Fatal("expected the dispatcher to be woken")
+	}
+	select {
+	case <-wake:
+		t.Fatal("expected a single wake-up")
+	default:
+	}
+}
+
+func TestPublish(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("event kept as JSON", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		err := Publish(context.Background(), db.NewMockMongoClient(mt.Coll), sse.Event{
+			Type:     sse.OrderCreated,
+			TableID:  "t1",
+			Stations: []string{"bar"},
+			Data:     map[string]int{"quantity": 2},
+		})
+
+		assert.NoError(t, err)
+		message := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		assert.Equal(t, KindEvent, message.Lookup("kind").StringValue())
+		assert.Equal(t, StatusPending, message.Lookup("status").StringValue())
+		assert.Equal(t, sse.OrderCreated, message.Lookup("event", "type").StringValue())
+		_, data := message.Lookup("event", "data").Binary()
+		assert.JSONEq(t, `{"quantity":2}`, string(data))
+	})
+
+	mt.Run("one message per print job", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		err := Print(context.Background(), db.NewMockMongoClient(mt.Coll),
+			printer.Job{Kind: printer.KindTicket, Station: "bar"},
+			printer.Job{Kind: printer.KindTicket, Station: "kitchen"},
+		)
+
+		assert.NoError(t, err)
+		first := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		second := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		assert.Equal(t, KindPrint, first.Lookup("kind").StringValue())
+		assert.Equal(t, "bar", first.Lookup("job", "station").StringValue())
+		assert.Equal(t, "kitchen", second.Lookup("job", "station").StringValue())
+	})
+}
+
+func TestDispatchNext(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	claimed := func(message Message) bson.D {
+		raw, _ := bson.Marshal(message)
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.Raw(raw)})
+	}
+	updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+	mt.Run("nothing due", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		assert.False(t, dispatchNext(context.Background(), db.NewMockMongoClient(mt.Coll)))
+	})
+
+	mt.Run("event published", func(mt *mtest.T) {
+		s, _ := sse.Subscribe(sse.Filter{})
+		defer sse.Unsubscribe(s)
+		message := Message{
+			ID:     primitive.NewObjectID(),
+			Kind:   KindEvent,
+			Event:  &Event{Type: sse.OrderServed, TableID: "t1", Data: []byte(`{}`)},
+			Status: StatusPending,
+		}
+		mt.AddMockResponses(claimed(message), updated)
+
+		assert.True(t, dispatchNext(context.Background(), db.NewMockMongoClient(mt.Coll)))
+
+		select {
+		case event := <-s.Events():
+			assert.Equal(t, sse.OrderServed, event.Type)
+			assert.Equal(t, message.ID.Hex(), event.Key)
+		case <-time.After(time.Second):
+			mt.Fatal("event was not published")
+		}
+
+		claim := mt.GetStartedEvent().Command
+		assert.Equal(t, StatusPending, claim.Lookup("query", "status").StringValue())
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, StatusDispatched, update.Lookup("u", "$set", "status").StringValue())
+	})
+
+	mt.Run("failed print job is retried later", func(mt *mtest.T) {
+		message := Message{
+			ID:       primitive.NewObjectID(),
+			Kind:     KindPrint,
+			Job:      &printer.Job{Kind: printer.KindTicket, Station: "bar"},
+			Status:   StatusPending,
+			Attempts: 2,
+		}
+		mt.AddMockResponses(claimed(message),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "down"}), updated)
+
+		before := time.Now()
+		assert.True(t, dispatchNext(context.Background(), db.NewMockMongoClient(mt.Coll)))
+
+		mt.GetStartedEvent()
+		insert := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		assert.Equal(t, message.ID.Hex(), insert.Lookup("key").StringValue())
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		set := update.Lookup("u", "$set").Document()
+		assert.Equal(t, int64(3), set.Lookup("attempts").Int64())
+		assert.Contains(t, set.Lookup("last_error").StringValue(), "down")
+		_, pending := set.LookupErr("status")
+		assert.Error(t, pending)
+		assert.WithinDuration(t, before.Add(backoff(3)), set.Lookup("next_attempt_at").Time(), time.Second)
+	})
+}
@@ -0,0 +1,423 @@
+package payment
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/bill"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+var (
+	errNoSession        = errors.New("table has no open session")
+	errCurrencyMismatch = errors.New("currency does not match the orders")
+	errSplitNotFound    = errors.New("bill or split not found")
+)
+
+// CreatePayment takes a payment for a table
+//
+// @Summary Take a payment
+// @Description Records a cash, card, voucher or other payment against the open session of a table, or against one split of its bill.
+// @Description Partial payments are allowed. Cash may exceed the amount due and the change is returned.
+// @Description Tips are given as an amount or a percentage and go to the waiter who served the table.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param payment body paymentRequest true "Payment details, amounts in minor units"
+// @Security bearerToken
+// @Success 201 {object} map[string]interface{} "Payment taken successfully"
+// @Failure 400 "Invalid request"
+// @Failure 404 "Table has no open session, or bill or split not found"
+// @Failure 409 "Nothing left to pay or amount exceeds the balance"
+// @Failure 500 "Internal Server Error"
+// @Router /payment/{tableID} [post]
+func CreatePayment(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tableID, err := primitive.ObjectIDFromHex(c.Param("tableID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request paymentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validatePayment(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		request.Currency = strings.ToUpper(request.Currency)
+
+		var billID, splitID primitive.ObjectID
+		if request.BillID != "" || request.SplitID != "" {
+			billID, err = primitive.ObjectIDFromHex(request.BillID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Bill ID"})
+				return
+			}
+			splitID, err = primitive.ObjectIDFromHex(request.SplitID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Split ID"})
+				return
+			}
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "payments")
+
+		var payment Payment
+		var balance order.Balance
+		err = db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			tableSession, err := session.FindOpen(sc, client, tableID)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return errNoSession
+				}
+				return err
+			}
+
+			// Concurrent payments for the session conflict here, so the
+			// balance below is never stale
+			if err := session.CountPayment(sc, client, tableSession.ID); err != nil {
+				if err == mongo.ErrNoDocuments {
+					return errNoSession
+				}
+				return err
+			}
+
+			balance, err = order.GetSessionBalance(sc, client, tableSession.ID)
+			if err != nil {
+				return err
+			}
+			if balance.Currency != "" && balance.Currency != request.Currency {
+				return errCurrencyMismatch
+			}
+
+			outstanding := balance.Outstanding
+			if !splitID.IsZero() {
+				// Payments against a split conflict with the bill being
+				// cancelled or split again here
+				if err := bill.CountPayment(sc, client, billID); err != nil {
+					if err == mongo.ErrNoDocuments {
+						return errSplitNotFound
+					}
+					return err
+				}
+				outstanding, err = splitOutstanding(sc, client, tableSession.ID, billID, splitID)
+				if err != nil {
+					return err
+				}
+				outstanding = min(outstanding, balance.Outstanding)
+			}
+
+			amounts, err := applyTender(request, outstanding)
+			if err != nil {
+				return err
+			}
+
+			var tipTo primitive.ObjectID
+			if amounts.Tip > 0 {
+				tipTo, err = tipRecipient(sc, client, tableSession)
+				if err != nil {
+					return err
+				}
+			}
+
+			payment = Payment{
+				TableID:   tableID,
+				SessionID: tableSession.ID,
+				BillID:    billID,
+				SplitID:   splitID,
+				Tender:    request.Tender,
+				Amount:    amounts.Amount,
+				Tendered:  amounts.Tendered,
+				Change:    amounts.Change,
+				Tip:       amounts.Tip,
+				TipTo:     tipTo,
+				Currency:  request.Currency,
+				Reference: request.Reference,
+				CreatedAt: time.Now(),
+				CreatedBy: userID,
+			}
+
+			result, err := collection.InsertOne(sc, payment)
+			if err != nil {
+				return err
+			}
+			payment.ID = result.InsertedID.(primitive.ObjectID)
+
+			balance.Paid += amounts.Amount
+			balance.Outstanding = max(balance.Total-balance.Paid, 0)
+
+			return outbox.Publish(sc, client, sse.Event{
+				Type:    sse.PaymentCreated,
+				TableID: tableID.Hex(),
+				Data:    gin.H{"payment": payment, "balance": balance},
+			})
+		})
+		if err != nil {
+			switch err {
+			case errNoSession:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table has no open session"})
+			case errSplitNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Bill or split not found"})
+			case errCurrencyMismatch:
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Currency must be " + balance.Currency,
+				})
+			case errMissingValue, errUnderTender:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errNothingDue, errOverpayment:
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				utils.HandleMongoError(c, err)
+			}
+			return
+		}
+
+		outbox.Notify()
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Payment taken successfully",
+			"id":      payment.ID,
+			"data":    payment,
+			"balance": balance,
+		})
+	}
+}
+
+// GetBalance returns what a table owes
+//
+// @Summary Get a table's balance
+// @Description Sums the orders of the open session of a table and the payments taken against it.
+// @Tags payment
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Security bearerToken
+// @Success 200 {object} order.Balance "Balance in minor units"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Table has no open session"
+// @Failure 500 "Internal Server Error"
+// @Router /payment/balance/{tableID} [get]
+func GetBalance(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tableID, err := primitive.ObjectIDFromHex(c.Param("tableID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		tableSession, err := session.FindOpen(ctx, client, tableID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table has no open session"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		balance, err := order.GetSessionBalance(ctx, client, tableSession.ID)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": balance,
+		})
+	}
+}
+
+// GetPayments lists payments
+//
+// @Summary Get payments
+// @Description Retrieves payments with optional filters for admin and cashier roles
+// @Tags payment
+// @Produce json
+// @Param session query string false "Filter by session ID"
+// @Param table query string false "Filter by table ID"
+// @Param tender query string false "Filter by tender (cash, card, voucher, other)"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of payments per page (default: 20)"
+// @Security bearerToken
+// @Success 200 {array} Payment "List of payments"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Internal Server Error"
+// @Router /payment [get]
+func GetPayments(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var payments []Payment
+
+		// Get the collection from the database
+		collection := client.GetCollection(config.Env.DatabaseName, "payments")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number."})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit number."})
+			return
+		}
+
+		query := bson.D{}
+
+		if sessionParam := c.Query("session"); sessionParam != "" {
+			sessionID, err := primitive.ObjectIDFromHex(sessionParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Session ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "session_id", Value: sessionID})
+		}
+
+		if table := c.Query("table"); table != "" {
+			tableID, err := primitive.ObjectIDFromHex(table)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "table_id", Value: tableID})
+		}
+
+		if tender := c.Query("tender"); tender != "" {
+			switch tender {
+			case TenderCash, TenderCard, TenderVoucher, TenderOther:
+				query = append(query, bson.E{Key: "tender", Value: tender})
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid tender. Use cash, card, voucher or other.",
+				})
+				return
+			}
+		}
+
+		findOptions := options.Find()
+		findOptions.SetSkip(int64((page - 1) * limit))
+		findOptions.SetLimit(int64(limit))
+		findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &payments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse database response.",
+			})
+			return
+		}
+
+		totalCount, err := collection.CountDocuments(ctx, query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": payments,
+			"meta": gin.H{
+				"total":      totalCount,
+				"page":       page,
+				"limit":      limit,
+				"totalPages": int(math.Ceil(float64(totalCount) / float64(limit))),
+			},
+		})
+	}
+}
+
+// GetTipsReport reports tips per member of staff
+//
+// @Summary Get the tips report
+// @Description Sums the tips taken in a date range per member of staff, overall and per shift.
+// @Description The configured pool percentages (TIP_POOLS) are taken off each member's tips.
+// @Tags payment
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date, inclusive (YYYY-MM-DD)"
+// @Security bearerToken
+// @Success 200 {object} TipsReport "Tips report"
+// @Failure 400 "Invalid date format"
+// @Failure 500 "Failed to fetch tips"
+// @Router /payment/tips [get]
+func GetTipsReport(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Query("from"), time.Local)
+		if err != nil {
+			c.JSON(
+				http.StatusBadRequest,
+				gin.H{"error": "Invalid 'from' date format use YYYY-MM-DD"},
+			)
+			return
+		}
+
+		to, err := time.ParseInLocation("2006-01-02", c.Query("to"), time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format YYYY-MM-DD"})
+			return
+		}
+
+		report, err := getTipsReport(
+			c,
+			client.GetCollection(config.Env.DatabaseName, "payments"),
+			client.GetCollection(config.Env.DatabaseName, "users"),
+			from,
+			to.AddDate(0, 0, 1),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tips"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": report,
+		})
+	}
+}
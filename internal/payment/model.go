@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TenderCash    = "cash"
+	TenderCard    = "card"
+	TenderVoucher = "voucher"
+	TenderOther   = "other"
+)
+
+// Payment is a single tender taken against a table session, optionally for
+// one split of its bill. Amounts are in minor units.
+type Payment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"       json:"id"`
+	TableID   primitive.ObjectID `bson:"table_id"            json:"tableId"`
+	SessionID primitive.ObjectID `bson:"session_id"          json:"sessionId"`
+	BillID    primitive.ObjectID `bson:"bill_id,omitempty"   json:"billId,omitempty"`
+	SplitID   primitive.ObjectID `bson:"split_id,omitempty"  json:"splitId,omitempty"`
+	Tender    string             `bson:"tender"              json:"tender"`
+	Amount    int64              `bson:"amount"              json:"amount"`   // applied to the balance
+	Tendered  int64              `bson:"tendered"            json:"tendered"` // handed over by the guest
+	Change    int64              `bson:"change"              json:"change"`   // given back, cash only
+	Tip       int64              `bson:"tip,omitempty"       json:"tip"`      // paid on top of the amount
+	TipTo     primitive.ObjectID `bson:"tip_to,omitempty"    json:"tipTo,omitempty"`
+	Refunded  int64              `bson:"refunded,omitempty"  json:"refunded,omitempty"` // refunded so far, positive
+	Currency  string             `bson:"currency"            json:"currency"`
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"` // card slip or voucher code
+	CreatedAt time.Time          `bson:"created_at"          json:"createdAt"`
+	CreatedBy primitive.ObjectID `bson:"created_by"          json:"createdBy"`
+}
+
+type paymentRequest struct {
+	Tender     string  `json:"tender"    validate:"required,oneof=cash card voucher other"`
+	Amount     int64   `json:"amount"    validate:"gte=0"`
+	Tendered   int64   `json:"tendered"   validate:"gte=0"`
+	Tip        int64   `json:"tip"        validate:"gte=0"`
+	TipPercent float64 `json:"tipPercent" validate:"gte=0,lte=100"` // of the amount, used when tip is not given
+	Currency   string  `json:"currency"  validate:"required,len=3"`
+	Reference  string  `json:"reference" validate:"max=100"`
+	BillID     string  `json:"billId"`
+	SplitID    string  `json:"splitId"`
+}
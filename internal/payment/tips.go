@@ -0,0 +1,215 @@
+package payment
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+type PoolShare struct {
+	Pool    string `json:"pool"`
+	Percent int    `json:"percent"`
+	Amount  int64  `json:"amount"`
+}
+
+type StaffTips struct {
+	StaffID  primitive.ObjectID `json:"staffId"`
+	Name     string             `json:"name"`
+	Payments int                `json:"payments"`
+	Tips     int64              `json:"tips"`   // before pooling
+	Pooled   int64              `json:"pooled"` // shared with the pools
+	Net      int64              `json:"net"`
+}
+
+type ShiftTips struct {
+	Shift string      `json:"shift"`
+	Tips  int64       `json:"tips"`
+	Staff []StaffTips `json:"staff"`
+}
+
+type TipsReport struct {
+	TotalTips int64       `json:"totalTips"`
+	Pools     []PoolShare `json:"pools"`
+	Staff     []StaffTips `json:"staff"`
+	Shifts    []ShiftTips `json:"shifts"`
+}
+
+// PoolShares splits the configured pool percentages off a tip amount. It
+// returns the share of each pool and their sum.
+func PoolShares(amount int64) ([]PoolShare, int64) {
+	shares := []PoolShare{}
+	pooled := int64(0)
+
+	for pool, percent := range config.Env.TipPools {
+		share := amount * int64(percent) / 100
+		shares = append(shares, PoolShare{Pool: pool, Percent: percent, Amount: share})
+		pooled += share
+	}
+
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Pool < shares[j].Pool })
+	return shares, pooled
+}
+
+// shiftOf returns the name of the configured shift the time falls in.
+func shiftOf(t time.Time) string {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	for _, shift := range config.Env.Shifts {
+		if shift.Start <= shift.End {
+			if offset >= shift.Start && offset < shift.End {
+				return shift.Name
+			}
+		} else if offset >= shift.Start || offset < shift.End {
+			return shift.Name
+		}
+	}
+	return "unassigned"
+}
+
+// getTipsReport sums the tips taken in the date range per member of staff,
+// overall and per shift, and applies the pooling rules to each.
+func getTipsReport(
+	ctx context.Context,
+	collection *mongo.Collection,
+	users *mongo.Collection,
+	from time.Time,
+	to time.Time,
+) (TipsReport, error) {
+	findOptions := options.Find().SetProjection(bson.D{
+		{Key: "tip", Value: 1},
+		{Key: "tip_to", Value: 1},
+		{Key: "created_at", Value: 1},
+	})
+
+	cursor, err := collection.Find(ctx, bson.D{
+		{Key: "created_at", Value: bson.M{"$gte": from, "$lt": to}},
+		{Key: "tip", Value: bson.M{"$gt": 0}},
+	}, findOptions)
+	if err != nil {
+		return TipsReport{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var payments []Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return TipsReport{}, err
+	}
+
+	type shiftKey struct {
+		shift   string
+		staffID primitive.ObjectID
+	}
+
+	overall := make(map[primitive.ObjectID]*StaffTips)
+	perShift := make(map[shiftKey]*StaffTips)
+	var shiftNames []string
+
+	var report TipsReport
+	for _, p := range payments {
+		report.TotalTips += p.Tip
+
+		if overall[p.TipTo] == nil {
+			overall[p.TipTo] = &StaffTips{StaffID: p.TipTo}
+		}
+		overall[p.TipTo].Payments++
+		overall[p.TipTo].Tips += p.Tip
+
+		key := shiftKey{shiftOf(p.CreatedAt.Local()), p.TipTo}
+		if perShift[key] == nil {
+			perShift[key] = &StaffTips{StaffID: p.TipTo}
+		}
+		perShift[key].Payments++
+		perShift[key].Tips += p.Tip
+
+		if !slices.Contains(shiftNames, key.shift) {
+			shiftNames = append(shiftNames, key.shift)
+		}
+	}
+
+	names, err := staffNames(ctx, users, overall)
+	if err != nil {
+		return TipsReport{}, err
+	}
+
+	report.Pools, _ = PoolShares(report.TotalTips)
+
+	report.Staff = []StaffTips{}
+	for _, staff := range overall {
+		report.Staff = append(report.Staff, withPooling(*staff, names))
+	}
+	sortStaff(report.Staff)
+
+	report.Shifts = []ShiftTips{}
+	sort.Strings(shiftNames)
+	for _, name := range shiftNames {
+		shift := ShiftTips{Shift: name, Staff: []StaffTips{}}
+		for key, staff := range perShift {
+			if key.shift != name {
+				continue
+			}
+			shift.Tips += staff.Tips
+			shift.Staff = append(shift.Staff, withPooling(*staff, names))
+		}
+		sortStaff(shift.Staff)
+		report.Shifts = append(report.Shifts, shift)
+	}
+
+	return report, nil
+}
+
+func withPooling(staff StaffTips, names map[primitive.ObjectID]string) StaffTips {
+	_, staff.Pooled = PoolShares(staff.Tips)
+	staff.Net = staff.Tips - staff.Pooled
+	staff.Name = names[staff.StaffID]
+	return staff
+}
+
+func sortStaff(staff []StaffTips) {
+	sort.Slice(staff, func(i, j int) bool { return staff[i].Tips > staff[j].Tips })
+}
+
+// staffNames looks up the full names of the members of staff in the report.
+func staffNames(
+	ctx context.Context,
+	users *mongo.Collection,
+	staff map[primitive.ObjectID]*StaffTips,
+) (map[primitive.ObjectID]string, error) {
+	ids := make([]primitive.ObjectID, 0, len(staff))
+	for id := range staff {
+		ids = append(ids, id)
+	}
+
+	cursor, err := users.Find(
+		ctx,
+		bson.D{{Key: "_id", Value: bson.M{"$in": ids}}},
+		options.Find().SetProjection(bson.D{{Key: "name", Value: 1}, {Key: "surname", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Name    string             `bson:"name"`
+		Surname string             `bson:"surname"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(results))
+	for _, result := range results {
+		names[result.ID] = result.Name + " " + result.Surname
+	}
+	return names, nil
+}
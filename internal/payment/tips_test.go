@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+func TestPoolShares(t *testing.T) {
+	pools := config.Env.TipPools
+	t.Cleanup(func() { config.Env.TipPools = pools })
+
+	t.Run("no pools", func(t *testing.T) {
+		config.Env.TipPools = map[string]int{}
+
+		shares, pooled := PoolShares(1000)
+
+		assert.Empty(t, shares)
+		assert.Equal(t, int64(0), pooled)
+	})
+
+	t.Run("shares rounded down per pool", func(t *testing.T) {
+		config.Env.TipPools = map[string]int{"kitchen": 20, "bar": 15}
+
+		shares, pooled := PoolShares(999)
+
+		assert.Equal(t, []PoolShare{
+			{Pool: "bar", Percent: 15, Amount: 149},
+			{Pool: "kitchen", Percent: 20, Amount: 199},
+		}, shares)
+		assert.Equal(t, int64(348), pooled)
+	})
+}
+
+func TestWithPooling(t *testing.T) {
+	pools := config.Env.TipPools
+	t.Cleanup(func() { config.Env.TipPools = pools })
+	config.Env.TipPools = map[string]int{"kitchen": 20}
+
+	staffID := primitive.NewObjectID()
+
+	staff := withPooling(StaffTips{StaffID: staffID, Tips: 1500}, map[primitive.ObjectID]string{staffID: "Ana Lima"})
+
+	assert.Equal(t, "Ana Lima", staff.Name)
+	assert.Equal(t, int64(300), staff.Pooled)
+	assert.Equal(t, int64(1200), staff.Net)
+}
+
+func TestShiftOf(t *testing.T) {
+	shifts := config.Env.Shifts
+	t.Cleanup(func() { config.Env.Shifts = shifts })
+	config.Env.Shifts = []config.Shift{
+		{Name: "morning", Start: 6 * time.Hour, End: 16 * time.Hour},
+		{Name: "evening", Start: 16 * time.Hour, End: 2 * time.Hour},
+	}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 14, hour, minute, 0, 0, time.UTC)
+	}
+
+	assert.Equal(t, "morning", shiftOf(at(6, 0)))
+	assert.Equal(t, "morning", shiftOf(at(15, 59)))
+	assert.Equal(t, "evening", shiftOf(at(16, 0)))
+	// Shifts ending after midnight wrap around
+	assert.Equal(t, "evening", shiftOf(at(1, 30)))
+	assert.Equal(t, "unassigned", shiftOf(at(3, 0)))
+}
+
+func TestApplyTenderTips(t *testing.T) {
+	tests := []struct {
+		name    string
+		request paymentRequest
+		want    tenderAmounts
+		err     error
+	}{
+		{
+			name:    "card tip on top of the amount",
+			request: paymentRequest{Tender: TenderCard, Amount: 800, Tip: 100},
+			want:    tenderAmounts{Amount: 800, Tip: 100, Tendered: 900},
+		},
+		{
+			name:    "tip percent of the amount",
+			request: paymentRequest{Tender: TenderCard, Amount: 755, TipPercent: 10},
+			want:    tenderAmounts{Amount: 755, Tip: 76, Tendered: 831},
+		},
+		{
+			name:    "cash tip with change",
+			request: paymentRequest{Tender: TenderCash, Amount: 800, Tip: 100, Tendered: 1000},
+			want:    tenderAmounts{Amount: 800, Tip: 100, Tendered: 1000, Change: 100},
+		},
+		{
+			name:    "cash short of the tip",
+			request: paymentRequest{Tender: TenderCash, Amount: 800, Tip: 100, Tendered: 850},
+			err:     errUnderTender,
+		},
+		{
+			name:    "tip without an amount",
+			request: paymentRequest{Tender: TenderCash, Tip: 100, Tendered: 1000},
+			err:     errMissingValue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTender(tt.request, 800)
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/bill"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+func validatePayment(v *validator.Validate, request interface{}) error {
+	// Perform validation
+	if err := v.Struct(request); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			fmt.Println(err)
+			return nil
+		}
+
+		validationErrors := err.(validator.ValidationErrors)
+		for _, fieldErr := range validationErrors {
+			switch fieldErr.Tag() {
+			case "required":
+				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "oneof":
+				return fmt.Errorf("%s must be one of [%s]", fieldErr.Field(), fieldErr.Param())
+			case "gte":
+				return fmt.Errorf("%s must be at least %s", fieldErr.Field(), fieldErr.Param())
+			case "lte":
+				return fmt.Errorf("%s must be at most %s", fieldErr.Field(), fieldErr.Param())
+			case "len":
+				return fmt.Errorf("%s must be %s characters long", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				return fmt.Errorf("%s must be at most %s characters long", fieldErr.Field(), fieldErr.Param())
+			default:
+				return fmt.Errorf("%s is invalid", fieldErr.Field())
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	errNothingDue   = errors.New("nothing left to pay")
+	errOverpayment  = errors.New("amount exceeds the outstanding balance")
+	errUnderTender  = errors.New("tendered is less than the amount and tip")
+	errMissingValue = errors.New("amount is required")
+)
+
+// tenderAmounts are the amounts of a payment in minor units.
+type tenderAmounts struct {
+	Amount   int64
+	Tip      int64
+	Tendered int64
+	Change   int64
+}
+
+// applyTender works out the applied amount, tip, tendered amount and change
+// of a payment against the outstanding balance. Tips are paid on top of the
+// amount and don't count towards the balance. Cash can be tendered in excess
+// and the difference is given back as change. Other tenders are charged
+// exactly the amount and tip.
+func applyTender(request paymentRequest, outstanding int64) (tenderAmounts, error) {
+	if outstanding <= 0 {
+		return tenderAmounts{}, errNothingDue
+	}
+
+	amount, tendered := request.Amount, request.Tendered
+	tipped := request.Tip > 0 || request.TipPercent > 0
+
+	// Without a tip the amount can be taken from what was handed over
+	if amount == 0 && !tipped {
+		amount = tendered
+		if request.Tender == TenderCash {
+			amount = min(tendered, outstanding)
+		}
+	}
+	if amount == 0 {
+		return tenderAmounts{}, errMissingValue
+	}
+	if amount > outstanding {
+		return tenderAmounts{}, errOverpayment
+	}
+
+	tip := request.Tip
+	if tip == 0 && request.TipPercent > 0 {
+		tip = int64(math.Round(float64(amount) * request.TipPercent / 100))
+	}
+
+	if request.Tender != TenderCash {
+		return tenderAmounts{Amount: amount, Tip: tip, Tendered: amount + tip}, nil
+	}
+
+	if tendered == 0 {
+		tendered = amount + tip
+	}
+	if tendered < amount+tip {
+		return tenderAmounts{}, errUnderTender
+	}
+
+	return tenderAmounts{
+		Amount:   amount,
+		Tip:      tip,
+		Tendered: tendered,
+		Change:   tendered - amount - tip,
+	}, nil
+}
+
+// tipRecipient returns the member of staff a tip taken for a session goes
+// to: the waiter who last served one of its orders, or the session's waiter.
+func tipRecipient(
+	ctx context.Context,
+	client db.IMongoClient,
+	tableSession session.Session,
+) (primitive.ObjectID, error) {
+	var served struct {
+		HandledBy primitive.ObjectID `bson:"handled_by"`
+	}
+
+	err := client.GetCollection(config.Env.DatabaseName, "orders").FindOne(
+		ctx,
+		bson.D{
+			{Key: "session_id", Value: tableSession.ID},
+			{Key: "handled_by", Value: bson.M{"$exists": true}},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "served_at", Value: -1}}),
+	).Decode(&served)
+	if err == mongo.ErrNoDocuments {
+		return tableSession.WaiterID, nil
+	}
+
+	return served.HandledBy, err
+}
+
+// splitOutstanding returns what is left to pay on a split of the session's
+// open bill.
+func splitOutstanding(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+	billID primitive.ObjectID,
+	splitID primitive.ObjectID,
+) (int64, error) {
+	openBill, err := bill.FindOpen(ctx, client, sessionID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, errSplitNotFound
+		}
+		return 0, err
+	}
+	if openBill.ID != billID {
+		return 0, errSplitNotFound
+	}
+
+	for _, split := range openBill.Splits {
+		if split.ID != splitID {
+			continue
+		}
+		if split.PaidAt != nil {
+			return 0, nil
+		}
+
+		paid, err := utils.SumField(
+			ctx,
+			client.GetCollection(config.Env.DatabaseName, "payments"),
+			bson.D{{Key: "split_id", Value: splitID}},
+			"amount",
+		)
+		if err != nil {
+			return 0, err
+		}
+		return split.Amount - paid, nil
+	}
+
+	return 0, errSplitNotFound
+}
@@ -0,0 +1,130 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/bill"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func TestApplyTender(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     paymentRequest
+		outstanding int64
+		want        tenderAmounts
+		err         error
+	}{
+		{
+			name:        "cash with change",
+			request:     paymentRequest{Tender: TenderCash, Amount: 800, Tendered: 1000},
+			outstanding: 800,
+			want:        tenderAmounts{Amount: 800, Tendered: 1000, Change: 200},
+		},
+		{
+			name:        "cash covers part of the balance",
+			request:     paymentRequest{Tender: TenderCash, Tendered: 500},
+			outstanding: 800,
+			want:        tenderAmounts{Amount: 500, Tendered: 500},
+		},
+		{
+			name:        "cash handed over for the whole balance",
+			request:     paymentRequest{Tender: TenderCash, Tendered: 2000},
+			outstanding: 800,
+			want:        tenderAmounts{Amount: 800, Tendered: 2000, Change: 1200},
+		},
+		{
+			name:        "card is charged exactly",
+			request:     paymentRequest{Tender: TenderCard, Amount: 800, Tendered: 1000},
+			outstanding: 800,
+			want:        tenderAmounts{Amount: 800, Tendered: 800},
+		},
+		{
+			name:        "overpayment",
+			request:     paymentRequest{Tender: TenderCard, Amount: 900},
+			outstanding: 800,
+			err:         errOverpayment,
+		},
+		{
+			name:        "card tendered above the balance",
+			request:     paymentRequest{Tender: TenderCard, Tendered: 900},
+			outstanding: 800,
+			err:         errOverpayment,
+		},
+		{
+			name:        "cash short of the amount",
+			request:     paymentRequest{Tender: TenderCash, Amount: 800, Tendered: 500},
+			outstanding: 800,
+			err:         errUnderTender,
+		},
+		{
+			name:        "nothing given",
+			request:     paymentRequest{Tender: TenderCard},
+			outstanding: 800,
+			err:         errMissingValue,
+		},
+		{
+			name:        "already paid",
+			request:     paymentRequest{Tender: TenderCard, Amount: 100},
+			outstanding: 0,
+			err:         errNothingDue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTender(tt.request, tt.outstanding)
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSplitOutstanding(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	sessionID := primitive.NewObjectID()
+	billID := primitive.NewObjectID()
+	splitID := primitive.NewObjectID()
+
+	open := func(splits ...bill.Split) bson.D {
+		doc, _ := bson.Marshal(bill.Bill{ID: billID, SessionID: sessionID, Status: bill.StatusOpen, Splits: splits})
+		var d bson.D
+		_ = bson.Unmarshal(doc, &d)
+		return mtest.CreateCursorResponse(0, "db.bills", mtest.FirstBatch, d)
+	}
+	paid := func(total int64) bson.D {
+		return mtest.CreateCursorResponse(0, "db.payments", mtest.FirstBatch, bson.D{{Key: "total", Value: total}})
+	}
+
+	mt.Run("partly paid split", func(mt *mtest.T) {
+		mt.AddMockResponses(open(bill.Split{ID: splitID, Amount: 1000}), paid(400))
+
+		outstanding, err := splitOutstanding(context.Background(), db.NewMockMongoClient(mt.Coll), sessionID, billID, splitID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(600), outstanding)
+	})
+
+	mt.Run("unknown split", func(mt *mtest.T) {
+		mt.AddMockResponses(open(bill.Split{ID: primitive.NewObjectID(), Amount: 1000}))
+
+		_, err := splitOutstanding(context.Background(), db.NewMockMongoClient(mt.Coll), sessionID, billID, splitID)
+
+		assert.Equal(t, errSplitNotFound, err)
+	})
+
+	mt.Run("bill replaced", func(mt *mtest.T) {
+		mt.AddMockResponses(open(bill.Split{ID: splitID, Amount: 1000}))
+
+		_, err := splitOutstanding(context.Background(), db.NewMockMongoClient(mt.Coll), sessionID, primitive.NewObjectID(), splitID)
+
+		assert.Equal(t, errSplitNotFound, err)
+	})
+}
@@ -0,0 +1,98 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ESC/POS control sequences understood by common thermal printers.
+var (
+	escInit      = []byte{0x1b, 0x40}       // ESC @
+	escBoldOn    = []byte{0x1b, 0x45, 0x01} // ESC E 1
+	escBoldOff   = []byte{0x1b, 0x45, 0x00} // ESC E 0
+	escAlignLeft = []byte{0x1b, 0x61, 0x00} // ESC a 0
+	escAlignMid  = []byte{0x1b, 0x61, 0x01} // ESC a 1
+	gsSizeNormal = []byte{0x1d, 0x21, 0x00} // GS ! 0
+	gsSizeDouble = []byte{0x1d, 0x21, 0x11} // GS ! 17, double width and height
+	gsCut        = []byte{0x1d, 0x56, 0x42, 0x00}
+)
+
+// Builder assembles an ESC/POS byte stream. Text is printed in the
+// printer's default code page, so characters outside ASCII are replaced.
+type Builder struct {
+	buf bytes.Buffer
+}
+
+// NewBuilder starts a stream that resets the printer.
+func NewBuilder() *Builder {
+	b := &Builder{}
+	b.buf.Write(escInit)
+	return b
+}
+
+func (b *Builder) Bold(on bool) *Builder {
+	if on {
+		b.buf.Write(escBoldOn)
+	} else {
+		b.buf.Write(escBoldOff)
+	}
+	return b
+}
+
+func (b *Builder) Center(on bool) *Builder {
+	if on {
+		b.buf.Write(escAlignMid)
+	} else {
+		b.buf.Write(escAlignLeft)
+	}
+	return b
+}
+
+// Large switches to double width and height characters.
+func (b *Builder) Large(on bool) *Builder {
+	if on {
+		b.buf.Write(gsSizeDouble)
+	} else {
+		b.buf.Write(gsSizeNormal)
+	}
+	return b
+}
+
+// Line prints a line of text.
+func (b *Builder) Line(text string) *Builder {
+	b.buf.WriteString(ascii(text))
+	b.buf.WriteByte('\n')
+	return b
+}
+
+// Cut feeds the paper past the cutter and cuts it.
+func (b *Builder) Cut() *Builder {
+	b.buf.Write(gsCut)
+	return b
+}
+
+func (b *Builder) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// ascii strips accents and replaces other characters the printer cannot
+// print, so "Café crème" prints as "Cafe creme".
+func ascii(text string) string {
+	var out strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining accent
+		case r == '\n' || r == '\r' || r == 0x1b || r == 0x1d:
+			out.WriteByte(' ')
+		case r < 0x80:
+			out.WriteRune(r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
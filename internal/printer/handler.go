@@ -0,0 +1,106 @@
+package printer
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// GetStatus reports the state of every configured printer
+//
+// @Summary Get printer status
+// @Description Reports for every configured station whether its printer accepts connections, how many jobs are
+// @Description waiting or have failed, when it last printed and the last error.
+// @Tags printer
+// @Produce json
+// @Security bearerToken
+// @Success 200 {array} Status "Printer status per station"
+// @Failure 500  "Internal Server Error"
+// @Router /printer/status [get]
+func GetStatus(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection := client.GetCollection(config.Env.DatabaseName, "print_jobs")
+		ctx := c.Request.Context()
+
+		stations := make([]string, 0, len(config.Env.Printers))
+		for station := range config.Env.Printers {
+			stations = append(stations, station)
+		}
+		sort.Strings(stations)
+
+		statuses := make([]Status, 0, len(stations))
+		for _, station := range stations {
+			address, _ := printerAddress(station)
+			status := Status{Station: station, Address: address}
+
+			// A printer is online when it accepts connections
+			conn, err := net.DialTimeout("tcp", address, time.Second)
+			if err == nil {
+				status.Online = true
+				conn.Close()
+			}
+
+			status.Pending, err = collection.CountDocuments(ctx, bson.D{
+				{Key: "station", Value: station},
+				{Key: "status", Value: bson.M{"$in": []string{StatusPending, StatusPrinting}}},
+			})
+			if err != nil {
+				utils.HandleMongoError(c, err)
+				return
+			}
+
+			status.Failed, err = collection.CountDocuments(ctx, bson.D{
+				{Key: "station", Value: station},
+				{Key: "status", Value: StatusFailed},
+			})
+			if err != nil {
+				utils.HandleMongoError(c, err)
+				return
+			}
+
+			var last Job
+			err = collection.FindOne(
+				ctx,
+				bson.D{{Key: "station", Value: station}, {Key: "status", Value: StatusPrinted}},
+				options.FindOne().SetSort(bson.D{{Key: "printed_at", Value: -1}}),
+			).Decode(&last)
+			if err != nil && err != mongo.ErrNoDocuments {
+				utils.HandleMongoError(c, err)
+				return
+			}
+			status.LastPrintedAt = last.PrintedAt
+
+			var failing Job
+			err = collection.FindOne(
+				ctx,
+				bson.D{
+					{Key: "station", Value: station},
+					{Key: "status", Value: bson.M{"$ne": StatusPrinted}},
+					{Key: "last_error", Value: bson.M{"$exists": true}},
+				},
+				options.FindOne().SetSort(bson.D{{Key: "next_attempt_at", Value: -1}}),
+			).Decode(&failing)
+			if err != nil && err != mongo.ErrNoDocuments {
+				utils.HandleMongoError(c, err)
+				return
+			}
+			status.LastError = failing.LastError
+
+			statuses = append(statuses, status)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": statuses,
+		})
+	}
+}
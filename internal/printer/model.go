@@ -0,0 +1,73 @@
+package printer
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+const (
+	KindTicket  = "ticket"  // kitchen ticket, rendered when queued
+	KindReceipt = "receipt" // receipt of a session, rendered when printed
+
+	StatusPending  = "pending"
+	StatusPrinting = "printing"
+	StatusPrinted  = "printed"
+	StatusFailed   = "failed"
+
+	StationKitchen = "kitchen"
+	StationReceipt = "receipt"
+)
+
+// Job is a print job in the queue. Tickets carry their ESC/POS data, receipts
+// are rendered when they are sent so they show the session as it was closed.
+type Job struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"        json:"id"`
+	Kind          string             `bson:"kind"                 json:"kind"`
+	Station       string             `bson:"station"              json:"station"`
+	OrderID       primitive.ObjectID `bson:"order_id,omitempty"   json:"orderId,omitempty"`
+	SessionID     primitive.ObjectID `bson:"session_id,omitempty" json:"sessionId,omitempty"`
+	Data          []byte             `bson:"data,omitempty"       json:"-"`
+	Status        string             `bson:"status"               json:"status"`
+	Attempts      int64              `bson:"attempts"             json:"attempts"`
+	LastError     string             `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"      json:"nextAttemptAt"`
+	ClaimedUntil  *time.Time         `bson:"claimed_until,omitempty" json:"-"` // while being printed
+	CreatedAt     time.Time          `bson:"created_at"           json:"createdAt"`
+	PrintedAt     *time.Time         `bson:"printed_at,omitempty" json:"printedAt"`
+	Key           string             `bson:"key,omitempty"        json:"-"` // deduplication key of jobs queued more than once
+}
+
+// Ticket is a kitchen ticket for the lines of an order prepared at a station.
+type Ticket struct {
+	OrderID   primitive.ObjectID
+	Table     string
+	Service   string // eat_in or takeaway
+	CreatedAt time.Time
+	Items     []TicketItem
+}
+
+type TicketItem struct {
+	Name      string
+	Category  string
+	Quantity  uint8
+	Seat      uint8
+	Modifiers []string
+}
+
+// Renderer renders the ESC/POS data of jobs queued without it.
+type Renderer func(ctx context.Context, client db.IMongoClient, job Job) ([]byte, error)
+
+// Status is the state of a station's printer and its queue.
+type Status struct {
+	Station       string     `json:"station"`
+	Address       string     `json:"address"`
+	Online        bool       `json:"online"`
+	Pending       int64      `json:"pending"`
+	Failed        int64      `json:"failed"`
+	LastPrintedAt *time.Time `json:"lastPrintedAt"`
+	LastError     string     `json:"lastError,omitempty"`
+}
@@ -0,0 +1,207 @@
+package printer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// fakePrinter accepts connections like a raw TCP printer and hands over
+// everything written to it on one connection.
+func fakePrinter(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake printer: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func waitForPrint(t *testing.T, received <-chan []byte) []byte {
+	t.Helper()
+
+	select {
+	case data := <-received:
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatal("fake printer received nothing")
+		return nil
+	}
+}
+
+func TestSend(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		address, received := fakePrinter(t)
+
+		data := NewBuilder().Line("Hello").Cut().Bytes()
+		err := Send(context.Background(), address, data)
+
+		assert.NoError(t, err)
+		assert.Equal(t, data, waitForPrint(t, received))
+	})
+
+	t.Run("printer offline", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		err = Send(context.Background(), address, []byte("Hello"))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestPrintJob(t *testing.T) {
+	printers := config.Env.Printers
+	t.Cleanup(func() { config.Env.Printers = printers })
+
+	t.Run("sends to the station's printer", func(t *testing.T) {
+		address, received := fakePrinter(t)
+		config.Env.Printers = map[string]string{"bar": address}
+
+		job := Job{Kind: KindTicket, Station: "bar", Data: []byte("ticket")}
+		err := printJob(context.Background(), nil, job, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("ticket"), waitForPrint(t, received))
+	})
+
+	t.Run("station without printer", func(t *testing.T) {
+		config.Env.Printers = map[string]string{}
+
+		job := Job{Kind: KindTicket, Station: "bar", Data: []byte("ticket")}
+		err := printJob(context.Background(), nil, job, nil)
+
+		assert.EqualError(t, err, "no printer configured for station bar")
+	})
+}
+
+func TestProcessNext(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("nothing due", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		assert.False(t, processNext(context.Background(), db.NewMockMongoClient(mt.Coll), nil))
+
+		claim := mt.GetStartedEvent().Command
+		filter := claim.Lookup("query", "$or").Array()
+		assert.Equal(t, StatusPending, filter.Index(0).Value().Document().Lookup("status").StringValue())
+		assert.Equal(t, StatusPrinting, filter.Index(1).Value().Document().Lookup("status").StringValue())
+		_, claimed := claim.Lookup("update", "$set", "claimed_until").TimeOK()
+		assert.True(t, claimed)
+	})
+
+	mt.Run("updates the job while it is claimed", func(mt *mtest.T) {
+		printers := config.Env.Printers
+		mt.Cleanup(func() { config.Env.Printers = printers })
+		config.Env.Printers = map[string]string{}
+
+		claimedUntil := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+		job := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "kind", Value: KindTicket},
+			{Key: "station", Value: "bar"},
+			{Key: "status", Value: StatusPrinting},
+			{Key: "claimed_until", Value: claimedUntil},
+		}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: job}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		assert.True(t, processNext(context.Background(), db.NewMockMongoClient(mt.Coll), nil))
+
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, claimedUntil, update.Lookup("q", "claimed_until").Time())
+		// The station has no printer, so the job is tried again later
+		assert.Equal(t, StatusPending, update.Lookup("u", "$set", "status").StringValue())
+		_, released := update.Lookup("u", "$unset", "claimed_until").StringValueOK()
+		assert.True(t, released)
+	})
+}
+
+func TestRenderTicket(t *testing.T) {
+	ticket := Ticket{
+		OrderID:   primitive.NewObjectID(),
+		Table:     "Terrace 4",
+		Service:   "takeaway",
+		CreatedAt: time.Now(),
+		Items: []TicketItem{
+			{Name: "Café crème", Category: "coffee", Quantity: 2, Seat: 3, Modifiers: []string{"oat milk"}},
+		},
+	}
+
+	data := RenderTicket(StationKitchen, ticket)
+
+	assert.True(t, bytes.HasPrefix(data, escInit))
+	assert.True(t, bytes.HasSuffix(data, gsCut))
+	assert.Contains(t, string(data), "KITCHEN")
+	assert.Contains(t, string(data), "Terrace 4")
+	assert.Contains(t, string(data), "TAKEAWAY")
+	assert.Contains(t, string(data), "2 x Cafe creme")
+	assert.Contains(t, string(data), "Seat 3")
+	assert.Contains(t, string(data), "+ oat milk")
+}
+
+func TestRoute(t *testing.T) {
+	routes := config.Env.PrinterRoutes
+	t.Cleanup(func() { config.Env.PrinterRoutes = routes })
+
+	config.Env.PrinterRoutes = map[string]string{"drinks": "bar"}
+
+	assert.Equal(t, "bar", Route("drinks"))
+	assert.Equal(t, StationKitchen, Route("mains"))
+}
+
+func TestPrinterAddress(t *testing.T) {
+	printers := config.Env.Printers
+	t.Cleanup(func() { config.Env.Printers = printers })
+
+	config.Env.Printers = map[string]string{"kitchen": "10.0.0.50", "bar": "10.0.0.51:9101"}
+
+	address, ok := printerAddress("kitchen")
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.50:9100", address)
+
+	address, ok = printerAddress("bar")
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.51:9101", address)
+
+	_, ok = printerAddress("receipt")
+	assert.False(t, ok)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, backoff(1))
+	assert.Equal(t, 8*time.Second, backoff(3))
+	assert.Equal(t, time.Minute, backoff(10))
+}
@@ -0,0 +1,192 @@
+package printer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+const (
+	pollInterval = time.Second
+	sendTimeout  = 5 * time.Second
+	maxBackoff   = time.Minute
+	claimMargin  = 30 * time.Second // added to the send timeout for how long a job stays claimed
+)
+
+// Enqueue adds a job to the print queue to be sent as soon as possible. A job
+// with the key of one already queued is dropped.
+func Enqueue(ctx context.Context, client db.IMongoClient, job Job) error {
+	now := time.Now()
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.NextAttemptAt = now
+	job.CreatedAt = now
+
+	_, err := client.GetCollection(config.Env.DatabaseName, "print_jobs").InsertOne(ctx, job)
+	if job.Key != "" && mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// Send writes data to a raw TCP printer, usually on port 9100.
+func Send(ctx context.Context, address string, data []byte) error {
+	dialer := net.Dialer{Timeout: sendTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(sendTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+// Start sends queued jobs in the background until the context is cancelled.
+// A job is claimed while it is printed, and one left printing by an instance
+// that stopped is retried once its claim runs out.
+func Start(ctx context.Context, client db.IMongoClient, renderers map[string]Renderer) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for processNext(ctx, client, renderers) {
+				}
+			}
+		}
+	}()
+}
+
+// processNext claims the oldest job that is due, or whose claim ran out, and
+// tries to print it. It reports whether a job was claimed.
+func processNext(ctx context.Context, client db.IMongoClient, renderers map[string]Renderer) bool {
+	collection := client.GetCollection(config.Env.DatabaseName, "print_jobs")
+
+	now := time.Now()
+	var job Job
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "status", Value: StatusPending},
+				{Key: "next_attempt_at", Value: bson.M{"$lte": now}},
+			},
+			bson.D{
+				{Key: "status", Value: StatusPrinting},
+				{Key: "claimed_until", Value: bson.M{"$lt": now}},
+			},
+		}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusPrinting},
+			{Key: "claimed_until", Value: now.Add(sendTimeout + claimMargin)},
+		}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Printf("Failed to claim print job: %v", err)
+		}
+		return false
+	}
+
+	err = printJob(ctx, client, job, renderers)
+
+	update := bson.D{{Key: "status", Value: StatusPrinted}, {Key: "printed_at", Value: time.Now()}}
+	if err != nil {
+		job.Attempts++
+		update = bson.D{
+			{Key: "status", Value: StatusPending},
+			{Key: "attempts", Value: job.Attempts},
+			{Key: "last_error", Value: err.Error()},
+			{Key: "next_attempt_at", Value: time.Now().Add(backoff(job.Attempts))},
+		}
+		if job.Attempts >= config.Env.PrintRetries {
+			update[0].Value = StatusFailed
+		}
+	}
+
+	// A job whose claim ran out and was taken over is left to the new claim
+	result, err := collection.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: job.ID}, {Key: "claimed_until", Value: job.ClaimedUntil}},
+		bson.D{
+			{Key: "$set", Value: update},
+			{Key: "$unset", Value: bson.D{{Key: "claimed_until", Value: ""}}},
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to update print job %s: %v", job.ID.Hex(), err)
+	} else if result.MatchedCount == 0 {
+		log.Printf("Print job %s was claimed again before it was updated", job.ID.Hex())
+	}
+	return true
+}
+
+// printJob renders the job if needed and sends it to its station's printer.
+// Rendered data is kept on the job so retries print the same thing.
+func printJob(ctx context.Context, client db.IMongoClient, job Job, renderers map[string]Renderer) error {
+	address, ok := printerAddress(job.Station)
+	if !ok {
+		return fmt.Errorf("no printer configured for station %s", job.Station)
+	}
+
+	data := job.Data
+	if len(data) == 0 {
+		render, ok := renderers[job.Kind]
+		if !ok {
+			return fmt.Errorf("cannot render %s jobs", job.Kind)
+		}
+
+		var err error
+		data, err = render(ctx, client, job)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.GetCollection(config.Env.DatabaseName, "print_jobs").
+			UpdateByID(ctx, job.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "data", Value: data}}}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return Send(ctx, address, data)
+}
+
+// printerAddress returns the address of a station's printer, on port 9100
+// unless another port is configured.
+func printerAddress(station string) (string, bool) {
+	address, ok := config.Env.Printers[station]
+	if !ok {
+		return "", false
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "9100")
+	}
+	return address, true
+}
+
+// backoff doubles the wait after every failed attempt, up to a minute.
+func backoff(attempts int64) time.Duration {
+	wait := time.Second << min(attempts, 6)
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,87 @@
+package printer
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+// Route returns the station preparing items of a menu category.
+func Route(category string) string {
+	if station, ok := config.Env.PrinterRoutes[category]; ok {
+		return station
+	}
+	return StationKitchen
+}
+
+// Receipt returns the print job of a session's receipt, rendered when it is
+// printed, or none when no receipt printer is configured.
+func Receipt(sessionID primitive.ObjectID) []Job {
+	if _, ok := config.Env.Printers[StationReceipt]; !ok {
+		return nil
+	}
+	return []Job{{Kind: KindReceipt, Station: StationReceipt, SessionID: sessionID}}
+}
+
+// Tickets returns the print jobs of a kitchen ticket for every station
+// preparing lines of the order that has a configured printer.
+func Tickets(ticket Ticket) []Job {
+	byStation := make(map[string][]TicketItem)
+	var stations []string
+
+	for _, item := range ticket.Items {
+		station := Route(item.Category)
+		if _, ok := config.Env.Printers[station]; !ok {
+			continue
+		}
+		if _, seen := byStation[station]; !seen {
+			stations = append(stations, station)
+		}
+		byStation[station] = append(byStation[station], item)
+	}
+
+	jobs := make([]Job, 0, len(stations))
+	for _, station := range stations {
+		stationTicket := ticket
+		stationTicket.Items = byStation[station]
+
+		jobs = append(jobs, Job{
+			Kind:    KindTicket,
+			Station: station,
+			OrderID: ticket.OrderID,
+			Data:    RenderTicket(station, stationTicket),
+		})
+	}
+	return jobs
+}
+
+// RenderTicket renders a kitchen ticket in large print, with the table and
+// time at the top and each line's seat and modifiers under it.
+func RenderTicket(station string, ticket Ticket) []byte {
+	b := NewBuilder()
+
+	b.Center(true).Bold(true).Line(strings.ToUpper(station)).Bold(false)
+	b.Large(true).Line(ticket.Table).Large(false)
+	if ticket.Service == "takeaway" {
+		b.Bold(true).Line("TAKEAWAY").Bold(false)
+	}
+	b.Line(ticket.CreatedAt.Local().Format("2006-01-02 15:04"))
+	b.Line("Order " + ticket.OrderID.Hex())
+	b.Center(false).Line(strings.Repeat("-", 42))
+
+	for _, item := range ticket.Items {
+		b.Large(true).Line(fmt.Sprintf("%d x %s", item.Quantity, item.Name)).Large(false)
+		if item.Seat > 0 {
+			b.Line(fmt.Sprintf("    Seat %d", item.Seat))
+		}
+		for _, modifier := range item.Modifiers {
+			b.Bold(true).Line("    + " + modifier).Bold(false)
+		}
+	}
+
+	b.Line(strings.Repeat("-", 42)).Line("").Line("")
+	return b.Cut().Bytes()
+}
@@ -0,0 +1,83 @@
+package receipt
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// GetReceipt renders the receipt of a closed order
+//
+// @Summary Get the receipt of a closed order
+// @Description Renders the receipt of the table session a closed order belongs to, with its lines, discounts,
+// @Description tax breakdown, service charge and payments. The first print is the original, later ones are
+// @Description marked as a copy.
+// @Tags receipt
+// @Produce plain
+// @Produce html
+// @Produce application/pdf
+// @Param orderID path string true "Order ID"
+// @Param format query string false "Receipt format: 'text' (default, 80mm printers), 'html' or 'pdf'"
+// @Security bearerToken
+// @Success 200 {file} File "Receipt"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Order not found"
+// @Failure 409  "Order is not closed"
+// @Failure 500  "Internal Server Error"
+// @Router /receipt/{orderID} [get]
+func GetReceipt(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("orderID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", FormatText)
+		if format != FormatText && format != FormatHTML && format != FormatPDF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use text, html or pdf."})
+			return
+		}
+
+		receipt, err := loadReceipt(c.Request.Context(), client, orderID)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			case errNotClosed:
+				c.JSON(http.StatusConflict, gin.H{"error": "Order must be closed before printing its receipt"})
+			default:
+				utils.HandleMongoError(c, err)
+			}
+			return
+		}
+
+		switch format {
+		case FormatHTML:
+			page, err := renderHTML(receipt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render receipt"})
+				return
+			}
+			c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+		case FormatPDF:
+			pdf, err := renderPDF(receipt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render receipt"})
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%s.pdf"`, receipt.Number))
+			c.Data(http.StatusOK, "application/pdf", pdf)
+		default:
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", renderText(receipt))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package receipt
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"money":   formatMoney,
+	"rate":    formatRate,
+	"neg":     func(amount int64) int64 { return -amount },
+	"title":   func(s string) string { return strings.ToUpper(s[:1]) + s[1:] },
+	"upper":   strings.ToUpper,
+	"several": func(quantity uint8) bool { return quantity > 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.Number}}</title>
+<style>
+body { font-family: monospace; width: 72mm; margin: 0 auto; font-size: 12px; }
+h1 { font-size: 16px; text-align: center; margin: 4px 0; }
+.center { text-align: center; }
+.copy { text-align: center; font-weight: bold; border: 1px dashed #000; padding: 2px; }
+table { width: 100%; border-collapse: collapse; }
+td { vertical-align: top; padding: 1px 0; }
+td.amount { text-align: right; white-space: nowrap; }
+.detail td { padding-left: 12px; color: #444; }
+.total td { font-weight: bold; font-size: 14px; border-top: 1px solid #000; }
+hr { border: 0; border-top: 1px dashed #000; }
+</style>
+</head>
+<body>
+{{if .Copy}}<p class="copy">COPY</p>{{end}}
+<h1>{{upper .Name}}</h1>
+{{range .Address}}<div class="center">{{.}}</div>{{end}}
+{{if .TaxID}}<div class="center">Tax ID: {{.TaxID}}</div>{{end}}
+<hr>
+<table>
+{{if .Table}}<tr><td>Table</td><td class="amount">{{.Table}}</td></tr>{{end}}
+<tr><td>Receipt</td><td class="amount">{{.Number}}</td></tr>
+{{if not .ClosedAt.IsZero}}<tr><td>Date</td><td class="amount">{{.ClosedAt.Local.Format "2006-01-02 15:04"}}</td></tr>{{end}}
+</table>
+<hr>
+<table>
+{{range .Lines}}
+<tr><td>{{.Quantity}} x {{.Name}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{if several .Quantity}}<tr class="detail"><td>@ {{money .UnitPrice}}</td><td></td></tr>{{end}}
+{{range .Modifiers}}<tr class="detail"><td>+ {{.}}</td><td></td></tr>{{end}}
+{{with .Discount}}<tr class="detail"><td>{{.Label}}</td><td class="amount">{{money (neg .Amount)}}</td></tr>{{end}}
+{{end}}
+</table>
+<hr>
+<table>
+<tr><td>Subtotal</td><td class="amount">{{money .Subtotal}}</td></tr>
+{{range .Discounts}}<tr><td>{{.Label}}</td><td class="amount">{{money (neg .Amount)}}</td></tr>{{end}}
+{{if gt .Discount 0}}<tr><td>Total discounts</td><td class="amount">{{money (neg .Discount)}}</td></tr>{{end}}
+{{if and (not .TaxInclusive) (gt .TaxTotal 0)}}<tr><td>Tax</td><td class="amount">{{money .TaxTotal}}</td></tr>{{end}}
+{{with .Service}}<tr><td>{{.Label}}</td><td class="amount">{{money .Amount}}</td></tr>{{end}}
+<tr class="total"><td>TOTAL {{.Currency}}</td><td class="amount">{{money .Total}}</td></tr>
+</table>
+{{if .Taxes}}
+<hr>
+{{if .TaxInclusive}}<div>Prices include tax</div>{{end}}
+<table>
+{{range .Taxes}}<tr><td>{{.Name}} {{rate .Rate}} on {{money .Net}}</td><td class="amount">{{money .Tax}}</td></tr>{{end}}
+</table>
+{{end}}
+{{if .Payments}}
+<hr>
+<table>
+{{range .Payments}}
+<tr><td>{{title .Tender}}{{if .Reference}} {{.Reference}}{{end}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{if gt .Tip 0}}<tr class="detail"><td>Tip</td><td class="amount">{{money .Tip}}</td></tr>{{end}}
+{{if gt .Change 0}}<tr class="detail"><td>Tendered {{money .Tendered}}, change</td><td class="amount">{{money .Change}}</td></tr>{{end}}
+{{end}}
+<tr><td>Paid</td><td class="amount">{{money .Paid}}</td></tr>
+{{if gt .Tips 0}}<tr><td>Tips</td><td class="amount">{{money .Tips}}</td></tr>{{end}}
+{{if gt .Change 0}}<tr><td>Change</td><td class="amount">{{money .Change}}</td></tr>{{end}}
+</table>
+{{end}}
+<hr>
+{{if .Footer}}<p class="center">{{.Footer}}</p>{{end}}
+{{if .Copy}}<p class="copy">COPY</p>{{end}}
+</body>
+</html>
+`))
+
+// renderHTML lays out the receipt as an HTML page sized for 80mm paper, for
+// printing from a browser or sending by email.
+func renderHTML(r Receipt) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package receipt
+
+import (
+	"time"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+const (
+	FormatText = "text"
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// Receipt is everything printed on the receipt of a table session. Amounts
+// are in minor units.
+type Receipt struct {
+	Name      string
+	Address   []string
+	TaxID     string
+	Footer    string
+	Number    string // session ID, or order ID for orders placed without a session
+	Table     string
+	ClosedAt  time.Time
+	Currency  string
+	Copy      bool // set on reprints
+	Lines     []Line
+	Discounts []Adjustment // order-level discounts
+	Subtotal  int64        // before discounts
+	Discount  int64        // line and order discounts
+	Service   *Adjustment  // service charge, including any tax added on top
+	Taxes     []tax.TaxLine
+	TaxTotal  int64
+	// TaxInclusive is set when prices include tax, so the tax breakdown is
+	// for information and not added to the total
+	TaxInclusive bool
+	Total        int64
+	Payments     []Payment
+	Paid         int64
+	Tips         int64
+	Change       int64
+}
+
+// Line is an order line of the receipt.
+type Line struct {
+	Name      string
+	Quantity  uint8
+	UnitPrice int64
+	Amount    int64 // before the line's discount
+	Modifiers []string
+	Discount  *Adjustment
+}
+
+// Adjustment is a discount or charge printed as its own line.
+type Adjustment struct {
+	Label  string
+	Amount int64
+}
+
+// Payment is a tender taken for the session.
+type Payment struct {
+	Tender    string
+	Reference string
+	Amount    int64
+	Tendered  int64
+	Change    int64
+	Tip       int64
+}
@@ -0,0 +1,44 @@
+package receipt
+
+import (
+	"bytes"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// renderPDF prints the text receipt on a single 80mm wide page as tall as the
+// receipt, in a fixed width font so the columns line up.
+func renderPDF(r Receipt) ([]byte, error) {
+	const (
+		pageW   = 80.0
+		margin  = 4.0
+		lineH   = 3.6
+		fontPt  = 8.0
+		minPage = 80.0
+	)
+
+	lines := textLines(r)
+	pageH := max(float64(len(lines))*lineH+2*margin, minPage)
+
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: pageW, Ht: pageH},
+	})
+	pdf.SetTitle("Receipt "+r.Number, true)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, margin)
+	pdf.SetFont("Courier", "", fontPt)
+	pdf.AddPage()
+
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	for _, line := range lines {
+		pdf.CellFormat(0, lineH, translate(line), "", 1, "L", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,181 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+)
+
+// textWidth is the number of characters per line on 80mm thermal printers.
+const textWidth = 42
+
+// renderText lays out the receipt as plain text for 80mm printers.
+func renderText(r Receipt) []byte {
+	return []byte(strings.Join(textLines(r), "\n") + "\n")
+}
+
+// textLines lays out the receipt as fixed width lines. The PDF receipt is
+// printed from the same lines.
+func textLines(r Receipt) []string {
+	var lines []string
+	rule := strings.Repeat("-", textWidth)
+
+	if r.Copy {
+		lines = append(lines, center("*** COPY ***"), "")
+	}
+
+	lines = append(lines, center(strings.ToUpper(r.Name)))
+	for _, line := range r.Address {
+		lines = append(lines, center(line))
+	}
+	if r.TaxID != "" {
+		lines = append(lines, center("Tax ID: "+r.TaxID))
+	}
+	lines = append(lines, rule)
+
+	if r.Table != "" {
+		lines = append(lines, columns("Table", r.Table))
+	}
+	lines = append(lines, columns("Receipt", r.Number))
+	if !r.ClosedAt.IsZero() {
+		lines = append(lines, columns("Date", r.ClosedAt.Local().Format("2006-01-02 15:04")))
+	}
+	lines = append(lines, rule)
+
+	for _, line := range r.Lines {
+		lines = append(lines, columns(fmt.Sprintf("%d x %s", line.Quantity, line.Name), formatMoney(line.Amount)))
+		if line.Quantity > 1 {
+			lines = append(lines, "    @ "+formatMoney(line.UnitPrice))
+		}
+		for _, modifier := range line.Modifiers {
+			lines = append(lines, "    + "+modifier)
+		}
+		if line.Discount != nil {
+			lines = append(lines, columns("    "+line.Discount.Label, formatMoney(-line.Discount.Amount)))
+		}
+	}
+	lines = append(lines, rule)
+
+	lines = append(lines, columns("Subtotal", formatMoney(r.Subtotal)))
+	for _, discount := range r.Discounts {
+		lines = append(lines, columns(discount.Label, formatMoney(-discount.Amount)))
+	}
+	if r.Discount > 0 {
+		lines = append(lines, columns("Total discounts", formatMoney(-r.Discount)))
+	}
+	if !r.TaxInclusive && r.TaxTotal > 0 {
+		lines = append(lines, columns("Tax", formatMoney(r.TaxTotal)))
+	}
+	if r.Service != nil {
+		lines = append(lines, columns(r.Service.Label, formatMoney(r.Service.Amount)))
+	}
+	lines = append(lines, columns("TOTAL "+r.Currency, formatMoney(r.Total)))
+
+	if len(r.Taxes) > 0 {
+		lines = append(lines, rule)
+		if r.TaxInclusive {
+			lines = append(lines, "Prices include tax")
+		}
+		for _, tax := range r.Taxes {
+			lines = append(lines, columns(
+				fmt.Sprintf("%s %s on %s", tax.Name, formatRate(tax.Rate), formatMoney(tax.Net)),
+				formatMoney(tax.Tax),
+			))
+		}
+	}
+
+	if len(r.Payments) > 0 {
+		lines = append(lines, rule)
+		for _, p := range r.Payments {
+			label := strings.ToUpper(p.Tender[:1]) + p.Tender[1:]
+			if p.Reference != "" {
+				label += " " + p.Reference
+			}
+			if p.Tendered > p.Amount+p.Tip {
+				lines = append(lines, columns(label+" tendered", formatMoney(p.Tendered)))
+			} else {
+				lines = append(lines, columns(label, formatMoney(p.Amount+p.Tip)))
+			}
+			if p.Tip > 0 {
+				lines = append(lines, columns("    incl. tip", formatMoney(p.Tip)))
+			}
+		}
+		lines = append(lines, columns("Paid", formatMoney(r.Paid)))
+		if r.Tips > 0 {
+			lines = append(lines, columns("Tips", formatMoney(r.Tips)))
+		}
+		if r.Change > 0 {
+			lines = append(lines, columns("Change", formatMoney(r.Change)))
+		}
+	}
+
+	lines = append(lines, rule)
+	if r.Footer != "" {
+		lines = append(lines, center(r.Footer))
+	}
+	if r.Copy {
+		lines = append(lines, "", center("*** COPY ***"))
+	}
+
+	return lines
+}
+
+// columns prints the label on the left and the value on the right of a line,
+// cutting the label short when both do not fit.
+func columns(label, value string) string {
+	room := textWidth - utf8.RuneCountInString(value) - 1
+	if utf8.RuneCountInString(label) > room {
+		label = string([]rune(label)[:max(room, 0)])
+	}
+	pad := max(textWidth-utf8.RuneCountInString(label)-utf8.RuneCountInString(value), 1)
+	return label + strings.Repeat(" ", pad) + value
+}
+
+// center pads the text to the middle of a line.
+func center(text string) string {
+	n := utf8.RuneCountInString(text)
+	if n >= textWidth {
+		return text
+	}
+	return strings.Repeat(" ", (textWidth-n)/2) + text
+}
+
+// RenderESCPOS renders the receipt of a print job's session for thermal
+// printers. It is the printer's renderer for receipt jobs.
+func RenderESCPOS(ctx context.Context, client db.IMongoClient, job printer.Job) ([]byte, error) {
+	var last struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := client.GetCollection(config.Env.DatabaseName, "orders").FindOne(
+		ctx,
+		bson.D{
+			{Key: "session_id", Value: job.SessionID},
+			{Key: "closed_at", Value: bson.M{"$exists": true}},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "closed_at", Value: -1}}),
+	).Decode(&last)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := loadReceipt(ctx, client, last.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := printer.NewBuilder()
+	for _, line := range textLines(receipt) {
+		bold := strings.HasPrefix(line, "TOTAL") || strings.Contains(line, "*** COPY ***")
+		b.Bold(bold).Line(line)
+	}
+	return b.Bold(false).Line("").Line("").Cut().Bytes(), nil
+}
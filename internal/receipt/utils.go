@@ -0,0 +1,270 @@
+package receipt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/payment"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+var errNotClosed = errors.New("order must be closed before printing its receipt")
+
+// loadReceipt builds the receipt of the session an order belongs to from its
+// closed orders and payments. Orders placed without a session get a receipt
+// of their own. Every call counts as a print, so reprints are marked as a
+// copy.
+func loadReceipt(ctx context.Context, client db.IMongoClient, orderID primitive.ObjectID) (Receipt, error) {
+	ordersColl := client.GetCollection(config.Env.DatabaseName, "orders")
+
+	var ord order.Order
+	if err := ordersColl.FindOne(ctx, bson.D{{Key: "_id", Value: orderID}}).Decode(&ord); err != nil {
+		return Receipt{}, err
+	}
+	if ord.ClosedAt == nil {
+		return Receipt{}, errNotClosed
+	}
+
+	var tableSession *session.Session
+	orders := []order.Order{ord}
+	payments := []payment.Payment{}
+
+	if !ord.SessionID.IsZero() {
+		s, err := session.Find(ctx, client, ord.SessionID)
+		if err != nil {
+			return Receipt{}, err
+		}
+		tableSession = &s
+
+		cursor, err := ordersColl.Find(
+			ctx,
+			bson.D{
+				{Key: "session_id", Value: ord.SessionID},
+				{Key: "closed_at", Value: bson.M{"$exists": true}},
+			},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		)
+		if err != nil {
+			return Receipt{}, err
+		}
+		if err := cursor.All(ctx, &orders); err != nil {
+			return Receipt{}, err
+		}
+
+		cursor, err = client.GetCollection(config.Env.DatabaseName, "payments").Find(
+			ctx,
+			bson.D{{Key: "session_id", Value: ord.SessionID}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		)
+		if err != nil {
+			return Receipt{}, err
+		}
+		if err := cursor.All(ctx, &payments); err != nil {
+			return Receipt{}, err
+		}
+	}
+
+	var t table.Table
+	err := client.GetCollection(config.Env.DatabaseName, "tables").
+		FindOne(ctx, bson.D{{Key: "_id", Value: ord.TableID}}).Decode(&t)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return Receipt{}, err
+	}
+
+	receipt := build(orders, tableSession, payments)
+	receipt.Table = t.Name
+
+	// Prints are counted on the session, or the order when it has none
+	printed := ordersColl
+	printedID := ord.ID
+	if tableSession != nil {
+		printed = client.GetCollection(config.Env.DatabaseName, "sessions")
+		printedID = tableSession.ID
+	}
+
+	var prints struct {
+		ReceiptPrints int `bson:"receipt_prints"`
+	}
+	err = printed.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "_id", Value: printedID}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "receipt_prints", Value: 1}}}},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.D{{Key: "receipt_prints", Value: 1}}),
+	).Decode(&prints)
+	if err != nil {
+		return Receipt{}, err
+	}
+	receipt.Copy = prints.ReceiptPrints > 1
+
+	return receipt, nil
+}
+
+// build lays out the receipt of closed orders, the session they belong to,
+// if any, and its payments.
+func build(orders []order.Order, tableSession *session.Session, payments []payment.Payment) Receipt {
+	receipt := Receipt{
+		Name:    config.Env.CafeName,
+		Address: splitAddress(config.Env.CafeAddress),
+		TaxID:   config.Env.CafeTaxID,
+		Footer:  config.Env.ReceiptFooter,
+	}
+
+	if tableSession != nil {
+		receipt.Number = tableSession.ID.Hex()
+	} else if len(orders) > 0 {
+		receipt.Number = orders[0].ID.Hex()
+	}
+
+	taxes := newTaxTotals()
+
+	for i, ord := range orders {
+		if i == 0 {
+			receipt.TaxInclusive = ord.TaxInclusive
+		}
+		if ord.ClosedAt != nil && ord.ClosedAt.After(receipt.ClosedAt) {
+			receipt.ClosedAt = *ord.ClosedAt
+		}
+
+		for _, item := range ord.Items {
+			if receipt.Currency == "" {
+				receipt.Currency = item.MenuItem.Currency
+			}
+
+			line := Line{
+				Name:      item.MenuItem.Name,
+				Quantity:  item.Quantity,
+				UnitPrice: item.MenuItem.Price,
+				Amount:    item.Gross(),
+				Modifiers: item.Modifiers,
+			}
+			if item.Discount != nil {
+				line.Discount = &Adjustment{
+					Label:  discountLabel(*item.Discount),
+					Amount: item.Discount.Amount,
+				}
+			}
+			receipt.Lines = append(receipt.Lines, line)
+			receipt.Subtotal += item.Gross()
+		}
+
+		if ord.Discount != nil {
+			receipt.Discounts = append(receipt.Discounts, Adjustment{
+				Label:  discountLabel(*ord.Discount),
+				Amount: ord.Discount.Amount,
+			})
+		}
+
+		receipt.Discount += ord.DiscountTotal
+		receipt.TaxTotal += ord.TaxTotal
+		receipt.Total += ord.TotalPrice
+		taxes.add(ord.Taxes...)
+	}
+
+	if tableSession != nil && tableSession.ServiceCharge != nil {
+		charge := tableSession.ServiceCharge
+		receipt.Service = &Adjustment{
+			Label:  "Service charge " + formatRate(charge.Rate),
+			Amount: charge.Total,
+		}
+		receipt.TaxTotal += charge.TaxTotal
+		receipt.Total += charge.Total
+		taxes.add(charge.Taxes...)
+	}
+	receipt.Taxes = taxes.lines
+
+	for _, p := range payments {
+		receipt.Payments = append(receipt.Payments, Payment{
+			Tender:    p.Tender,
+			Reference: p.Reference,
+			Amount:    p.Amount,
+			Tendered:  p.Tendered,
+			Change:    p.Change,
+			Tip:       p.Tip,
+		})
+		receipt.Paid += p.Amount
+		receipt.Tips += p.Tip
+		receipt.Change += p.Change
+	}
+
+	return receipt
+}
+
+// taxTotals sums tax lines per rate, keeping the order rates first appear in.
+type taxTotals struct {
+	lines []tax.TaxLine
+	index map[string]int
+}
+
+func newTaxTotals() *taxTotals {
+	return &taxTotals{index: make(map[string]int)}
+}
+
+func (t *taxTotals) add(lines ...tax.TaxLine) {
+	for _, line := range lines {
+		key := fmt.Sprintf("%s/%d", line.Code, line.Rate)
+		if i, ok := t.index[key]; ok {
+			t.lines[i].Net += line.Net
+			t.lines[i].Tax += line.Tax
+			t.lines[i].Gross += line.Gross
+			continue
+		}
+		t.index[key] = len(t.lines)
+		t.lines = append(t.lines, line)
+	}
+}
+
+// discountLabel describes a discount the way it is printed, e.g.
+// "10% off (promo)" or "Comp (staff meal)".
+func discountLabel(discount order.Discount) string {
+	reason := strings.ReplaceAll(discount.Reason, "_", " ")
+
+	switch discount.Type {
+	case order.DiscountPercent:
+		return fmt.Sprintf("%d%% off (%s)", discount.Value, reason)
+	case order.DiscountComp:
+		return fmt.Sprintf("Comp (%s)", reason)
+	default:
+		return fmt.Sprintf("Discount (%s)", reason)
+	}
+}
+
+// formatMoney formats an amount in minor units with two decimals.
+func formatMoney(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// formatRate formats a rate in basis points as a percentage, e.g. "12.5%".
+func formatRate(rate int64) string {
+	percent := fmt.Sprintf("%d.%02d", rate/100, rate%100)
+	percent = strings.TrimRight(strings.TrimRight(percent, "0"), ".")
+	return percent + "%"
+}
+
+func splitAddress(address string) []string {
+	var lines []string
+	for _, line := range strings.Split(address, "|") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
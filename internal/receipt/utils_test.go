@@ -0,0 +1,127 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/payment"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+func testReceipt() Receipt {
+	coffee := menu.MenuItem{Name: "Flat white", Price: 350, Currency: "EUR"}
+	cake := menu.MenuItem{Name: "Carrot cake", Price: 500, Currency: "EUR"}
+	standard := tax.TaxLine{Code: "STD", Name: "VAT", Rate: 2000}
+
+	first := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+
+	orders := []order.Order{
+		{
+			Items: []order.OrderItem{
+				{MenuItem: coffee, Quantity: 2, Modifiers: []string{"oat milk"}},
+				{MenuItem: cake, Quantity: 1, Discount: &order.Discount{
+					Type: order.DiscountComp, Reason: "staff_meal", Amount: 500,
+				}},
+			},
+			DiscountTotal: 500,
+			TaxInclusive:  true,
+			Taxes:         []tax.TaxLine{withAmounts(standard, 583, 117)},
+			TaxTotal:      117,
+			TotalPrice:    700,
+			ClosedAt:      &first,
+		},
+		{
+			Items:         []order.OrderItem{{MenuItem: coffee, Quantity: 1}},
+			Discount:      &order.Discount{Type: order.DiscountPercent, Value: 10, Reason: "promo", Amount: 35},
+			DiscountTotal: 35,
+			TaxInclusive:  true,
+			Taxes:         []tax.TaxLine{withAmounts(standard, 263, 52)},
+			TaxTotal:      52,
+			TotalPrice:    315,
+			ClosedAt:      &last,
+		},
+	}
+
+	tableSession := &session.Session{
+		ID:            primitive.NewObjectID(),
+		ServiceCharge: &session.ServiceCharge{Rate: 1250, Amount: 127, Total: 127},
+	}
+
+	payments := []payment.Payment{
+		{Tender: payment.TenderCash, Amount: 500, Tendered: 1000, Change: 500},
+		{Tender: payment.TenderCard, Amount: 642, Tendered: 742, Tip: 100, Reference: "1234"},
+	}
+
+	return build(orders, tableSession, payments)
+}
+
+func withAmounts(line tax.TaxLine, net, taxed int64) tax.TaxLine {
+	line.Net, line.Tax, line.Gross = net, taxed, net+taxed
+	return line
+}
+
+func TestBuild(t *testing.T) {
+	r := testReceipt()
+
+	assert.Len(t, r.Lines, 3)
+	assert.Equal(t, "EUR", r.Currency)
+	assert.Equal(t, time.Date(2025, 3, 14, 13, 0, 0, 0, time.UTC), r.ClosedAt)
+	assert.Equal(t, "Comp (staff meal)", r.Lines[1].Discount.Label)
+	assert.Equal(t, []Adjustment{{Label: "10% off (promo)", Amount: 35}}, r.Discounts)
+	assert.Equal(t, int64(1550), r.Subtotal)
+	assert.Equal(t, int64(535), r.Discount)
+	assert.Equal(t, &Adjustment{Label: "Service charge 12.5%", Amount: 127}, r.Service)
+	assert.Equal(t, int64(1142), r.Total)
+	// Tax at the same rate is summed across orders
+	assert.Equal(t, []tax.TaxLine{withAmounts(tax.TaxLine{Code: "STD", Name: "VAT", Rate: 2000}, 846, 169)}, r.Taxes)
+	assert.Equal(t, int64(1142), r.Paid)
+	assert.Equal(t, int64(100), r.Tips)
+	assert.Equal(t, int64(500), r.Change)
+}
+
+func TestTextLines(t *testing.T) {
+	r := testReceipt()
+	r.Copy = true
+
+	lines := textLines(r)
+
+	for _, line := range lines {
+		assert.LessOrEqual(t, len([]rune(line)), textWidth, line)
+	}
+	text := strings.Join(lines, "\n")
+	assert.True(t, strings.HasPrefix(lines[0], " ") && strings.Contains(lines[0], "*** COPY ***"))
+	assert.Contains(t, text, "    @ 3.50")
+	assert.Contains(t, text, "    + oat milk")
+	assert.Contains(t, text, "Prices include tax")
+	assert.Contains(t, text, columns("Cash tendered", "10.00"))
+	assert.Contains(t, text, columns("Card 1234", "7.42"))
+	assert.Contains(t, text, columns("TOTAL EUR", "11.42"))
+}
+
+func TestFormatMoney(t *testing.T) {
+	assert.Equal(t, "12.05", formatMoney(1205))
+	assert.Equal(t, "0.07", formatMoney(7))
+	assert.Equal(t, "-3.50", formatMoney(-350))
+}
+
+func TestFormatRate(t *testing.T) {
+	assert.Equal(t, "20%", formatRate(2000))
+	assert.Equal(t, "12.5%", formatRate(1250))
+	assert.Equal(t, "7.25%", formatRate(725))
+}
+
+func TestColumns(t *testing.T) {
+	assert.Equal(t, "Subtotal"+strings.Repeat(" ", 29)+"15.50", columns("Subtotal", "15.50"))
+	// Labels too long for the line are cut short
+	long := columns(strings.Repeat("x", 50), "1.00")
+	assert.Len(t, long, textWidth)
+	assert.True(t, strings.HasSuffix(long, " 1.00"))
+}
@@ -0,0 +1,297 @@
+package refund
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// CreateRefund refunds a closed order
+//
+// @Summary Refund a closed order
+// @Description Refunds a closed order in full, or the given lines of it, to the tender of one of its session's payments.
+// @Description Cashiers need the credentials of an admin in the approval field. The refund is recorded as negative revenue.
+// @Tags refund
+// @Accept json
+// @Produce json
+// @Param orderID path string true "Order ID"
+// @Param refund body refundRequest true "Refund details"
+// @Security bearerToken
+// @Success 201 {object} Refund "Refund created successfully"
+// @Failure 400 "Invalid request"
+// @Failure 403 "Manager approval required or denied"
+// @Failure 404 "Order or payment not found"
+// @Failure 409 "Order not closed, already refunded or refund exceeds the payment"
+// @Failure 500 "Internal Server Error"
+// @Router /refund/{orderID} [post]
+func CreateRefund(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("orderID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request refundRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateRefund(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var paymentID primitive.ObjectID
+		if request.PaymentID != "" {
+			paymentID, err = primitive.ObjectIDFromHex(request.PaymentID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Payment ID"})
+				return
+			}
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		approverID, ok := auth.ApproveAction(c, client, request.Approval)
+		if !ok {
+			return
+		}
+
+		collection := client.GetCollection(config.Env.DatabaseName, "refunds")
+
+		var refund Refund
+		err = db.WithTransaction(c.Request.Context(), client, func(sc mongo.SessionContext) error {
+			var ord order.Order
+			err := client.GetCollection(config.Env.DatabaseName, "orders").
+				FindOne(sc, bson.D{{Key: "_id", Value: orderID}}).
+				Decode(&ord)
+			if err != nil {
+				return err
+			}
+			if ord.ClosedAt == nil {
+				return errNotClosed
+			}
+
+			var previous []Refund
+			cursor, err := collection.Find(sc, bson.D{{Key: "order_id", Value: orderID}})
+			if err != nil {
+				return err
+			}
+			if err := cursor.All(sc, &previous); err != nil {
+				return err
+			}
+
+			remaining := remainingItems(ord, previous)
+			if len(remaining) == 0 {
+				return errNothingToRefund
+			}
+
+			items := remaining
+			if len(request.Items) > 0 {
+				items, err = selectItems(remaining, request.Items)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Lines are refunded at what was charged for them after discounts
+			amount := int64(0)
+			for _, item := range items {
+				amount += item.Net()
+			}
+
+			// with their share of any order-level discount taken off
+			if ord.Discount != nil {
+				if linesNet := ord.GrossPrice - ord.DiscountTotal + ord.Discount.Amount; linesNet > 0 {
+					amount -= ord.Discount.Amount * amount / linesNet
+				}
+			}
+
+			// and their share of tax added on top of tax-exclusive prices
+			if !ord.TaxInclusive && ord.TaxTotal > 0 {
+				if net := ord.GrossPrice - ord.DiscountTotal; net > 0 {
+					amount += ord.TaxTotal * amount / net
+				}
+			}
+
+			p, err := findPayment(sc, client, ord, paymentID)
+			if err != nil {
+				return err
+			}
+
+			refunded, err := refundedAgainst(sc, client, p.ID)
+			if err != nil {
+				return err
+			}
+			if amount > p.Amount-refunded {
+				return errExceedsPayment
+			}
+			if err := countRefund(sc, client, ord.ID, p.ID, amount); err != nil {
+				return err
+			}
+
+			refund = Refund{
+				OrderID:    ord.ID,
+				TableID:    ord.TableID,
+				SessionID:  ord.SessionID,
+				PaymentID:  p.ID,
+				Tender:     p.Tender,
+				Items:      items,
+				Full:       len(request.Items) == 0,
+				Amount:     -amount,
+				Currency:   p.Currency,
+				Reason:     request.Reason,
+				CreatedAt:  time.Now(),
+				CreatedBy:  userID,
+				ApprovedBy: approverID,
+			}
+
+			result, err := collection.InsertOne(sc, refund)
+			if err != nil {
+				return err
+			}
+			refund.ID = result.InsertedID.(primitive.ObjectID)
+			return nil
+		})
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			case errPaymentNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errItemNotRefundable:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errNotClosed, errNothingToRefund, errNoPayment, errExceedsPayment:
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				utils.HandleMongoError(c, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Refund created successfully",
+			"id":      refund.ID,
+			"data":    refund,
+		})
+	}
+}
+
+// GetRefunds lists refunds
+//
+// @Summary Get refunds
+// @Description Retrieves refunds with optional filters for admin and cashier roles
+// @Tags refund
+// @Produce json
+// @Param order query string false "Filter by order ID"
+// @Param payment query string false "Filter by payment ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of refunds per page (default: 20)"
+// @Security bearerToken
+// @Success 200 {array} Refund "List of refunds"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Internal Server Error"
+// @Router /refund [get]
+func GetRefunds(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refunds []Refund
+
+		// Get the collection from the database
+		collection := client.GetCollection(config.Env.DatabaseName, "refunds")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number."})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit number."})
+			return
+		}
+
+		query := bson.D{}
+
+		if orderParam := c.Query("order"); orderParam != "" {
+			orderID, err := primitive.ObjectIDFromHex(orderParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Order ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "order_id", Value: orderID})
+		}
+
+		if paymentParam := c.Query("payment"); paymentParam != "" {
+			paymentID, err := primitive.ObjectIDFromHex(paymentParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Payment ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "payment_id", Value: paymentID})
+		}
+
+		findOptions := options.Find()
+		findOptions.SetSkip(int64((page - 1) * limit))
+		findOptions.SetLimit(int64(limit))
+		findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &refunds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse database response.",
+			})
+			return
+		}
+
+		totalCount, err := collection.CountDocuments(ctx, query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": refunds,
+			"meta": gin.H{
+				"total":      totalCount,
+				"page":       page,
+				"limit":      limit,
+				"totalPages": int(math.Ceil(float64(totalCount) / float64(limit))),
+			},
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package refund
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+)
+
+// Refund gives money back for some or all lines of a closed order. It is
+// paid out with the tender of the payment it refunds and is recorded as a
+// negative revenue entry.
+type Refund struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"        json:"id"`
+	OrderID    primitive.ObjectID `bson:"order_id"             json:"orderId"`
+	TableID    primitive.ObjectID `bson:"table_id"             json:"tableId"`
+	SessionID  primitive.ObjectID `bson:"session_id,omitempty" json:"sessionId"`
+	PaymentID  primitive.ObjectID `bson:"payment_id"           json:"paymentId"`
+	Tender     string             `bson:"tender"               json:"tender"`
+	Items      []RefundItem       `bson:"items"                json:"items"`
+	Full       bool               `bson:"full"                 json:"full"`
+	Amount     int64              `bson:"amount"               json:"amount"` // negative, in minor units
+	Currency   string             `bson:"currency"             json:"currency"`
+	Reason     string             `bson:"reason"               json:"reason"`
+	CreatedAt  time.Time          `bson:"created_at"           json:"createdAt"`
+	CreatedBy  primitive.ObjectID `bson:"created_by"           json:"createdBy"`
+	ApprovedBy primitive.ObjectID `bson:"approved_by"          json:"approvedBy"`
+}
+
+// RefundItem is a quantity of one line of the refunded order.
+type RefundItem struct {
+	Line            int `bson:"line" json:"line"` // index of the line in the order's items
+	order.OrderItem `bson:",inline"`
+}
+
+type refundRequest struct {
+	Items     []refundItemRequest `json:"items"     validate:"omitempty,dive"` // empty refunds everything not yet refunded
+	Reason    string              `json:"reason"    validate:"required,min=3,max=200"`
+	PaymentID string              `json:"paymentId"` // defaults to the latest payment of the order's session
+	Approval  *auth.Approval      `json:"approval"`  // required unless an admin makes the refund
+}
+
+type refundItemRequest struct {
+	Line     int   `json:"line"     validate:"gte=0"` // index of the line in the order's items
+	Quantity uint8 `json:"quantity" validate:"required,gt=0"`
+}
@@ -0,0 +1,181 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/payment"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+func validateRefund(v *validator.Validate, request interface{}) error {
+	// Perform validation
+	if err := v.Struct(request); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			fmt.Println(err)
+			return nil
+		}
+
+		validationErrors := err.(validator.ValidationErrors)
+		for _, fieldErr := range validationErrors {
+			switch fieldErr.Tag() {
+			case "required":
+				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "min":
+				return fmt.Errorf("%s must be at least %s characters", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				return fmt.Errorf("%s must be at most %s characters", fieldErr.Field(), fieldErr.Param())
+			case "gt":
+				return fmt.Errorf("%s must be greater than %s", fieldErr.Field(), fieldErr.Param())
+			default:
+				return fmt.Errorf("%s is invalid", fieldErr.Field())
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	errNotClosed         = errors.New("only closed orders can be refunded")
+	errNothingToRefund   = errors.New("order has already been refunded in full")
+	errNoPayment         = errors.New("no payment found to refund")
+	errExceedsPayment    = errors.New("refund exceeds what is left of the payment")
+	errPaymentNotFound   = errors.New("payment not found for this order")
+	errItemNotRefundable = errors.New("item was not ordered or has already been refunded")
+)
+
+// remainingItems returns the lines of an order that have not been refunded
+// yet by earlier refunds, with what is left of their quantity.
+func remainingItems(ord order.Order, previous []Refund) []RefundItem {
+	refunded := make(map[int]uint8)
+	for _, refund := range previous {
+		for _, item := range refund.Items {
+			refunded[item.Line] += item.Quantity
+		}
+	}
+
+	remaining := []RefundItem{}
+	for line, item := range ord.Items {
+		if done := refunded[line]; item.Quantity > done {
+			remaining = append(remaining, RefundItem{Line: line, OrderItem: item.Take(item.Quantity - done)})
+		}
+	}
+	return remaining
+}
+
+// selectItems picks the requested quantities from the refundable lines.
+func selectItems(remaining []RefundItem, requests []refundItemRequest) ([]RefundItem, error) {
+	left := make(map[int]RefundItem, len(remaining))
+	for _, item := range remaining {
+		left[item.Line] = item
+	}
+
+	selected := []RefundItem{}
+	for _, request := range requests {
+		item, ok := left[request.Line]
+		if !ok || request.Quantity > item.Quantity {
+			return nil, errItemNotRefundable
+		}
+
+		selected = append(selected, RefundItem{Line: item.Line, OrderItem: item.Take(request.Quantity)})
+		left[item.Line] = RefundItem{Line: item.Line, OrderItem: item.Take(item.Quantity - request.Quantity)}
+	}
+	return selected, nil
+}
+
+// findPayment returns the payment a refund is paid out against. Without an
+// explicit payment the latest payment of the order's session is used.
+func findPayment(
+	ctx context.Context,
+	client db.IMongoClient,
+	ord order.Order,
+	paymentID primitive.ObjectID,
+) (payment.Payment, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "payments")
+
+	var p payment.Payment
+	if !paymentID.IsZero() {
+		err := collection.FindOne(ctx, bson.D{
+			{Key: "_id", Value: paymentID},
+			{Key: "session_id", Value: ord.SessionID},
+		}).Decode(&p)
+		if err == mongo.ErrNoDocuments {
+			return p, errPaymentNotFound
+		}
+		return p, err
+	}
+
+	err := collection.FindOne(
+		ctx,
+		bson.D{{Key: "session_id", Value: ord.SessionID}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return p, errNoPayment
+	}
+	return p, err
+}
+
+// refundedAgainst returns how much has already been refunded against a
+// payment, as a positive amount.
+func refundedAgainst(
+	ctx context.Context,
+	client db.IMongoClient,
+	paymentID primitive.ObjectID,
+) (int64, error) {
+	refunded, err := utils.SumField(
+		ctx,
+		client.GetCollection(config.Env.DatabaseName, "refunds"),
+		bson.D{{Key: "payment_id", Value: paymentID}},
+		"amount",
+	)
+	return -refunded, err
+}
+
+// countRefund adds a refund to what was refunded of the payment and of the
+// order. Refunds count themselves inside their transaction, so two refunds of
+// the same payment or order write the same document and one of them is
+// retried with the other's refund in view. It returns errExceedsPayment when
+// the payment can't cover the amount.
+func countRefund(
+	ctx context.Context,
+	client db.IMongoClient,
+	orderID primitive.ObjectID,
+	paymentID primitive.ObjectID,
+	amount int64,
+) error {
+	result, err := client.GetCollection(config.Env.DatabaseName, "payments").UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: paymentID},
+			{Key: "$expr", Value: bson.M{"$lte": bson.A{
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded", 0}}, amount}},
+				"$amount",
+			}}},
+		},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "refunded", Value: amount}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errExceedsPayment
+	}
+
+	_, err = client.GetCollection(config.Env.DatabaseName, "orders").UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: orderID}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "refunded", Value: amount}}}},
+	)
+	return err
+}
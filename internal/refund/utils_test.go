@@ -0,0 +1,149 @@
+package refund
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+)
+
+// testOrder has two lines of the same coffee for the same seat, one of them
+// half price, and a cake.
+func testOrder() order.Order {
+	coffee := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Coffee", Price: 400}
+	cake := menu.MenuItem{ID: primitive.NewObjectID(), Name: "Cake", Price: 600}
+
+	return order.Order{Items: []order.OrderItem{
+		{MenuItem: coffee, Quantity: 2, Seat: 1},
+		{MenuItem: coffee, Quantity: 2, Seat: 1, Discount: &order.Discount{
+			Type: order.DiscountPercent, Value: 50, Amount: 400,
+		}},
+		{MenuItem: cake, Quantity: 1},
+	}}
+}
+
+func quantities(items []RefundItem) map[int]uint8 {
+	lines := make(map[int]uint8)
+	for _, item := range items {
+		lines[item.Line] += item.Quantity
+	}
+	return lines
+}
+
+func TestRemainingItems(t *testing.T) {
+	ord := testOrder()
+
+	t.Run("nothing refunded", func(t *testing.T) {
+		remaining := remainingItems(ord, nil)
+
+		assert.Equal(t, map[int]uint8{0: 2, 1: 2, 2: 1}, quantities(remaining))
+	})
+
+	t.Run("lines are told apart", func(t *testing.T) {
+		previous := []Refund{{Items: []RefundItem{{Line: 1, OrderItem: ord.Items[1].Take(1)}}}}
+
+		remaining := remainingItems(ord, previous)
+
+		assert.Equal(t, map[int]uint8{0: 2, 1: 1, 2: 1}, quantities(remaining))
+		// The discounted line keeps what is left of its own discount
+		assert.Equal(t, int64(200), remaining[1].Discount.Amount)
+		assert.Nil(t, remaining[0].Discount)
+	})
+
+	t.Run("refunded lines are left out", func(t *testing.T) {
+		previous := []Refund{
+			{Items: []RefundItem{{Line: 2, OrderItem: ord.Items[2]}}},
+			{Items: []RefundItem{{Line: 0, OrderItem: ord.Items[0].Take(1)}}},
+			{Items: []RefundItem{{Line: 0, OrderItem: ord.Items[0].Take(1)}}},
+		}
+
+		remaining := remainingItems(ord, previous)
+
+		assert.Equal(t, map[int]uint8{1: 2}, quantities(remaining))
+	})
+
+	t.Run("everything refunded", func(t *testing.T) {
+		previous := []Refund{{Items: remainingItems(ord, nil)}}
+
+		assert.Empty(t, remainingItems(ord, previous))
+	})
+}
+
+func TestSelectItems(t *testing.T) {
+	ord := testOrder()
+	remaining := remainingItems(ord, nil)
+
+	t.Run("picks the requested line", func(t *testing.T) {
+		selected, err := selectItems(remaining, []refundItemRequest{{Line: 1, Quantity: 1}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[int]uint8{1: 1}, quantities(selected))
+		assert.Equal(t, int64(200), selected[0].Net())
+	})
+
+	t.Run("the same line twice", func(t *testing.T) {
+		selected, err := selectItems(remaining, []refundItemRequest{{Line: 0, Quantity: 1}, {Line: 0, Quantity: 1}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[int]uint8{0: 2}, quantities(selected))
+	})
+
+	t.Run("more than is left", func(t *testing.T) {
+		_, err := selectItems(remaining, []refundItemRequest{{Line: 0, Quantity: 2}, {Line: 0, Quantity: 1}})
+
+		assert.Equal(t, errItemNotRefundable, err)
+	})
+
+	t.Run("line already refunded", func(t *testing.T) {
+		left := remainingItems(ord, []Refund{{Items: []RefundItem{{Line: 2, OrderItem: ord.Items[2]}}}})
+
+		_, err := selectItems(left, []refundItemRequest{{Line: 2, Quantity: 1}})
+
+		assert.Equal(t, errItemNotRefundable, err)
+	})
+
+	t.Run("unknown line", func(t *testing.T) {
+		_, err := selectItems(remaining, []refundItemRequest{{Line: 5, Quantity: 1}})
+
+		assert.Equal(t, errItemNotRefundable, err)
+	})
+}
+
+func TestCountRefund(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	orderID := primitive.NewObjectID()
+	paymentID := primitive.NewObjectID()
+
+	mt.Run("counted on the payment and the order", func(mt *mtest.T) {
+		updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		mt.AddMockResponses(updated, updated)
+
+		err := countRefund(context.Background(), db.NewMockMongoClient(mt.Coll), orderID, paymentID, 700)
+
+		assert.NoError(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, paymentID, update.Lookup("q", "_id").ObjectID())
+		assert.Equal(t, "$amount", update.Lookup("q", "$expr", "$lte").Array().Index(1).Value().StringValue())
+		assert.Equal(t, int64(700), update.Lookup("u", "$inc", "refunded").Int64())
+		update = mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, orderID, update.Lookup("q", "_id").ObjectID())
+		assert.Equal(t, int64(700), update.Lookup("u", "$inc", "refunded").Int64())
+	})
+
+	mt.Run("more than is left of the payment", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+
+		err := countRefund(context.Background(), db.NewMockMongoClient(mt.Coll), orderID, paymentID, 700)
+
+		assert.Equal(t, errExceedsPayment, err)
+		mt.GetStartedEvent()
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+}
@@ -7,18 +7,32 @@ import (
 
 	_ "github.com/kerimcanbalkan/cafe-orderAPI/docs"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/bill"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/idempotency"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/menu"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/order"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/payment"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/printer"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/receipt"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/refund"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/service"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/user"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/webhook"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/ws"
 )
 
 // SetupRoutes initializes and registers all API routes and middleware for the Gin engine.
 func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 	r.Use(CORSMiddleware())
 
+	// Tokens are checked against the database for revoked logins
+	auth.Init(client)
+
 	// Documentation
 	r.GET("api/v1/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -34,7 +48,7 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 	// Order Routes
 	orderGroup := r.Group("/api/v1/order")
 	{
-		orderGroup.POST("/:tableID", order.CreateOrder(client))
+		orderGroup.POST("/:tableID", idempotency.Middleware(client), order.CreateOrder(client))
 		orderGroup.GET("/active/:tableID", order.GetActiveOrdersByTableID(client))
 		orderGroup.GET(
 			"",
@@ -46,6 +60,26 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
 			order.UpdateOrder(client),
 		)
+		orderGroup.GET(
+			"/:id/history",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			order.GetHistory(client),
+		)
+		orderGroup.POST(
+			"/discount/:id",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			order.ApplyDiscount(client),
+		)
+		orderGroup.DELETE(
+			"/discount/:id",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			order.RemoveDiscount(client),
+		)
+		orderGroup.POST(
+			"/void/:id",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			order.VoidItems(client),
+		)
 		orderGroup.PATCH(
 			"/serve/:id",
 			auth.Authenticate([]string{"admin", "waiter"}),
@@ -54,8 +88,24 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 		orderGroup.PATCH(
 			"/close/:tableID",
 			auth.Authenticate([]string{"admin", "cashier"}),
+			idempotency.Middleware(client),
 			order.CloseOrder(client),
 		)
+		orderGroup.PATCH(
+			"/move",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			order.MoveTable(client),
+		)
+		orderGroup.PATCH(
+			"/transfer",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			order.TransferItems(client),
+		)
+		orderGroup.PATCH(
+			"/merge",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			order.MergeTables(client),
+		)
 		orderGroup.GET(
 			"/stats",
 			auth.Authenticate([]string{"admin"}),
@@ -63,6 +113,154 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 		)
 	}
 
+	// Bill Routes
+	billGroup := r.Group("/api/v1/bill")
+	{
+		billGroup.GET(
+			"/preview/:tableID",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			bill.GetBillPreview(client),
+		)
+		billGroup.POST(
+			"/:tableID",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			bill.SplitBill(client),
+		)
+		billGroup.GET(
+			"/:id",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			bill.GetBillById(client),
+		)
+		billGroup.DELETE(
+			"/:id",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			bill.CancelBill(client),
+		)
+		billGroup.PATCH(
+			"/:id/split/:splitID/close",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			bill.CloseSplit(client),
+		)
+	}
+
+	// Payment Routes
+	paymentGroup := r.Group("/api/v1/payment")
+	{
+		paymentGroup.GET("", auth.Authenticate([]string{"admin", "cashier"}), payment.GetPayments(client))
+		paymentGroup.GET("/tips", auth.Authenticate([]string{"admin"}), payment.GetTipsReport(client))
+		paymentGroup.GET(
+			"/balance/:tableID",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			payment.GetBalance(client),
+		)
+		paymentGroup.POST(
+			"/:tableID",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			idempotency.Middleware(client),
+			payment.CreatePayment(client),
+		)
+	}
+
+	// Refund Routes
+	refundGroup := r.Group("/api/v1/refund")
+	{
+		refundGroup.GET("", auth.Authenticate([]string{"admin", "cashier"}), refund.GetRefunds(client))
+		refundGroup.POST(
+			"/:orderID",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			refund.CreateRefund(client),
+		)
+	}
+
+	// Printer Routes
+	printerGroup := r.Group("/api/v1/printer")
+	{
+		printerGroup.GET("/status", auth.Authenticate([]string{"admin"}), printer.GetStatus(client))
+	}
+
+	// Receipt Routes
+	receiptGroup := r.Group("/api/v1/receipt")
+	{
+		receiptGroup.GET(
+			"/:orderID",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			receipt.GetReceipt(client),
+		)
+	}
+
+	// Tax Routes
+	taxGroup := r.Group("/api/v1/tax")
+	{
+		taxGroup.GET("/rate", auth.Authenticate([]string{"admin", "cashier"}), tax.GetRates(client))
+		taxGroup.POST("/rate", auth.Authenticate([]string{"admin"}), tax.CreateRate(client))
+		taxGroup.PUT("/rate/:id", auth.Authenticate([]string{"admin"}), tax.UpdateRate(client))
+		taxGroup.DELETE("/rate/:id", auth.Authenticate([]string{"admin"}), tax.DeleteRate(client))
+		taxGroup.GET("/summary", auth.Authenticate([]string{"admin"}), tax.GetSummary(client))
+	}
+
+	// Session Routes
+	sessionGroup := r.Group("/api/v1/session")
+	{
+		sessionGroup.POST(
+			"",
+			auth.Authenticate([]string{"admin", "waiter"}),
+			session.OpenSession(client),
+		)
+		sessionGroup.GET(
+			"",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			session.GetSessions(client),
+		)
+		sessionGroup.GET(
+			"/stats",
+			auth.Authenticate([]string{"admin"}),
+			session.GetStatistics(client),
+		)
+		sessionGroup.GET(
+			"/:id",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			session.GetSessionById(client),
+		)
+		sessionGroup.PATCH(
+			"/:id",
+			auth.Authenticate([]string{"admin", "waiter"}),
+			session.UpdateSession(client),
+		)
+		sessionGroup.PATCH(
+			"/:id/close",
+			auth.Authenticate([]string{"admin", "cashier"}),
+			order.CloseSession(client),
+		)
+		sessionGroup.DELETE(
+			"/:id/service-charge",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			session.RemoveServiceCharge(client),
+		)
+	}
+
+	// Service Request Routes
+	serviceGroup := r.Group("/api/v1/service")
+	{
+		serviceGroup.POST("/:tableID/call-waiter", service.CallWaiter(client))
+		serviceGroup.POST("/:tableID/request-bill", service.RequestBill(client))
+		serviceGroup.POST("/:tableID/custom", service.CreateCustomRequest(client))
+		serviceGroup.GET(
+			"",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			service.GetRequests(client),
+		)
+		serviceGroup.PATCH(
+			"/:id/acknowledge",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			service.AcknowledgeRequest(client),
+		)
+		serviceGroup.PATCH(
+			"/:id/resolve",
+			auth.Authenticate([]string{"admin", "cashier", "waiter"}),
+			service.ResolveRequest(client),
+		)
+	}
+
 	tableGroup := r.Group("/api/v1/table")
 	{
 		tableGroup.POST("", auth.Authenticate([]string{"admin"}), table.CreateTable(client))
@@ -71,8 +269,20 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 			auth.Authenticate([]string{"admin", "waiter", "cashier"}),
 			table.GetTables(client),
 		)
+		tableGroup.GET("/qr-sheet", auth.Authenticate([]string{"admin"}), table.GetQRSheet(client))
 		tableGroup.GET("/:id", table.GetTableById(client))
 		tableGroup.DELETE("/:id", auth.Authenticate([]string{"admin"}), table.DeleteTable(client))
+		tableGroup.GET("/:id/qr", auth.Authenticate([]string{"admin"}), table.GetTableQR(client))
+		tableGroup.POST(
+			"/:id/token",
+			auth.Authenticate([]string{"admin"}),
+			table.RotateTableToken(client),
+		)
+		tableGroup.DELETE(
+			"/:id/token",
+			auth.Authenticate([]string{"admin"}),
+			table.RevokeTableToken(client),
+		)
 	}
 
 	// User Routes
@@ -96,12 +306,49 @@ func SetupRoutes(r *gin.Engine, client *db.MongoClient) {
 			user.GetUserMe(client),
 		)
 		userGroup.POST("/login", user.Login(client))
+		userGroup.POST("/refresh", user.Refresh(client))
+		userGroup.POST(
+			"/logout",
+			auth.Authenticate([]string{"admin", "waiter", "cashier"}),
+			user.Logout(client),
+		)
+		userGroup.POST(
+			"/logout-all",
+			auth.Authenticate([]string{"admin", "waiter", "cashier"}),
+			user.LogoutAll(client),
+		)
 		userGroup.DELETE("/:id", auth.Authenticate([]string{"admin"}), user.DeleteUser(client))
+		userGroup.DELETE("/:id/sessions", auth.Authenticate([]string{"admin"}), user.RevokeSessions(client))
+	}
+
+	// Webhook Routes
+	webhookGroup := r.Group("/api/v1/webhook")
+	{
+		webhookGroup.POST("", auth.Authenticate([]string{"admin"}), webhook.CreateWebhook(client))
+		webhookGroup.GET("", auth.Authenticate([]string{"admin"}), webhook.GetWebhooks(client))
+		webhookGroup.PATCH("/:id", auth.Authenticate([]string{"admin"}), webhook.UpdateWebhook(client))
+		webhookGroup.DELETE("/:id", auth.Authenticate([]string{"admin"}), webhook.DeleteWebhook(client))
+		webhookGroup.GET("/:id/deliveries", auth.Authenticate([]string{"admin"}), webhook.GetDeliveries(client))
+		webhookGroup.POST(
+			"/delivery/:id/redeliver",
+			auth.Authenticate([]string{"admin"}),
+			webhook.RedeliverDelivery(client),
+		)
 	}
 
 	r.GET(
 		"/api/v1/events",
-		sse.SseHandler,
+		auth.AuthenticateStream([]string{"admin", "cashier", "waiter"}),
+		sse.SseHandler(client),
+	)
+	r.GET("/api/v1/events/table/:id", table.GetTableEvents(client))
+	r.GET("/api/v1/events/stats", auth.Authenticate([]string{"admin"}), sse.GetStats())
+	r.GET(
+		"/api/v1/ws",
+		auth.AuthenticateStream([]string{"admin", "cashier", "waiter"}),
+		ws.Handler(client, map[string]ws.Command{
+			"bump": order.BumpItems,
+		}),
 	)
 }
 
@@ -111,8 +358,9 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header(
 			"Access-Control-Allow-Headers",
-			"Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With",
+			"Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Table-Token, Idempotency-Key, If-Match",
 		)
+		c.Header("Access-Control-Expose-Headers", "Idempotent-Replayed, ETag")
 		c.Header("Access-Control-Allow-Methods", "POST,HEAD,PATCH, OPTIONS, GET, PUT")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,405 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/session"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// CallWaiter asks for a waiter to come to the table
+//
+// @Summary Call a waiter to a table
+// @Description Opens a call-waiter request for the table and pushes it to staff following the table or its zone.
+// @Description Calling again while a request is open returns that request. Requires the table token.
+// @Tags service
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param token query string true "Table token from the table's QR code (or X-Table-Token header)"
+// @Success 201 {object} Request "Service request created"
+// @Success 200 {object} Request "Service request already open"
+// @Failure 400 "Invalid ID"
+// @Failure 401 "Invalid or expired table token"
+// @Failure 500 "Internal Server Error"
+// @Router /service/{tableID}/call-waiter [post]
+func CallWaiter(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		createRequest(c, client, KindCallWaiter, "")
+	}
+}
+
+// RequestBill asks for the bill to be brought to the table
+//
+// @Summary Ask for the bill at a table
+// @Description Opens a request-bill request for the table and pushes it to staff following the table or its zone.
+// @Description Asking again while a request is open returns that request. Requires the table token.
+// @Tags service
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param token query string true "Table token from the table's QR code (or X-Table-Token header)"
+// @Success 201 {object} Request "Service request created"
+// @Success 200 {object} Request "Service request already open"
+// @Failure 400 "Invalid ID"
+// @Failure 401 "Invalid or expired table token"
+// @Failure 500 "Internal Server Error"
+// @Router /service/{tableID}/request-bill [post]
+func RequestBill(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		createRequest(c, client, KindRequestBill, "")
+	}
+}
+
+// CreateCustomRequest sends staff a request written by the customer
+//
+// @Summary Send a custom request from a table
+// @Description Opens a request with the customer's message, e.g. for a high chair, and pushes it to staff following
+// @Description the table or its zone. Requires the table token.
+// @Tags service
+// @Accept json
+// @Produce json
+// @Param tableID path string true "Table ID"
+// @Param token query string true "Table token from the table's QR code (or X-Table-Token header)"
+// @Param request body customRequest true "What the customer asks for"
+// @Success 201 {object} Request "Service request created"
+// @Failure 400 "Invalid request"
+// @Failure 401 "Invalid or expired table token"
+// @Failure 500 "Internal Server Error"
+// @Router /service/{tableID}/custom [post]
+func CreateCustomRequest(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request customRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		request.Message = strings.TrimSpace(request.Message)
+		if err := utils.Validate(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		createRequest(c, client, KindCustom, request.Message)
+	}
+}
+
+// createRequest opens a service request for the table whose token the
+// customer's device holds.
+func createRequest(c *gin.Context, client db.IMongoClient, kind, message string) {
+	tableID, err := primitive.ObjectIDFromHex(c.Param("tableID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Table ID",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	requestTable, err := table.VerifyToken(ctx, client, tableID, table.TokenFromRequest(c))
+	if err != nil {
+		if errors.Is(err, table.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or expired table token, please scan the table's QR code again",
+			})
+			return
+		}
+		utils.HandleMongoError(c, err)
+		return
+	}
+
+	request := Request{
+		TableID:   tableID,
+		Zone:      requestTable.Zone,
+		Kind:      kind,
+		Message:   message,
+		Status:    StatusOpen,
+		Pending:   kind != KindCustom,
+		CreatedAt: time.Now(),
+	}
+
+	err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+		if kind == KindCustom {
+			if err := checkCustomLimit(sc, client, tableID, request.CreatedAt); err != nil {
+				return err
+			}
+		}
+
+		// Requests made before anyone ordered belong to no session yet
+		tableSession, err := session.FindOpen(sc, client, tableID)
+		if err == nil {
+			request.SessionID = tableSession.ID
+		} else if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		result, err := client.GetCollection(config.Env.DatabaseName, "service_requests").InsertOne(sc, request)
+		if err != nil {
+			return err
+		}
+		request.ID = result.InsertedID.(primitive.ObjectID)
+
+		return outbox.Publish(sc, client, sse.Event{Type: sse.ServiceRequested, TableID: tableID.Hex(), Data: request})
+	})
+	if err != nil {
+		switch {
+		case err == errTooManyRequests:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, a waiter will be with you shortly"})
+		case mongo.IsDuplicateKeyError(err):
+			// Tapping the button again doesn't call a second waiter
+			pendingRequest(c, client, tableID, kind)
+		default:
+			utils.HandleMongoError(c, err)
+		}
+		return
+	}
+	outbox.Notify()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Service request created successfully",
+		"id":      request.ID,
+		"data":    request,
+	})
+}
+
+// GetRequests lists service requests
+//
+// @Summary Get service requests
+// @Description Retrieves service requests, oldest first, with the ones still waiting for a waiter by default
+// @Tags service
+// @Produce json
+// @Param status query string false "Comma separated statuses (default: open,acknowledged)"
+// @Param zone query string false "Filter by zone"
+// @Param table query string false "Filter by table ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of requests per page (default: 20)"
+// @Security bearerToken
+// @Success 200 {array} Request "List of service requests"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Internal Server Error"
+// @Router /service [get]
+func GetRequests(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requests []Request
+
+		// Get the collection from the database
+		collection := client.GetCollection(config.Env.DatabaseName, "service_requests")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number."})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit number."})
+			return
+		}
+
+		statuses := strings.Split(c.DefaultQuery("status", StatusOpen+","+StatusAcknowledged), ",")
+		for _, status := range statuses {
+			if status != StatusOpen && status != StatusAcknowledged && status != StatusResolved {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status " + status})
+				return
+			}
+		}
+		query := bson.D{{Key: "status", Value: bson.M{"$in": statuses}}}
+
+		if zone := c.Query("zone"); zone != "" {
+			query = append(query, bson.E{Key: "zone", Value: zone})
+		}
+
+		if tableParam := c.Query("table"); tableParam != "" {
+			tableID, err := primitive.ObjectIDFromHex(tableParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "table_id", Value: tableID})
+		}
+
+		findOptions := options.Find()
+		findOptions.SetSkip(int64((page - 1) * limit))
+		findOptions.SetLimit(int64(limit))
+		findOptions.SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &requests); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse database response.",
+			})
+			return
+		}
+
+		totalCount, err := collection.CountDocuments(ctx, query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": requests,
+			"meta": gin.H{
+				"total":      totalCount,
+				"page":       page,
+				"limit":      limit,
+				"totalPages": int(math.Ceil(float64(totalCount) / float64(limit))),
+			},
+		})
+	}
+}
+
+// AcknowledgeRequest lets the table know a waiter is on the way
+//
+// @Summary Acknowledge a service request
+// @Description Marks an open service request as taken by the current user. The time it was open for counts as the
+// @Description user's response time in waiter statistics.
+// @Tags service
+// @Produce json
+// @Param id path string true "Service request ID"
+// @Security bearerToken
+// @Success 200 {object} Request "Service request acknowledged"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Service request not found"
+// @Failure 409 "Service request was already answered"
+// @Failure 500 "Internal Server Error"
+// @Router /service/{id}/acknowledge [patch]
+func AcknowledgeRequest(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		request, err := updateRequest(
+			c.Request.Context(),
+			client,
+			bson.D{{Key: "_id", Value: id}, {Key: "status", Value: StatusOpen}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: StatusAcknowledged},
+				{Key: "acknowledged_at", Value: time.Now()},
+				{Key: "acknowledged_by", Value: userID},
+			}}},
+			sse.ServiceAcknowledged,
+		)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				notUpdated(c, client, id)
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Service request acknowledged",
+			"data":    request,
+		})
+	}
+}
+
+// ResolveRequest closes a service request
+//
+// @Summary Resolve a service request
+// @Description Marks a service request as dealt with. Resolving a request nobody acknowledged acknowledges it too.
+// @Tags service
+// @Produce json
+// @Param id path string true "Service request ID"
+// @Security bearerToken
+// @Success 200 {object} Request "Service request resolved"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Service request not found"
+// @Failure 409 "Service request was already answered"
+// @Failure 500 "Internal Server Error"
+// @Router /service/{id}/resolve [patch]
+func ResolveRequest(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		request, err := updateRequest(
+			c.Request.Context(),
+			client,
+			bson.D{
+				{Key: "_id", Value: id},
+				{Key: "status", Value: bson.M{"$in": []string{StatusOpen, StatusAcknowledged}}},
+			},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.D{
+					{Key: "status", Value: StatusResolved},
+					{Key: "resolved_at", Value: now},
+					{Key: "resolved_by", Value: userID},
+					{Key: "acknowledged_at", Value: bson.M{"$ifNull": []interface{}{"$acknowledged_at", now}}},
+					{Key: "acknowledged_by", Value: bson.M{"$ifNull": []interface{}{"$acknowledged_by", userID}}},
+				}}},
+				// The table can call again
+				{{Key: "$unset", Value: "pending"}},
+			},
+			sse.ServiceResolved,
+		)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				notUpdated(c, client, id)
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Service request resolved",
+			"data":    request,
+		})
+	}
+}
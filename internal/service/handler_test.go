@@ -0,0 +1,243 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/table"
+)
+
+// testTable is a table in the terrace zone with an active token.
+func testTable(t *testing.T) (bson.D, string) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	tbl := table.Table{ID: primitive.NewObjectID(), Zone: "terrace", TokenNonce: "nonce", TokenExpiresAt: &expiresAt}
+	token, err := table.IssueToken(tbl)
+	assert.NoError(t, err)
+
+	return bson.D{
+		{Key: "_id", Value: tbl.ID},
+		{Key: "zone", Value: tbl.Zone},
+		{Key: "token_nonce", Value: tbl.TokenNonce},
+		{Key: "token_expires_at", Value: expiresAt},
+	}, token
+}
+
+// request sends a request as a waiter, with the table token when given.
+func request(mt *mtest.T, method, path string, handler gin.HandlerFunc, target, token, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, func(c *gin.Context) {
+		c.Set("claims", jwt.MapClaims{"UserID": primitive.NewObjectID().Hex(), "Role": "waiter"})
+	}, handler)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("X-Table-Token", token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func cursor(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, docs...)
+}
+
+// commands returns the names of the commands sent to the database.
+func commands(mt *mtest.T) []string {
+	var names []string
+	for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+		names = append(names, event.CommandName)
+	}
+	return names
+}
+
+func TestCallWaiter(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tableDoc, token := testTable(t)
+	tableID := tableDoc[0].Value.(primitive.ObjectID)
+	target := "/service/" + tableID.Hex() + "/call-waiter"
+
+	call := func(mt *mtest.T, token string) *httptest.ResponseRecorder {
+		return request(mt, http.MethodPost, "/service/:tableID/call-waiter", CallWaiter(db.NewMockMongoClient(mt.Coll)), target, token, "")
+	}
+
+	mt.Run("opens a request and publishes it with it", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursor(tableDoc),
+			cursor(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := call(mt, token)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"zone":"terrace"`)
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		insert := mt.GetStartedEvent().Command.Lookup("documents", "0")
+		assert.True(t, insert.Document().Lookup("pending").Boolean())
+		// The service.requested event goes to the outbox in the same transaction
+		assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("calling again returns the pending request", func(mt *mtest.T) {
+		pending := primitive.NewObjectID()
+		mt.AddMockResponses(
+			cursor(tableDoc),
+			cursor(),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateSuccessResponse(),
+			cursor(bson.D{{Key: "_id", Value: pending}, {Key: "kind", Value: KindCallWaiter}, {Key: "status", Value: StatusAcknowledged}}),
+		)
+
+		w := call(mt, token)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), pending.Hex())
+	})
+
+	mt.Run("invalid token", func(mt *mtest.T) {
+		w := call(mt, "")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, commands(mt))
+	})
+}
+
+func TestCreateCustomRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tableDoc, token := testTable(t)
+	tableID := tableDoc[0].Value.(primitive.ObjectID)
+	target := "/service/" + tableID.Hex() + "/custom"
+
+	send := func(mt *mtest.T, body string) *httptest.ResponseRecorder {
+		return request(mt, http.MethodPost, "/service/:tableID/custom", CreateCustomRequest(db.NewMockMongoClient(mt.Coll)), target, token, body)
+	}
+
+	mt.Run("within the limit", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursor(tableDoc),
+			cursor(bson.D{{Key: "n", Value: config.Env.CustomRequestLimit - 1}}),
+			cursor(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := send(mt, `{"message":"  A high chair please "}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"message":"A high chair please"`)
+		assert.Equal(t, []string{"find", "aggregate", "find", "insert", "insert", "commitTransaction"}, commands(mt))
+	})
+
+	mt.Run("too many requests", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursor(tableDoc),
+			cursor(bson.D{{Key: "n", Value: config.Env.CustomRequestLimit}}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := send(mt, `{"message":"Water"}`)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotContains(t, commands(mt), "insert")
+	})
+
+	mt.Run("empty message", func(mt *mtest.T) {
+		w := send(mt, `{"message":"   "}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Message is required")
+	})
+}
+
+func TestAcknowledgeRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+	target := "/service/" + id.Hex() + "/acknowledge"
+
+	acknowledge := func(mt *mtest.T) *httptest.ResponseRecorder {
+		return request(mt, http.MethodPatch, "/service/:id/acknowledge", AcknowledgeRequest(db.NewMockMongoClient(mt.Coll)), target, "", "")
+	}
+
+	mt.Run("acknowledged", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: id},
+				{Key: "table_id", Value: primitive.NewObjectID()},
+				{Key: "status", Value: StatusAcknowledged},
+			}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := acknowledge(mt)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"findAndModify", "insert", "commitTransaction"}, commands(mt))
+	})
+
+	mt.Run("already answered", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(),
+			cursor(bson.D{{Key: "n", Value: 1}}),
+		)
+
+		w := acknowledge(mt)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(),
+			cursor(bson.D{{Key: "n", Value: 0}}),
+		)
+
+		w := acknowledge(mt)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestResolveRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+
+	mt.Run("resolved", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: id},
+				{Key: "table_id", Value: primitive.NewObjectID()},
+				{Key: "status", Value: StatusResolved},
+			}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := request(mt, http.MethodPatch, "/service/:id/resolve", ResolveRequest(db.NewMockMongoClient(mt.Coll)), "/service/"+id.Hex()+"/resolve", "", "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		// The table can call a waiter again
+		update := mt.GetStartedEvent().Command.Lookup("update").Array()
+		assert.Equal(t, "pending", update.Index(1).Value().Document().Lookup("$unset").StringValue())
+	})
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of requests customers can make from their table
+const (
+	KindCallWaiter  = "call_waiter"
+	KindRequestBill = "request_bill"
+	KindCustom      = "custom"
+)
+
+const (
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged" // a waiter is on the way
+	StatusResolved     = "resolved"
+)
+
+// Request is a customer asking for service from their table's device. It
+// stays open until a waiter acknowledges and then resolves it.
+type Request struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"             json:"id"`
+	TableID        primitive.ObjectID `bson:"table_id"                  json:"tableId"`
+	SessionID      primitive.ObjectID `bson:"session_id,omitempty"      json:"sessionId,omitempty"`
+	Zone           string             `bson:"zone,omitempty"            json:"zone,omitempty"`
+	Kind           string             `bson:"kind"                      json:"kind"`
+	Message        string             `bson:"message,omitempty"         json:"message,omitempty"` // custom requests only
+	Status         string             `bson:"status"                    json:"status"`
+	Pending        bool               `bson:"pending,omitempty"         json:"-"` // until a call-waiter or request-bill request is resolved
+	CreatedAt      time.Time          `bson:"created_at"                json:"createdAt"`
+	AcknowledgedAt *time.Time         `bson:"acknowledged_at,omitempty" json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy primitive.ObjectID `bson:"acknowledged_by,omitempty" json:"acknowledgedBy,omitempty"`
+	ResolvedAt     *time.Time         `bson:"resolved_at,omitempty"     json:"resolvedAt,omitempty"`
+	ResolvedBy     primitive.ObjectID `bson:"resolved_by,omitempty"     json:"resolvedBy,omitempty"`
+}
+
+// ResponseStats sums up how quickly a waiter answered service requests.
+type ResponseStats struct {
+	RequestsAnswered    int     `bson:"requests_answered"     json:"requestsAnswered"`
+	AverageResponseTime float64 `bson:"average_response_time" json:"averageResponseTime"` // minutes
+	SlowestResponseTime float64 `bson:"slowest_response_time" json:"slowestResponseTime"` // minutes
+}
+
+type customRequest struct {
+	Message string `json:"message" validate:"required,min=1,max=200"`
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+// errTooManyRequests is returned when a table sent as many custom requests
+// as it may within the window.
+var errTooManyRequests = errors.New("too many service requests")
+
+// checkCustomLimit makes sure a table can send another custom request, so a
+// device can't flood the waiters' screens.
+func checkCustomLimit(ctx context.Context, client db.IMongoClient, tableID primitive.ObjectID, now time.Time) error {
+	count, err := client.GetCollection(config.Env.DatabaseName, "service_requests").
+		CountDocuments(ctx, bson.D{
+			{Key: "table_id", Value: tableID},
+			{Key: "kind", Value: KindCustom},
+			{Key: "created_at", Value: bson.M{"$gt": now.Add(-config.Env.CustomRequestWindow)}},
+		})
+	if err != nil {
+		return err
+	}
+	if count >= config.Env.CustomRequestLimit {
+		return errTooManyRequests
+	}
+	return nil
+}
+
+// pendingRequest writes the request of the kind a table is still waiting on.
+func pendingRequest(c *gin.Context, client db.IMongoClient, tableID primitive.ObjectID, kind string) {
+	var request Request
+	err := client.GetCollection(config.Env.DatabaseName, "service_requests").
+		FindOne(c.Request.Context(), bson.D{
+			{Key: "table_id", Value: tableID},
+			{Key: "kind", Value: kind},
+			{Key: "pending", Value: true},
+		}).
+		Decode(&request)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// Resolved in the meantime
+			c.JSON(http.StatusConflict, gin.H{"error": "Service request was just answered, please try again"})
+			return
+		}
+		utils.HandleMongoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Service request is already open",
+		"data":    request,
+	})
+}
+
+// updateRequest moves a service request on and tells the table's staff. It
+// returns mongo.ErrNoDocuments when no request matches the filter.
+func updateRequest(
+	ctx context.Context,
+	client db.IMongoClient,
+	filter interface{},
+	update interface{},
+	eventType string,
+) (Request, error) {
+	var request Request
+	err := db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+		err := client.GetCollection(config.Env.DatabaseName, "service_requests").
+			FindOneAndUpdate(sc, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&request)
+		if err != nil {
+			return err
+		}
+
+		return outbox.Publish(sc, client, sse.Event{Type: eventType, TableID: request.TableID.Hex(), Data: request})
+	})
+	if err != nil {
+		return Request{}, err
+	}
+	outbox.Notify()
+	return request, nil
+}
+
+// notUpdated writes the response for a request that could not be moved on,
+// either because it doesn't exist or because it is past that status already.
+func notUpdated(c *gin.Context, client db.IMongoClient, id primitive.ObjectID) {
+	count, err := client.GetCollection(config.Env.DatabaseName, "service_requests").
+		CountDocuments(c.Request.Context(), bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		utils.HandleMongoError(c, err)
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found"})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "Service request was already answered"})
+}
+
+// GetResponseStats works out how quickly a waiter acknowledged the service
+// requests they answered in the given date range.
+func GetResponseStats(
+	ctx context.Context,
+	client db.IMongoClient,
+	userID primitive.ObjectID,
+	from, to time.Time,
+) (ResponseStats, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "service_requests")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"acknowledged_by": userID,
+			"acknowledged_at": bson.M{"$gte": from, "$lte": to},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"response_time": bson.M{
+				"$round": []interface{}{
+					bson.M{
+						"$divide": []interface{}{
+							bson.M{"$subtract": []interface{}{"$acknowledged_at", "$created_at"}},
+							60000,
+						},
+					},
+					2, // number of decimal places
+				},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":                   nil,
+			"requests_answered":     bson.M{"$sum": 1},
+			"average_response_time": bson.M{"$avg": "$response_time"},
+			"slowest_response_time": bson.M{"$max": "$response_time"},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ResponseStats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []ResponseStats
+	if err := cursor.All(ctx, &results); err != nil || len(results) == 0 {
+		return ResponseStats{}, err
+	}
+
+	return results[0], nil
+}
@@ -0,0 +1,513 @@
+package session
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// OpenSession opens a session for a table when a party is seated
+//
+// @Summary Open a table session
+// @Description Allows admin and waiter roles to seat a party at a table with a guest count and an assigned waiter.
+// @Description Sessions are also opened automatically when the first order for a free table is placed.
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param session body sessionRequest true "Session details"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Session opened successfully"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Table or waiter not found"
+// @Failure 409  "Table already has an open session"
+// @Failure 500  "Internal Server Error"
+// @Router /session [post]
+func OpenSession(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request sessionRequest
+
+		// Bind the request body to the session struct
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateSession(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tableID, err := primitive.ObjectIDFromHex(request.TableID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		// Waiters opening a session serve it unless told otherwise
+		waiterID := userID
+		if request.WaiterID != "" {
+			waiterID, err = primitive.ObjectIDFromHex(request.WaiterID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Waiter ID"})
+				return
+			}
+		}
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		count, err := client.GetCollection(config.Env.DatabaseName, "tables").
+			CountDocuments(ctx, bson.D{{Key: "_id", Value: tableID}})
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+			return
+		}
+
+		if ok := checkWaiter(c, client, waiterID); !ok {
+			return
+		}
+
+		session := Session{
+			TableID:    tableID,
+			Status:     StatusOpen,
+			GuestCount: request.GuestCount,
+			WaiterID:   waiterID,
+			OpenedAt:   time.Now(),
+			OpenedBy:   userID,
+		}
+
+		// Get the collection
+		collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			result, err := collection.InsertOne(sc, session)
+			if err != nil {
+				return err
+			}
+			session.ID = result.InsertedID.(primitive.ObjectID)
+
+			return outbox.Publish(sc, client, sse.TableStatusEvent(tableID.Hex(), session.ID.Hex(), sse.StatusOccupied))
+		})
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Table already has an open session"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Session opened successfully",
+			"id":      session.ID,
+		})
+	}
+}
+
+// GetSessions retrieves table sessions
+//
+// @Summary Get table sessions
+// @Description Retrieves table sessions for admin, cashier, and waiter roles
+// @Tags session
+// @Produce json
+// @Security bearerToken
+// @Param status query string false "Filter by status (open/closed)"
+// @Param table query string false "Filter by table ID"
+// @Param waiter query string false "Filter by assigned waiter ID"
+// @Param page query int false "Page number (default is 1)"
+// @Param limit query int false "Number of items per page (default is 20)"
+// @Success 200 {array} Session "List of sessions"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Internal Server Error"
+// @Router /session [get]
+func GetSessions(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var sessions []Session
+
+		// Get the collection from the database
+		collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		status := c.Query("status")
+		table := c.Query("table")
+		waiter := c.Query("waiter")
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number."})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit number."})
+			return
+		}
+
+		query := bson.D{}
+
+		if status != "" {
+			if status != StatusOpen && status != StatusClosed {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Use open or closed."})
+				return
+			}
+			query = append(query, bson.E{Key: "status", Value: status})
+		}
+
+		if table != "" {
+			tableID, err := primitive.ObjectIDFromHex(table)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Table ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "table_id", Value: tableID})
+		}
+
+		if waiter != "" {
+			waiterID, err := primitive.ObjectIDFromHex(waiter)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Waiter ID"})
+				return
+			}
+			query = append(query, bson.E{Key: "waiter_id", Value: waiterID})
+		}
+
+		findOptions := options.Find()
+		findOptions.SetSkip(int64((page - 1) * limit))
+		findOptions.SetLimit(int64(limit))
+		findOptions.SetSort(bson.D{{Key: "opened_at", Value: -1}})
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &sessions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse database response.",
+			})
+			return
+		}
+
+		totalCount, err := collection.CountDocuments(ctx, query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": sessions,
+			"meta": gin.H{
+				"total":      totalCount,
+				"page":       page,
+				"limit":      limit,
+				"totalPages": int(math.Ceil(float64(totalCount) / float64(limit))),
+			},
+		})
+	}
+}
+
+// GetSessionById retrieves a table session
+//
+// @Summary Get a table session
+// @Description Retrieves a table session by its ID for admin, cashier, and waiter roles
+// @Tags session
+// @Produce json
+// @Param id path string true "Session ID"
+// @Security bearerToken
+// @Success 200 {object} Session "Session data"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Session not found"
+// @Failure 500 "Internal Server Error"
+// @Router /session/{id} [get]
+func GetSessionById(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		// Get collection from db
+		collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		var session Session
+		err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: docID}}).Decode(&session)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": session,
+		})
+	}
+}
+
+// UpdateSession updates the guest count or assigned waiter of an open session
+//
+// @Summary Update a table session
+// @Description Allows admin and waiter roles to change the guest count or assigned waiter of an open session
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ID"
+// @Param session body updateSessionRequest true "Session update details"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Session updated successfully"
+// @Failure 400 "Invalid request"
+// @Failure 404 "Session not found or already closed"
+// @Failure 500 "Internal Server Error"
+// @Router /session/{id} [patch]
+func UpdateSession(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request updateSessionRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		if err := validateSession(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := bson.D{}
+
+		if request.GuestCount != nil {
+			set = append(set, bson.E{Key: "guest_count", Value: *request.GuestCount})
+		}
+
+		if request.WaiterID != "" {
+			waiterID, err := primitive.ObjectIDFromHex(request.WaiterID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Waiter ID"})
+				return
+			}
+			if ok := checkWaiter(c, client, waiterID); !ok {
+				return
+			}
+			set = append(set, bson.E{Key: "waiter_id", Value: waiterID})
+		}
+
+		if len(set) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		err = updateOpen(ctx, client, docID, set)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or already closed"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Session updated successfully",
+		})
+	}
+}
+
+// RemoveServiceCharge takes the service charge off the bill of an open session
+//
+// @Summary Remove the service charge of a table session
+// @Description Removes the service charge from an open session's bill. Cashiers and waiters must include the
+// @Description credentials of an admin in approval.
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ID"
+// @Param request body removeServiceChargeRequest true "Reason and manager approval"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Service charge removed successfully"
+// @Failure 400 "Invalid request"
+// @Failure 403 "Manager approval required"
+// @Failure 404 "Session not found or already closed"
+// @Failure 500 "Internal Server Error"
+// @Router /session/{id}/service-charge [delete]
+func RemoveServiceCharge(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		var request removeServiceChargeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if err := validateSession(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		approverID, ok := auth.ApproveAction(c, client, request.Approval)
+		if !ok {
+			return
+		}
+
+		removal := ServiceChargeRemoval{
+			Reason:     request.Reason,
+			RemovedBy:  userID,
+			ApprovedBy: approverID,
+			RemovedAt:  time.Now(),
+		}
+
+		err = updateOpen(c.Request.Context(), client, docID, bson.D{{Key: "service_charge_removal", Value: removal}})
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or already closed"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Service charge removed successfully",
+		})
+	}
+}
+
+// GetStatistics calculates session statistics for a given date range
+//
+// @Summary Get session statistics for a given date range
+// @Description Fetches covers, average spend per cover and dwell time of closed sessions
+// @Tags Statistics
+// @Security bearerToken
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD)"
+// @Param group_by query string true "Grouping interval: one of 'day', 'week', or 'month'"
+// @Success 200 {object} Stats "Session statistics data"
+// @Failure 400 {object} map[string]string "Invalid date format"
+// @Failure 500 {object} map[string]string "Failed to fetch statistics"
+// @Router /session/stats [get]
+func GetStatistics(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+		groupBy := c.Query("group_by")
+		if groupBy != "day" && groupBy != "week" && groupBy != "month" {
+			c.JSON(
+				http.StatusBadRequest,
+				gin.H{"error": "Invalid 'group_by' parameter. Allowed values are 'day', 'week', or 'month'."},
+			)
+			return
+		}
+
+		from, err := time.Parse("2006-01-02", c.Query("from"))
+		if err != nil {
+			c.JSON(
+				http.StatusBadRequest,
+				gin.H{"error": "Invalid 'from' date format use YYYY-MM-DD"},
+			)
+			return
+		}
+
+		to, err := time.Parse("2006-01-02", c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format YYYY-MM-DD"})
+			return
+		}
+
+		stats, err := getStats(c, collection, from, to.Add(24*time.Hour), groupBy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": stats,
+		})
+	}
+}
+
+// checkWaiter writes an error response and returns false unless the ID
+// belongs to a user who can wait tables (waiters and admins).
+func checkWaiter(c *gin.Context, client db.IMongoClient, waiterID primitive.ObjectID) bool {
+	count, err := client.GetCollection(config.Env.DatabaseName, "users").
+		CountDocuments(c.Request.Context(), bson.D{
+			{Key: "_id", Value: waiterID},
+			{Key: "role", Value: bson.M{"$in": []string{"waiter", "admin"}}},
+		})
+	if err != nil {
+		utils.HandleMongoError(c, err)
+		return false
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waiter not found"})
+		return false
+	}
+
+	return true
+}
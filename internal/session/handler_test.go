@@ -0,0 +1,104 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// serve sends a request to the handler as a waiter.
+func serve(method, path string, handler gin.HandlerFunc, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, func(c *gin.Context) {
+		c.Set("claims", jwt.MapClaims{"UserID": primitive.NewObjectID().Hex(), "Role": "waiter"})
+	}, handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func count(n int) bson.D {
+	return cursor(bson.D{{Key: "n", Value: n}})
+}
+
+func TestOpenSession(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	body := `{"tableId":"` + primitive.NewObjectID().Hex() + `","guestCount":4}`
+
+	open := func(mt *mtest.T, body string) *httptest.ResponseRecorder {
+		return serve(http.MethodPost, "/session", OpenSession(db.NewMockMongoClient(mt.Coll)), "/session", body)
+	}
+
+	mt.Run("seats a party", func(mt *mtest.T) {
+		mt.AddMockResponses(count(1), count(1), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		w := open(mt, body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		insert := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		assert.Equal(t, int32(4), insert.Lookup("guest_count").Int32())
+		assert.Equal(t, StatusOpen, insert.Lookup("status").StringValue())
+		// The table turns occupied through the outbox
+		assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("table already seated", func(mt *mtest.T) {
+		mt.AddMockResponses(count(1), count(1), duplicateKey, mtest.CreateSuccessResponse())
+
+		w := open(mt, body)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	mt.Run("unknown table", func(mt *mtest.T) {
+		mt.AddMockResponses(count(0))
+
+		w := open(mt, body)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Table not found")
+	})
+
+	mt.Run("too many guests", func(mt *mtest.T) {
+		w := open(mt, `{"tableId":"`+primitive.NewObjectID().Hex()+`","guestCount":101}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestUpdateSession(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	target := "/session/" + primitive.NewObjectID().Hex()
+
+	update := func(mt *mtest.T, body string) *httptest.ResponseRecorder {
+		return serve(http.MethodPatch, "/session/:id", UpdateSession(db.NewMockMongoClient(mt.Coll)), target, body)
+	}
+
+	mt.Run("nothing to update", func(mt *mtest.T) {
+		w := update(mt, `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	mt.Run("closed session", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}), mtest.CreateSuccessResponse())
+
+		w := update(mt, `{"guestCount":2}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
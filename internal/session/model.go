@@ -0,0 +1,74 @@
+package session
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+// Session is a party's visit to a table, from seating to payment. Orders
+// placed while a session is open belong to it and it is billed and closed
+// as a unit.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"         json:"id"`
+	TableID    primitive.ObjectID `bson:"table_id"              json:"tableId"`
+	Status     string             `bson:"status"                json:"status"`
+	GuestCount int                `bson:"guest_count"           json:"guestCount"`
+	WaiterID   primitive.ObjectID `bson:"waiter_id,omitempty"   json:"waiterId"`
+	OpenedAt   time.Time          `bson:"opened_at"             json:"openedAt"`
+	OpenedBy   primitive.ObjectID `bson:"opened_by,omitempty"   json:"openedBy"` // empty when opened by a customer order
+	ClosedAt   *time.Time         `bson:"closed_at,omitempty"   json:"closedAt"`
+	ClosedBy   primitive.ObjectID `bson:"closed_by,omitempty"   json:"closedBy"`
+	MergedInto primitive.ObjectID `bson:"merged_into,omitempty" json:"mergedInto,omitempty"` // set when merged into another table's session
+
+	ServiceCharge        *ServiceCharge        `bson:"service_charge,omitempty"         json:"serviceCharge,omitempty"` // recorded when the session closes
+	ServiceChargeRemoval *ServiceChargeRemoval `bson:"service_charge_removal,omitempty" json:"serviceChargeRemoval,omitempty"`
+	ReceiptPrints        int                   `bson:"receipt_prints,omitempty"         json:"receiptPrints"`
+	PaymentCount         int                   `bson:"payment_count,omitempty"          json:"paymentCount"`
+}
+
+// ServiceCharge is the service charge on a session's bill. Amount is the
+// charge itself and Total what the party pays for it, which includes the tax
+// when tax is added on top of prices.
+type ServiceCharge struct {
+	Rate         int64         `bson:"rate"            json:"rate"` // basis points
+	Base         int64         `bson:"base"            json:"base"` // order totals the charge is worked out on
+	Amount       int64         `bson:"amount"          json:"amount"`
+	TaxInclusive bool          `bson:"tax_inclusive"   json:"taxInclusive"`
+	Taxes        []tax.TaxLine `bson:"taxes,omitempty" json:"taxes"`
+	TaxTotal     int64         `bson:"tax_total"       json:"taxTotal"`
+	Total        int64         `bson:"total"           json:"total"`
+}
+
+// ServiceChargeRemoval records a manager taking the service charge off a
+// session's bill.
+type ServiceChargeRemoval struct {
+	Reason     string             `bson:"reason"      json:"reason"`
+	RemovedBy  primitive.ObjectID `bson:"removed_by"  json:"removedBy"`
+	ApprovedBy primitive.ObjectID `bson:"approved_by" json:"approvedBy"`
+	RemovedAt  time.Time          `bson:"removed_at"  json:"removedAt"`
+}
+
+type sessionRequest struct {
+	TableID    string `json:"tableId"    validate:"required"`
+	GuestCount int    `json:"guestCount" validate:"gte=0,lte=100"`
+	WaiterID   string `json:"waiterId"`
+}
+
+type updateSessionRequest struct {
+	GuestCount *int   `json:"guestCount" validate:"omitempty,gte=0,lte=100"`
+	WaiterID   string `json:"waiterId"`
+}
+
+type removeServiceChargeRequest struct {
+	Reason   string         `json:"reason"   validate:"required,max=200"`
+	Approval *auth.Approval `json:"approval"`
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+// ServiceChargeFor works out the service charge of a session on the given
+// order totals. It returns nil when the session is not charged.
+func ServiceChargeFor(
+	ctx context.Context,
+	client db.IMongoClient,
+	session Session,
+	base int64,
+) (*ServiceCharge, error) {
+	if config.Env.ServiceChargeRate == 0 || base <= 0 || session.ServiceChargeRemoval != nil {
+		return nil, nil
+	}
+	if int64(session.GuestCount) < config.Env.ServiceChargeMinCovers {
+		return nil, nil
+	}
+
+	if len(config.Env.ServiceChargeZones) > 0 {
+		var table struct {
+			Zone string `bson:"zone"`
+		}
+		err := client.GetCollection(config.Env.DatabaseName, "tables").FindOne(
+			ctx,
+			bson.D{{Key: "_id", Value: session.TableID}},
+			options.FindOne().SetProjection(bson.D{{Key: "zone", Value: 1}}),
+		).Decode(&table)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if !slices.Contains(config.Env.ServiceChargeZones, table.Zone) {
+			return nil, nil
+		}
+	}
+
+	var rates []tax.Rate
+	if config.Env.ServiceChargeTaxable {
+		var err error
+		rates, err = tax.LoadRates(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return serviceCharge(base, rates), nil
+}
+
+// serviceCharge applies the configured rate to the base, rounding to the
+// nearest minor unit, and taxes the charge at the given rates.
+func serviceCharge(base int64, rates []tax.Rate) *ServiceCharge {
+	charge := &ServiceCharge{
+		Rate:         config.Env.ServiceChargeRate,
+		Base:         base,
+		Amount:       (base*config.Env.ServiceChargeRate + 5000) / 10000,
+		TaxInclusive: config.Env.TaxInclusive,
+	}
+
+	if len(rates) > 0 {
+		charge.Taxes, charge.TaxTotal = tax.Calculate(
+			rates,
+			[]tax.Line{{Category: tax.CategoryServiceCharge, Amount: charge.Amount}},
+			tax.ServiceEatIn,
+			charge.TaxInclusive,
+		)
+	}
+
+	charge.Total = charge.Amount
+	if !charge.TaxInclusive {
+		charge.Total += charge.TaxTotal
+	}
+	return charge
+}
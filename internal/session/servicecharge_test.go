@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/tax"
+)
+
+// chargeServiceAt configures a 12.5% service charge for the test.
+func chargeServiceAt(t *testing.T, minCovers int64, zones []string) {
+	env := config.Env
+	t.Cleanup(func() { config.Env = env })
+
+	config.Env.ServiceChargeRate = 1250
+	config.Env.ServiceChargeMinCovers = minCovers
+	config.Env.ServiceChargeZones = zones
+	config.Env.ServiceChargeTaxable = false
+}
+
+func TestServiceChargeFor(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("charged", func(mt *mtest.T) {
+		chargeServiceAt(mt.T, 6, nil)
+
+		charge, err := ServiceChargeFor(context.Background(), db.NewMockMongoClient(mt.Coll), Session{GuestCount: 6}, 1003)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(125), charge.Amount)
+		assert.Equal(t, int64(1003), charge.Base)
+	})
+
+	mt.Run("below the minimum covers", func(mt *mtest.T) {
+		chargeServiceAt(mt.T, 6, nil)
+
+		charge, err := ServiceChargeFor(context.Background(), db.NewMockMongoClient(mt.Coll), Session{GuestCount: 5}, 1000)
+
+		assert.NoError(t, err)
+		assert.Nil(t, charge)
+	})
+
+	mt.Run("removed by a manager", func(mt *mtest.T) {
+		chargeServiceAt(mt.T, 0, nil)
+		session := Session{ServiceChargeRemoval: &ServiceChargeRemoval{Reason: "complaint"}}
+
+		charge, err := ServiceChargeFor(context.Background(), db.NewMockMongoClient(mt.Coll), session, 1000)
+
+		assert.NoError(t, err)
+		assert.Nil(t, charge)
+	})
+
+	mt.Run("table in a charged zone", func(mt *mtest.T) {
+		chargeServiceAt(mt.T, 0, []string{"terrace"})
+		mt.AddMockResponses(cursor(bson.D{{Key: "zone", Value: "terrace"}}))
+
+		charge, err := ServiceChargeFor(context.Background(), db.NewMockMongoClient(mt.Coll), Session{}, 1000)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(125), charge.Amount)
+	})
+
+	mt.Run("table outside the charged zones", func(mt *mtest.T) {
+		chargeServiceAt(mt.T, 0, []string{"terrace"})
+		mt.AddMockResponses(cursor(bson.D{{Key: "zone", Value: "bar"}}))
+
+		charge, err := ServiceChargeFor(context.Background(), db.NewMockMongoClient(mt.Coll), Session{}, 1000)
+
+		assert.NoError(t, err)
+		assert.Nil(t, charge)
+	})
+}
+
+func TestServiceCharge(t *testing.T) {
+	rates := []tax.Rate{{Code: "STD", EatIn: 2000, Default: true}}
+
+	t.Run("rounded to the nearest unit", func(t *testing.T) {
+		chargeServiceAt(t, 0, nil)
+
+		assert.Equal(t, int64(126), serviceCharge(1004, nil).Amount)
+		assert.Equal(t, int64(125), serviceCharge(1003, nil).Amount)
+	})
+
+	t.Run("tax inclusive", func(t *testing.T) {
+		chargeServiceAt(t, 0, nil)
+		config.Env.TaxInclusive = true
+
+		charge := serviceCharge(9600, rates)
+
+		assert.Equal(t, int64(1200), charge.Amount)
+		assert.Equal(t, int64(200), charge.TaxTotal)
+		assert.Equal(t, int64(1200), charge.Total)
+	})
+
+	t.Run("tax exclusive", func(t *testing.T) {
+		chargeServiceAt(t, 0, nil)
+		config.Env.TaxInclusive = false
+
+		charge := serviceCharge(9600, rates)
+
+		assert.Equal(t, int64(240), charge.TaxTotal)
+		assert.Equal(t, int64(1440), charge.Total)
+	})
+}
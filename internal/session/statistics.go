@@ -0,0 +1,181 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AggregatedStat struct {
+	GroupKey             string  `bson:"group_key"             json:"groupKey"` // day, week or month
+	TotalSessions        int     `bson:"total_sessions"        json:"totalSessions"`
+	TotalCovers          int     `bson:"total_covers"          json:"totalCovers"`
+	TotalRevenue         float64 `bson:"total_revenue"         json:"totalRevenue"`
+	TotalServiceCharges  int64   `bson:"total_service_charges" json:"totalServiceCharges"` // not part of revenue
+	AverageSpendPerCover float64 `bson:"average_spend_per_cover" json:"averageSpendPerCover"`
+	AverageDwellTime     float64 `bson:"average_dwell_time"    json:"averageDwellTime"` // minutes
+}
+
+type Stats struct {
+	TotalSessions        int              `json:"totalSessions"`
+	TotalCovers          int              `json:"totalCovers"`
+	TotalRevenue         float64          `json:"totalRevenue"`
+	TotalServiceCharges  int64            `json:"totalServiceCharges"` // not part of revenue
+	AverageSpendPerCover float64          `json:"averageSpendPerCover"`
+	AverageDwellTime     float64          `json:"averageDwellTime"` // minutes
+	AggregatedStats      []AggregatedStat `json:"aggregatedStats"`
+}
+
+// getStats calculates cover and dwell time statistics of sessions closed in
+// the given date range. Revenue is summed from the orders of each session.
+func getStats(
+	ctx context.Context,
+	collection *mongo.Collection,
+	from time.Time,
+	to time.Time,
+	groupBy string, // "day", "week", or "month"
+) (Stats, error) {
+	matchFilter := bson.M{
+		"status":    StatusClosed,
+		"closed_at": bson.M{"$gte": from, "$lt": to},
+	}
+
+	var groupID bson.M
+	var groupKeyExpr bson.M
+
+	switch groupBy {
+	case "day":
+		groupID = bson.M{
+			"year":  bson.M{"$year": "$opened_at"},
+			"month": bson.M{"$month": "$opened_at"},
+			"day":   bson.M{"$dayOfMonth": "$opened_at"},
+		}
+		groupKeyExpr = bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$opened_at"}}
+	case "week":
+		groupID = bson.M{
+			"year": bson.M{"$isoWeekYear": "$opened_at"},
+			"week": bson.M{"$isoWeek": "$opened_at"},
+		}
+		groupKeyExpr = bson.M{
+			"$concat": []interface{}{
+				bson.M{"$toString": bson.M{"$isoWeekYear": "$opened_at"}},
+				"-W",
+				bson.M{"$toString": bson.M{"$isoWeek": "$opened_at"}},
+			},
+		}
+	case "month":
+		groupID = bson.M{
+			"year":  bson.M{"$year": "$opened_at"},
+			"month": bson.M{"$month": "$opened_at"},
+		}
+		groupKeyExpr = bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$opened_at"}}
+	default:
+		return Stats{}, fmt.Errorf("unsupported groupBy value: %s", groupBy)
+	}
+
+	// Spend per cover only makes sense for sessions with a guest count
+	spendPerCover := bson.M{
+		"$cond": []interface{}{
+			bson.M{"$gt": []interface{}{"$total_covers", 0}},
+			bson.M{"$round": []interface{}{
+				bson.M{"$divide": []interface{}{"$covered_revenue", "$total_covers"}},
+				2,
+			}},
+			0,
+		},
+	}
+
+	group := func(id interface{}) bson.M {
+		return bson.M{
+			"_id":            id,
+			"total_sessions": bson.M{"$sum": 1},
+			"total_covers":   bson.M{"$sum": "$guest_count"},
+			"total_revenue":  bson.M{"$sum": "$revenue"},
+			// Service charges are kept out of revenue and spend per cover
+			"total_service_charges": bson.M{"$sum": "$service_charge.total"},
+			// Revenue of sessions without a guest count would inflate spend per cover
+			"covered_revenue": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$guest_count", 0}},
+				"$revenue",
+				0,
+			}}},
+			"average_dwell_time": bson.M{"$avg": "$dwell_time"},
+			"opened_at":          bson.M{"$first": "$opened_at"},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: matchFilter}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "orders",
+			"localField":   "_id",
+			"foreignField": "session_id",
+			"as":           "orders",
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"revenue": bson.M{"$sum": "$orders.total_price"},
+			"dwell_time": bson.M{
+				"$round": []interface{}{
+					bson.M{
+						"$divide": []interface{}{
+							bson.M{"$subtract": []interface{}{"$closed_at", "$opened_at"}},
+							60000,
+						},
+					},
+					2, // number of decimal places
+				},
+			},
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"overall": []bson.M{
+				{"$group": group(nil)},
+				{"$addFields": bson.M{"average_spend_per_cover": spendPerCover}},
+			},
+			"grouped": []bson.M{
+				{"$group": group(groupID)},
+				{"$project": bson.M{
+					"group_key":               groupKeyExpr,
+					"total_sessions":          1,
+					"total_covers":            1,
+					"total_revenue":           1,
+					"total_service_charges":   1,
+					"average_spend_per_cover": spendPerCover,
+					"average_dwell_time":      1,
+				}},
+				{"$sort": bson.M{"group_key": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Overall []AggregatedStat `bson:"overall"`
+		Grouped []AggregatedStat `bson:"grouped"`
+	}
+
+	if err := cursor.All(ctx, &results); err != nil || len(results) == 0 {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	if len(results[0].Overall) > 0 {
+		overall := results[0].Overall[0]
+		stats.TotalSessions = overall.TotalSessions
+		stats.TotalCovers = overall.TotalCovers
+		stats.TotalRevenue = overall.TotalRevenue
+		stats.TotalServiceCharges = overall.TotalServiceCharges
+		stats.AverageSpendPerCover = overall.AverageSpendPerCover
+		stats.AverageDwellTime = overall.AverageDwellTime
+	}
+	stats.AggregatedStats = results[0].Grouped
+
+	return stats, nil
+}
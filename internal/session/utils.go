@@ -0,0 +1,274 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+func validateSession(v *validator.Validate, request interface{}) error {
+	// Perform validation
+	if err := v.Struct(request); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			fmt.Println(err)
+			return nil
+		}
+
+		validationErrors := err.(validator.ValidationErrors)
+		for _, fieldErr := range validationErrors {
+			switch fieldErr.Tag() {
+			case "required":
+				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "gte":
+				return fmt.Errorf("%s must be at least %s", fieldErr.Field(), fieldErr.Param())
+			case "lte":
+				return fmt.Errorf("%s must be at most %s", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				return fmt.Errorf("%s must be at most %s characters", fieldErr.Field(), fieldErr.Param())
+			default:
+				return fmt.Errorf("%s is invalid", fieldErr.Field())
+			}
+		}
+	}
+	return nil
+}
+
+// FindOpen returns the open session of a table or mongo.ErrNoDocuments.
+func FindOpen(
+	ctx context.Context,
+	client db.IMongoClient,
+	tableID primitive.ObjectID,
+) (Session, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	var session Session
+	err := collection.FindOne(ctx, bson.D{
+		{Key: "table_id", Value: tableID},
+		{Key: "status", Value: StatusOpen},
+	}).Decode(&session)
+
+	return session, err
+}
+
+// Find returns a session by ID or mongo.ErrNoDocuments.
+func Find(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+) (Session, error) {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	var session Session
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: sessionID}}).Decode(&session)
+
+	return session, err
+}
+
+// GetOrOpen returns the open session of a table, opening a new one when the
+// table has none, and reports whether it was opened. It is used when the
+// first order of a visit is placed, inside the transaction placing it.
+func GetOrOpen(
+	ctx context.Context,
+	client db.IMongoClient,
+	tableID primitive.ObjectID,
+) (Session, bool, error) {
+	session, err := FindOpen(ctx, client, tableID)
+	if err != mongo.ErrNoDocuments {
+		return session, false, err
+	}
+
+	session = Session{
+		TableID:  tableID,
+		Status:   StatusOpen,
+		OpenedAt: time.Now(),
+	}
+
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	result, err := collection.InsertOne(ctx, session)
+	if err != nil {
+		// Another request opened the session first. A transaction can't
+		// read it after the error, it is run again and finds it.
+		if mongo.IsDuplicateKeyError(err) {
+			if mongo.SessionFromContext(ctx) != nil {
+				return Session{}, false, db.Retry(err)
+			}
+			session, err = FindOpen(ctx, client, tableID)
+			return session, false, err
+		}
+		return Session{}, false, err
+	}
+
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return session, true, nil
+}
+
+// Close marks an open session as closed by the given user and records the
+// service charge it was billed, if any.
+func Close(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+	userID primitive.ObjectID,
+	charge *ServiceCharge,
+) error {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	set := bson.D{
+		{Key: "status", Value: StatusClosed},
+		{Key: "closed_at", Value: time.Now()},
+		{Key: "closed_by", Value: userID},
+	}
+	if charge != nil {
+		set = append(set, bson.E{Key: "service_charge", Value: charge})
+	}
+
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "status", Value: StatusOpen},
+		},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return err
+}
+
+// CountPayment counts a payment taken for an open session. Payments count
+// themselves inside their transaction, so two payments for the same session
+// write the same document and one of them is retried with the other's
+// balance. It returns mongo.ErrNoDocuments when the session was closed.
+func CountPayment(ctx context.Context, client db.IMongoClient, sessionID primitive.ObjectID) error {
+	result, err := client.GetCollection(config.Env.DatabaseName, "sessions").UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "status", Value: StatusOpen},
+		},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "payment_count", Value: 1}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// updateOpen sets fields of an open session and tells subscribers about the
+// updated session. It returns mongo.ErrNoDocuments when the session was
+// closed.
+func updateOpen(ctx context.Context, client db.IMongoClient, sessionID primitive.ObjectID, set bson.D) error {
+	err := db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+		var session Session
+		err := client.GetCollection(config.Env.DatabaseName, "sessions").FindOneAndUpdate(
+			sc,
+			bson.D{
+				{Key: "_id", Value: sessionID},
+				{Key: "status", Value: StatusOpen},
+			},
+			bson.D{{Key: "$set", Value: set}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&session)
+		if err != nil {
+			return err
+		}
+
+		return outbox.Publish(sc, client, sse.Event{Type: sse.SessionUpdated, TableID: session.TableID.Hex(), Data: session})
+	})
+	if err != nil {
+		return err
+	}
+	outbox.Notify()
+	return nil
+}
+
+// AssignWaiterIfEmpty assigns the waiter to the session unless another
+// waiter has already been assigned.
+func AssignWaiterIfEmpty(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+	waiterID primitive.ObjectID,
+) error {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "waiter_id", Value: bson.M{"$exists": false}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "waiter_id", Value: waiterID}}}},
+	)
+	return err
+}
+
+// MoveToTable moves an open session to another table. It fails with a
+// duplicate key error when the target table already has an open session.
+func MoveToTable(
+	ctx context.Context,
+	client db.IMongoClient,
+	sessionID primitive.ObjectID,
+	tableID primitive.ObjectID,
+) error {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "status", Value: StatusOpen},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "table_id", Value: tableID}}}},
+	)
+	return err
+}
+
+// MergeInto closes the source session as merged into the target session and
+// adds its guests to the target.
+func MergeInto(
+	ctx context.Context,
+	client db.IMongoClient,
+	source Session,
+	target Session,
+	userID primitive.ObjectID,
+) error {
+	collection := client.GetCollection(config.Env.DatabaseName, "sessions")
+
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: source.ID},
+			{Key: "status", Value: StatusOpen},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusClosed},
+			{Key: "closed_at", Value: time.Now()},
+			{Key: "closed_by", Value: userID},
+			{Key: "merged_into", Value: target.ID},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: target.ID}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "guest_count", Value: source.GuestCount}}}},
+	)
+	return err
+}
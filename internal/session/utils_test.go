@@ -0,0 +1,107 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func cursor(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.sessions", mtest.FirstBatch, docs...)
+}
+
+var duplicateKey = mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+
+func TestGetOrOpen(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tableID := primitive.NewObjectID()
+	openID := primitive.NewObjectID()
+	open := bson.D{{Key: "_id", Value: openID}, {Key: "table_id", Value: tableID}, {Key: "status", Value: StatusOpen}}
+
+	mt.Run("table already has a session", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(open))
+
+		session, opened, err := GetOrOpen(context.Background(), db.NewMockMongoClient(mt.Coll), tableID)
+
+		assert.NoError(t, err)
+		assert.False(t, opened)
+		assert.Equal(t, openID, session.ID)
+	})
+
+	mt.Run("free table", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(), mtest.CreateSuccessResponse())
+
+		session, opened, err := GetOrOpen(context.Background(), db.NewMockMongoClient(mt.Coll), tableID)
+
+		assert.NoError(t, err)
+		assert.True(t, opened)
+		assert.False(t, session.ID.IsZero())
+		assert.Equal(t, StatusOpen, session.Status)
+		assert.Equal(t, tableID, session.TableID)
+	})
+
+	mt.Run("opened by another request first", func(mt *mtest.T) {
+		mt.AddMockResponses(cursor(), duplicateKey, cursor(open))
+
+		session, opened, err := GetOrOpen(context.Background(), db.NewMockMongoClient(mt.Coll), tableID)
+
+		assert.NoError(t, err)
+		assert.False(t, opened)
+		assert.Equal(t, openID, session.ID)
+	})
+
+	mt.Run("opened by another transaction first", func(mt *mtest.T) {
+		// The first run aborts on the duplicate, the second finds the session
+		mt.AddMockResponses(cursor(), duplicateKey, mtest.CreateSuccessResponse(), cursor(open), mtest.CreateSuccessResponse())
+		client := db.NewMockMongoClient(mt.Coll)
+		runs := 0
+
+		var session Session
+		err := db.WithTransaction(context.Background(), client, func(sc mongo.SessionContext) error {
+			runs++
+			var err error
+			session, _, err = GetOrOpen(sc, client, tableID)
+			return err
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+		assert.Equal(t, openID, session.ID)
+	})
+}
+
+func TestClose(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	sessionID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	mt.Run("records the service charge", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		err := Close(context.Background(), db.NewMockMongoClient(mt.Coll), sessionID, userID, &ServiceCharge{Rate: 1000, Amount: 250})
+
+		assert.NoError(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, StatusOpen, update.Lookup("q", "status").StringValue())
+		assert.Equal(t, StatusClosed, update.Lookup("u", "$set", "status").StringValue())
+		assert.Equal(t, int64(250), update.Lookup("u", "$set", "service_charge", "amount").Int64())
+	})
+
+	mt.Run("without a service charge", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		err := Close(context.Background(), db.NewMockMongoClient(mt.Coll), sessionID, userID, nil)
+
+		assert.NoError(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, charged := update.Lookup("u", "$set").Document().LookupErr("service_charge")
+		assert.Error(t, charged)
+	})
+}
@@ -0,0 +1,204 @@
+package sse
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+// Policy decides what happens to a subscriber whose queue is full.
+type Policy int
+
+const (
+	// Disconnect ends the subscription. The client reconnects with
+	// Last-Event-ID and catches up from the event log.
+	Disconnect Policy = iota
+	// Drop skips the events that don't fit in the queue.
+	Drop
+)
+
+// ParsePolicy returns the policy named "disconnect" or "drop", and
+// Disconnect for anything else.
+func ParsePolicy(name string) Policy {
+	if name == "drop" {
+		return Drop
+	}
+	return Disconnect
+}
+
+// Subscriber receives the events matching its filter until it unsubscribes,
+// falls behind under the Disconnect policy or the broker is closed.
+type Subscriber struct {
+	filter Filter
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Events returns the subscriber's queue. It is never closed, wait on Done
+// to learn when no more events will come.
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the subscription ends.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscriber) end() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Stats describes the subscribers of a broker and the events they missed.
+type Stats struct {
+	Subscribers  int   `json:"subscribers"`
+	Published    int64 `json:"published"`
+	Dropped      int64 `json:"dropped"`      // events not queued because a queue was full
+	Disconnected int64 `json:"disconnected"` // subscribers ended for falling behind
+}
+
+// Broker fans events out to subscribers without waiting for them. Each
+// subscriber has its own queue, so a slow client never holds up the request
+// publishing an event or the other clients.
+type Broker struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	queueSize   int
+	policy      Policy
+	closed      bool
+
+	published    atomic.Int64
+	dropped      atomic.Int64
+	disconnected atomic.Int64
+}
+
+// NewBroker returns a broker queueing up to queueSize events per subscriber.
+func NewBroker(queueSize int, policy Policy) *Broker {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &Broker{
+		subscribers: make(map[*Subscriber]struct{}),
+		queueSize:   queueSize,
+		policy:      policy,
+	}
+}
+
+// Subscribe adds a subscriber receiving the events matching the filter. It
+// returns false once the broker is closed.
+func (b *Broker) Subscribe(filter Filter) (*Subscriber, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+
+	s := &Subscriber{
+		filter: filter,
+		events: make(chan Event, b.queueSize),
+		done:   make(chan struct{}),
+	}
+	b.subscribers[s] = struct{}{}
+	return s, true
+}
+
+// Unsubscribe removes a subscriber. It is safe to call more than once.
+func (b *Broker) Unsubscribe(s *Subscriber) {
+	b.mutex.Lock()
+	delete(b.subscribers, s)
+	b.mutex.Unlock()
+
+	s.end()
+}
+
+// Publish queues an event for every subscriber whose filter it matches.
+// Subscribers with a full queue are handled according to the policy.
+func (b *Broker) Publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.published.Add(1)
+
+	for s := range b.subscribers {
+		if !s.filter.Match(event) {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			b.dropped.Add(1)
+			if b.policy == Disconnect {
+				delete(b.subscribers, s)
+				s.end()
+				b.disconnected.Add(1)
+			}
+		}
+	}
+}
+
+// SetFilter changes which events a subscriber receives from now on.
+func (b *Broker) SetFilter(s *Subscriber, filter Filter) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s.filter = filter
+}
+
+// Close ends every subscription so open streams return, for example when the
+// server shuts down. Later subscriptions fail and events are discarded.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		s.end()
+	}
+}
+
+// Stats returns the current number of subscribers and event counters.
+func (b *Broker) Stats() Stats {
+	b.mutex.Lock()
+	subscribers := len(b.subscribers)
+	b.mutex.Unlock()
+
+	return Stats{
+		Subscribers:  subscribers,
+		Published:    b.published.Load(),
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+	}
+}
+
+// broker delivers the events published by the API to open streams.
+var broker = NewBroker(int(config.Env.EventQueueSize), ParsePolicy(config.Env.EventSlowPolicy))
+
+// Subscribe adds a subscriber receiving the events matching the filter, for
+// streams other than SSE. It returns false once the server is shutting down.
+func Subscribe(filter Filter) (*Subscriber, bool) {
+	return broker.Subscribe(filter)
+}
+
+// Unsubscribe removes a subscriber.
+func Unsubscribe(s *Subscriber) {
+	broker.Unsubscribe(s)
+}
+
+// SetFilter changes which events a subscriber receives from now on.
+func SetFilter(s *Subscriber, filter Filter) {
+	broker.SetFilter(s, filter)
+}
+
+// Close ends all open streams. Call it before shutting the server down,
+// which otherwise waits for streams that never finish.
+func Close() {
+	broker.Close()
+}
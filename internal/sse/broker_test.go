@@ -0,0 +1,160 @@
+package sse
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, s *Subscriber) Event {
+	t.Helper()
+
+	select {
+	case event := <-s.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("subscriber received nothing")
+		return Event{}
+	}
+}
+
+func isDone(s *Subscriber) bool {
+	select {
+	case <-s.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker(4, Disconnect)
+
+	all, _ := b.Subscribe(Filter{})
+	orders, _ := b.Subscribe(Filter{Topics: []string{"order"}})
+	table, _ := b.Subscribe(Filter{Tables: map[string]bool{"t1": true}})
+
+	b.Publish(Event{ID: 1, Type: OrderCreated, TableID: "t1"})
+	b.Publish(Event{ID: 2, Type: TableStatus, TableID: "t2"})
+
+	assert.Equal(t, int64(1), receive(t, all).ID)
+	assert.Equal(t, int64(2), receive(t, all).ID)
+	assert.Equal(t, int64(1), receive(t, orders).ID)
+	assert.Equal(t, int64(1), receive(t, table).ID)
+	assert.Empty(t, orders.Events())
+	assert.Empty(t, table.Events())
+
+	assert.Equal(t, Stats{Subscribers: 3, Published: 2}, b.Stats())
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	t.Run("drop", func(t *testing.T) {
+		b := NewBroker(2, Drop)
+		slow, _ := b.Subscribe(Filter{})
+		fast, _ := b.Subscribe(Filter{})
+
+		for id := int64(1); id <= 3; id++ {
+			b.Publish(Event{ID: id, Type: OrderCreated})
+			assert.Equal(t, id, receive(t, fast).ID)
+		}
+
+		assert.False(t, isDone(slow))
+		assert.Equal(t, int64(1), receive(t, slow).ID)
+		assert.Equal(t, int64(2), receive(t, slow).ID)
+		assert.Empty(t, slow.Events())
+		assert.Equal(t, Stats{Subscribers: 2, Published: 3, Dropped: 1}, b.Stats())
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		b := NewBroker(2, Disconnect)
+		slow, _ := b.Subscribe(Filter{})
+		fast, _ := b.Subscribe(Filter{})
+
+		for id := int64(1); id <= 4; id++ {
+			b.Publish(Event{ID: id, Type: OrderCreated})
+			assert.Equal(t, id, receive(t, fast).ID)
+		}
+
+		assert.True(t, isDone(slow))
+		assert.False(t, isDone(fast))
+		assert.Equal(t, Stats{Subscribers: 1, Published: 4, Dropped: 1, Disconnected: 1}, b.Stats())
+	})
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker(1, Disconnect)
+	s, _ := b.Subscribe(Filter{})
+
+	b.Unsubscribe(s)
+	b.Unsubscribe(s)
+	b.Publish(Event{ID: 1, Type: OrderCreated})
+
+	assert.True(t, isDone(s))
+	assert.Empty(t, s.Events())
+	assert.Equal(t, 0, b.Stats().Subscribers)
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(1, Disconnect)
+	s, _ := b.Subscribe(Filter{})
+
+	b.Close()
+
+	assert.True(t, isDone(s))
+	_, ok := b.Subscribe(Filter{})
+	assert.False(t, ok)
+
+	b.Publish(Event{ID: 1, Type: OrderCreated})
+	b.Unsubscribe(s)
+	assert.Equal(t, Stats{}, b.Stats())
+}
+
+// TestBrokerConcurrent publishes while subscribers come and go, and is meant
+// to be run with -race.
+func TestBrokerConcurrent(t *testing.T) {
+	b := NewBroker(8, Disconnect)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := int64(1); id <= 200; id++ {
+				b.Publish(Event{ID: id, Type: OrderCreated, TableID: "t1"})
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s, ok := b.Subscribe(Filter{Tables: map[string]bool{"t1": true}})
+				if !ok {
+					return
+				}
+			drain:
+				for k := 0; k < 5; k++ {
+					select {
+					case <-s.Events():
+					case <-s.Done():
+						break drain
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+				b.Unsubscribe(s)
+			}
+		}()
+	}
+
+	wg.Wait()
+	b.Close()
+
+	stats := b.Stats()
+	assert.Equal(t, 0, stats.Subscribers)
+	assert.Equal(t, int64(800), stats.Published)
+	assert.LessOrEqual(t, stats.Disconnected, stats.Dropped)
+}
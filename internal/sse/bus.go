@@ -0,0 +1,196 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+const (
+	busRetry     = 2 * time.Second // wait before reading the log again after an error
+	saveInterval = time.Second     // how often an instance saves where it stopped reading
+)
+
+// Server error codes
+const (
+	codeIllegalOperation       = 20    // change streams on a standalone server
+	codeChangeStreamHistory    = 286   // resume token no longer in the oplog
+	codeChangeStreamStandalone = 40573 // change streams on a standalone server
+)
+
+// position is where an instance stopped reading the event log, so it goes on
+// from there after a lost connection or a restart.
+type position struct {
+	Instance    string    `bson:"_id"`
+	ResumeToken bson.Raw  `bson:"resume_token,omitempty"` // of the change stream
+	LastID      int64     `bson:"last_id"`                // when tailing the log
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// follower forwards the events logged by every instance to the subscribers
+// of this one. It watches the log with a change stream, or tails it on
+// standalone servers, which don't support change streams.
+type follower struct {
+	events    *mongo.Collection
+	positions *mongo.Collection
+	position  position
+	savedAt   time.Time
+}
+
+// follow reads the event log until the context is cancelled. lastID is the
+// last event logged, where an instance without a saved position starts.
+func follow(ctx context.Context, client db.IMongoClient, lastID int64) {
+	f := &follower{
+		events:    client.GetCollection(config.Env.DatabaseName, "events"),
+		positions: client.GetCollection(config.Env.DatabaseName, "event_positions"),
+		position:  position{Instance: instanceID(), LastID: lastID},
+	}
+
+	err := f.positions.FindOne(ctx, bson.D{{Key: "_id", Value: f.position.Instance}}).Decode(&f.position)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Failed to load the event log position: %v", err)
+	}
+
+	tail := false
+	for ctx.Err() == nil {
+		if tail {
+			err = f.tail(ctx)
+		} else {
+			err = f.watch(ctx)
+		}
+
+		var serverErr mongo.ServerError
+		switch {
+		case ctx.Err() != nil:
+		case errors.As(err, &serverErr) && (serverErr.HasErrorCode(codeChangeStreamStandalone) ||
+			serverErr.HasErrorCode(codeIllegalOperation)):
+			log.Println("Change streams are not supported, tailing the event log instead")
+			tail = true
+			continue
+		case errors.As(err, &serverErr) && serverErr.HasErrorCode(codeChangeStreamHistory):
+			log.Println("Event log position is too old, following new events only")
+			f.position.ResumeToken = nil
+			continue
+		case err != nil:
+			log.Printf("Failed to follow the event log: %v", err)
+		}
+
+		f.save()
+		select {
+		case <-ctx.Done():
+		case <-time.After(busRetry):
+		}
+	}
+}
+
+// watch forwards the events inserted into the log, starting after the saved
+// resume token.
+func (f *follower) watch(ctx context.Context) error {
+	opts := options.ChangeStream()
+	if f.position.ResumeToken != nil {
+		opts.SetResumeAfter(f.position.ResumeToken)
+	}
+
+	stream, err := f.events.Watch(
+		ctx,
+		mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}},
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change struct {
+			Event record `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			return err
+		}
+
+		f.position.ResumeToken = append(bson.Raw(nil), stream.ResumeToken()...)
+		f.deliver(change.Event)
+	}
+	return stream.Err()
+}
+
+// tail forwards the events logged after the last one delivered. The log is
+// read from the last delivered event on, since a tailable cursor that finds
+// nothing at first is closed right away.
+func (f *follower) tail(ctx context.Context) error {
+	start := f.position.LastID
+	cursor, err := f.events.Find(
+		ctx,
+		bson.D{{Key: "_id", Value: bson.M{"$gte": start}}},
+		options.Find().SetCursorType(options.TailableAwait),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		var r record
+		if err := cursor.Decode(&r); err != nil {
+			return err
+		}
+		if r.ID != start {
+			f.deliver(r)
+		}
+	}
+	return cursor.Err()
+}
+
+// deliver publishes a logged event to this instance's subscribers.
+func (f *follower) deliver(r record) {
+	seen(r.ID)
+	broker.Publish(r.event())
+
+	f.position.LastID = max(f.position.LastID, r.ID)
+	if time.Since(f.savedAt) >= saveInterval {
+		f.save()
+	}
+}
+
+// save stores the position, so a restarted instance doesn't miss events
+// logged while it was down.
+func (f *follower) save() {
+	ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+	defer cancel()
+
+	f.position.UpdatedAt = time.Now()
+	_, err := f.positions.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: f.position.Instance}},
+		f.position,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Failed to save the event log position: %v", err)
+		return
+	}
+	f.savedAt = time.Now()
+}
+
+// instanceID names this instance, so each instance of the API keeps its own
+// position in the event log.
+func instanceID() string {
+	if config.Env.InstanceID != "" {
+		return config.Env.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "api"
+	}
+	return hostname
+}
@@ -0,0 +1,120 @@
+package sse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+)
+
+func TestFollowerDeliver(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("delivers and saves the position", func(mt *mtest.T) {
+		useLastID(mt.T, 3)
+		s, _ := Subscribe(Filter{})
+		defer Unsubscribe(s)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		f := &follower{positions: mt.Coll, position: position{Instance: "api-1", LastID: 3}}
+
+		f.deliver(record{ID: 4, Type: OrderCreated, TableID: "t1", Payload: []byte(`{}`)})
+
+		event := receive(t, s)
+		assert.Equal(t, int64(4), event.ID)
+		assert.Equal(t, "t1", event.TableID)
+		assert.Equal(t, int64(4), LastID())
+		assert.Equal(t, int64(4), f.position.LastID)
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "api-1", update.Lookup("q", "_id").StringValue())
+		assert.Equal(t, int64(4), update.Lookup("u", "last_id").Int64())
+		assert.True(t, update.Lookup("upsert").Boolean())
+	})
+
+	mt.Run("saves at most once a second", func(mt *mtest.T) {
+		useLastID(mt.T, 3)
+		f := &follower{positions: mt.Coll, position: position{LastID: 3}, savedAt: time.Now()}
+
+		f.deliver(record{ID: 4, Type: OrderCreated})
+
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("older events keep the position", func(mt *mtest.T) {
+		useLastID(mt.T, 9)
+		f := &follower{positions: mt.Coll, position: position{LastID: 9}, savedAt: time.Now()}
+
+		f.deliver(record{ID: 7, Type: OrderCreated})
+
+		assert.Equal(t, int64(9), f.position.LastID)
+		assert.Equal(t, int64(9), LastID())
+	})
+}
+
+func TestFollowerWatch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("inserted events with their resume token", func(mt *mtest.T) {
+		useLastID(mt.T, 4)
+		s, _ := Subscribe(Filter{})
+		defer Unsubscribe(s)
+		change := bson.D{
+			{Key: "_id", Value: bson.D{{Key: "_data", Value: "token-5"}}},
+			{Key: "operationType", Value: "insert"},
+			{Key: "fullDocument", Value: bson.D{
+				{Key: "_id", Value: int64(5)},
+				{Key: "type", Value: OrderCreated},
+				{Key: "payload", Value: []byte(`{}`)},
+			}},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, change))
+		f := &follower{events: mt.Coll, positions: mt.Coll, savedAt: time.Now()}
+
+		err := f.watch(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), receive(t, s).ID)
+		assert.Equal(t, "token-5", f.position.ResumeToken.Lookup("_data").StringValue())
+	})
+}
+
+func TestFollowerTail(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("events after the last delivered", func(mt *mtest.T) {
+		useLastID(mt.T, 2)
+		s, _ := Subscribe(Filter{})
+		defer Unsubscribe(s)
+		mt.AddMockResponses(logged(2, 3, 4))
+		f := &follower{events: mt.Coll, positions: mt.Coll, position: position{LastID: 2}, savedAt: time.Now()}
+
+		err := f.tail(context.Background())
+
+		assert.NoError(t, err)
+		// The last delivered event is only read to start the cursor
+		assert.Equal(t, int64(3), receive(t, s).ID)
+		assert.Equal(t, int64(4), receive(t, s).ID)
+		assert.Empty(t, s.Events())
+		assert.Equal(t, int64(4), f.position.LastID)
+
+		find := mt.GetStartedEvent().Command
+		assert.Equal(t, int64(2), find.Lookup("filter", "_id", "$gte").Int64())
+		assert.True(t, find.Lookup("tailable").Boolean())
+	})
+}
+
+func TestInstanceID(t *testing.T) {
+	instance := config.Env.InstanceID
+	t.Cleanup(func() { config.Env.InstanceID = instance })
+
+	config.Env.InstanceID = "api-2"
+	assert.Equal(t, "api-2", instanceID())
+
+	config.Env.InstanceID = ""
+	assert.NotEmpty(t, instanceID())
+}
@@ -0,0 +1,233 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Event types, named after the entity and what happened to it
+const (
+	OrderCreated = "order.created"
+	OrderUpdated = "order.updated" // lines, discounts or voids changed
+	OrderServed  = "order.served"
+	OrderReady   = "order.ready" // lines bumped as prepared at a station
+	OrderClosed  = "order.closed"
+	OrderMoved   = "order.moved" // moved, transferred or merged to another table
+
+	TableCreated = "table.created"
+	TableUpdated = "table.updated"
+	TableDeleted = "table.deleted"
+	TableStatus  = "table.status" // a party sat down or left
+
+	SessionUpdated = "session.updated"
+	BillCreated    = "bill.created"
+	BillUpdated    = "bill.updated"
+	PaymentCreated = "payment.created"
+
+	ServiceRequested    = "service.requested" // a customer called a waiter or asked for the bill
+	ServiceAcknowledged = "service.acknowledged"
+	ServiceResolved     = "service.resolved"
+
+	MenuChanged = "menu.changed"
+
+	UserCreated = "user.created"
+	UserDeleted = "user.deleted"
+
+	// Resync tells a reconnecting client that events it missed are gone
+	// and it has to load everything again
+	Resync = "resync"
+)
+
+// Table statuses sent with table.status events
+const (
+	StatusOccupied = "occupied"
+	StatusFree     = "free"
+)
+
+// Event is a change pushed to subscribers. It is sent with its ID and type
+// as the SSE id and event fields, and as JSON in the data field.
+type Event struct {
+	ID       int64     `json:"id"`
+	Type     string    `json:"type"`
+	TableID  string    `json:"tableId,omitempty"`  // table the event concerns, if any
+	Stations []string  `json:"stations,omitempty"` // stations preparing the order's lines, for order events
+	Data     any       `json:"data"`
+	Time     time.Time `json:"time"`
+	Key      string    `json:"key,omitempty"` // deduplication key of events that may be published more than once
+
+	payload []byte
+}
+
+// Topic returns the entity the event is about, such as order or table.
+func (e Event) Topic() string {
+	topic, _, _ := strings.Cut(e.Type, ".")
+	return topic
+}
+
+// Payload returns the event encoded as JSON, as sent in the SSE data field.
+func (e Event) Payload() json.RawMessage {
+	return e.payload
+}
+
+// LastID returns the highest event ID published so far.
+func LastID() int64 {
+	return lastID.Load()
+}
+
+// TableStatusData is the payload of table.status events.
+type TableStatusData struct {
+	TableID   string `json:"tableId"`
+	SessionID string `json:"sessionId,omitempty"`
+	Status    string `json:"status"`
+}
+
+var (
+	// lastID is the highest event ID this instance has seen
+	lastID atomic.Int64
+
+	// publishing is serialized so an instance logs its events in the order
+	// of their IDs. Requests don't wait for it, their events are logged by
+	// the publisher and the outbox dispatcher.
+	publishMutex sync.Mutex
+
+	// queue holds the events published with PublishEvent until the
+	// publisher logs them
+	queue = make(chan Event, publishQueueSize)
+)
+
+const (
+	// publishQueueSize is how many events can wait to be logged before
+	// PublishEvent waits for the event log.
+	publishQueueSize = 1024
+
+	// maxLogAttempts is how often an event is logged with the next ID while
+	// other instances take it first.
+	maxLogAttempts = 10
+)
+
+// seen records that an event ID was published.
+func seen(id int64) {
+	for {
+		last := lastID.Load()
+		if id <= last || lastID.CompareAndSwap(last, id) {
+			return
+		}
+	}
+}
+
+// Publish sends an event to every subscriber. tableID is the hex ID of the
+// table the event concerns, or empty.
+func Publish(eventType string, tableID string, data any) {
+	PublishEvent(Event{Type: eventType, TableID: tableID, Data: data})
+}
+
+// PublishEvent sends an event with its type, table and stations set to every
+// subscriber whose filter it matches, on every instance once Start was
+// called. Once it was, the event is logged in the background.
+func PublishEvent(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if eventLog != nil {
+		queue <- event
+		return
+	}
+	if err := publish(event); err != nil {
+		log.Printf("Failed to publish %s event: %v", event.Type, err)
+	}
+}
+
+// publishQueued logs the events published with PublishEvent, in the order
+// they were published.
+func publishQueued() {
+	for event := range queue {
+		if err := publish(event); err != nil {
+			log.Printf("Failed to publish %s event: %v", event.Type, err)
+		}
+	}
+}
+
+// PublishOnce publishes an event unless one with the same key was logged
+// already, for events that may be published more than once such as those of
+// the outbox. It returns an error when the event could not be logged, and
+// the event is then left for the caller to publish again.
+func PublishOnce(key string, event Event) error {
+	event.Key = key
+	return publish(event)
+}
+
+func publish(event Event) error {
+	publishMutex.Lock()
+	defer publishMutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if eventLog == nil {
+		event.ID = lastID.Add(1)
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		event.payload = payload
+
+		broker.Publish(event)
+		return nil
+	}
+
+	// Logged events reach the subscribers of every instance through the bus
+	var err error
+	for attempt := 1; ; attempt++ {
+		event.ID, err = nextID()
+		if err != nil {
+			return err
+		}
+		event.payload, err = json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		err = appendLog(event)
+		if !mongo.IsDuplicateKeyError(err) || attempt == maxLogAttempts {
+			break
+		}
+
+		// Another instance logged an event with the ID first, unless this
+		// event was logged already
+		if event.Key != "" {
+			logged, err := keyLogged(event.Key)
+			if err != nil {
+				return err
+			}
+			if logged {
+				return nil
+			}
+		}
+	}
+	if err != nil {
+		// Events with a key are published again, those without reach at
+		// least this instance's subscribers
+		if event.Key == "" {
+			seen(event.ID)
+			broker.Publish(event)
+		}
+		return fmt.Errorf("failed to log event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// TableStatusEvent tells subscribers a party sat down at or left a table.
+func TableStatusEvent(tableID, sessionID, status string) Event {
+	return Event{
+		Type:    TableStatus,
+		TableID: tableID,
+		Data:    TableStatusData{TableID: tableID, SessionID: sessionID, Status: status},
+	}
+}
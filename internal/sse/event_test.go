@@ -0,0 +1,151 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// useLog makes the mock the event log for the duration of a test.
+func useLog(t *testing.T, mt *mtest.T) {
+	eventLog = db.NewMockMongoClient(mt.Coll)
+	t.Cleanup(func() { eventLog = nil })
+}
+
+// newest answers the lookup of the newest event logged.
+func newest(id int64) bson.D {
+	return mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, bson.D{{Key: "_id", Value: id}})
+}
+
+var (
+	inserted  = mtest.CreateSuccessResponse()
+	logFailed = mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "down"})
+	takenID   = mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+)
+
+func TestPublish(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("requests don't wait for the log", func(mt *mtest.T) {
+		useLog(t, mt)
+
+		PublishEvent(Event{Type: OrderCreated})
+
+		event := <-queue
+		assert.Equal(t, OrderCreated, event.Type)
+		assert.False(t, event.Time.IsZero())
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("unlogged events reach local subscribers", func(mt *mtest.T) {
+		useLog(t, mt)
+		s, _ := Subscribe(Filter{})
+		defer Unsubscribe(s)
+		mt.AddMockResponses(newest(6), logFailed)
+
+		err := publish(Event{Type: OrderCreated})
+
+		assert.Error(t, err)
+		assert.Equal(t, int64(7), receive(t, s).ID)
+	})
+
+	mt.Run("logged with the ID following the newest", func(mt *mtest.T) {
+		useLog(t, mt)
+		mt.AddMockResponses(newest(6), inserted)
+
+		err := publish(Event{Type: OrderCreated})
+
+		assert.NoError(t, err)
+		find := mt.GetStartedEvent().Command
+		assert.Equal(t, int32(-1), find.Lookup("sort", "_id").Int32())
+		insert := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(7), insert.Lookup("_id").Int64())
+	})
+
+	mt.Run("ID taken by another instance", func(mt *mtest.T) {
+		useLog(t, mt)
+		mt.AddMockResponses(newest(6), takenID, newest(7), inserted)
+
+		err := publish(Event{Type: OrderCreated})
+
+		assert.NoError(t, err)
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		insert := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(8), insert.Lookup("_id").Int64())
+		var payload struct {
+			ID int64 `json:"id"`
+		}
+		_, data := insert.Lookup("payload").Binary()
+		assert.NoError(t, json.Unmarshal(data, &payload))
+		assert.Equal(t, int64(8), payload.ID)
+	})
+
+	mt.Run("events published again are logged once", func(mt *mtest.T) {
+		useLog(t, mt)
+		// The key is taken rather than the ID
+		mt.AddMockResponses(newest(6), takenID,
+			mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}))
+
+		err := PublishOnce("key", Event{Type: OrderCreated})
+
+		assert.NoError(t, err)
+	})
+
+	mt.Run("events published again are not delivered until logged", func(mt *mtest.T) {
+		useLog(t, mt)
+		s, _ := Subscribe(Filter{})
+		defer Unsubscribe(s)
+		mt.AddMockResponses(newest(6), logFailed)
+
+		err := PublishOnce("key", Event{Type: OrderCreated})
+
+		assert.Error(t, err)
+		assert.Empty(t, s.Events())
+	})
+}
+
+func TestEventTopic(t *testing.T) {
+	assert.Equal(t, "order", Event{Type: OrderServed}.Topic())
+	assert.Equal(t, "service", Event{Type: ServiceRequested}.Topic())
+	assert.Equal(t, "resync", Event{Type: Resync}.Topic())
+}
+
+func TestPublishPayload(t *testing.T) {
+	s, _ := Subscribe(Filter{})
+	defer Unsubscribe(s)
+
+	Publish(OrderCreated, "table-1", map[string]int{"quantity": 2})
+	PublishEvent(TableStatusEvent("table-1", "session-1", StatusOccupied))
+
+	first, second := receive(t, s), receive(t, s)
+	assert.Equal(t, first.ID+1, second.ID)
+	assert.Equal(t, second.ID, LastID())
+
+	var payload struct {
+		ID      int64           `json:"id"`
+		Type    string          `json:"type"`
+		TableID string          `json:"tableId"`
+		Data    TableStatusData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(second.Payload(), &payload))
+	assert.Equal(t, second.ID, payload.ID)
+	assert.Equal(t, TableStatus, payload.Type)
+	assert.Equal(t, "table-1", payload.TableID)
+	assert.Equal(t, TableStatusData{TableID: "table-1", SessionID: "session-1", Status: StatusOccupied}, payload.Data)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var w bytes.Buffer
+	event := Event{ID: 12, Type: OrderReady, payload: []byte(`{"id":12}`)}
+
+	assert.NoError(t, writeEvent(&w, event))
+	assert.Equal(t, "id: 12\nevent: order.ready\ndata: {\"id\":12}\n\n", w.String())
+}
@@ -0,0 +1,134 @@
+package sse
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// Topics are the entities events are published about.
+var Topics = []string{"order", "table", "session", "bill", "payment", "service", "menu", "user"}
+
+// customerTopics are the topics customers may follow for their own table.
+var customerTopics = []string{"order", "table", "bill", "payment", "service", "menu"}
+
+// Filter decides which events a subscriber receives. Nil fields let every
+// event through, an empty but non-nil list of topics none. Events that
+// concern no table or station are not filtered by tables or stations.
+type Filter struct {
+	Topics   []string        // e.g. order or table, nil for all topics
+	Tables   map[string]bool // hex table IDs, nil for all tables
+	Stations []string        // e.g. kitchen or bar, nil for all stations
+	Strict   bool            // drop events that concern no table, except menu changes
+}
+
+// Match reports whether an event passes the filter.
+func (f Filter) Match(event Event) bool {
+	if f.Topics != nil && !slices.Contains(f.Topics, event.Topic()) {
+		return false
+	}
+
+	if event.TableID == "" {
+		if f.Strict && event.Topic() != "menu" {
+			return false
+		}
+	} else if f.Tables != nil && !f.Tables[event.TableID] {
+		return false
+	}
+
+	if f.Stations != nil && len(event.Stations) > 0 &&
+		!slices.ContainsFunc(event.Stations, func(station string) bool {
+			return slices.Contains(f.Stations, station)
+		}) {
+		return false
+	}
+
+	return true
+}
+
+// CustomerFilter returns the filter of a customer device at a table, which
+// only receives events of that table and menu changes.
+func CustomerFilter(tableID string) Filter {
+	return Filter{
+		Topics: customerTopics,
+		Tables: map[string]bool{tableID: true},
+		Strict: true,
+	}
+}
+
+// ParseFilter builds a staff subscriber's filter from the comma separated
+// topic, table, zone and station query parameters. Zones are resolved to
+// their tables when subscribing.
+func ParseFilter(ctx context.Context, client db.IMongoClient, query func(string) string) (Filter, error) {
+	filter := Filter{
+		Topics:   splitParam(query("topic")),
+		Stations: splitParam(query("station")),
+	}
+
+	tables := splitParam(query("table"))
+	zones := splitParam(query("zone"))
+	if len(tables) == 0 && len(zones) == 0 {
+		return filter, nil
+	}
+
+	filter.Tables = make(map[string]bool)
+	for _, table := range tables {
+		filter.Tables[table] = true
+	}
+
+	zoneTables, err := ZoneTables(ctx, client, zones)
+	if err != nil {
+		return Filter{}, err
+	}
+	for _, table := range zoneTables {
+		filter.Tables[table] = true
+	}
+
+	return filter, nil
+}
+
+// ZoneTables returns the hex IDs of the tables in the zones.
+func ZoneTables(ctx context.Context, client db.IMongoClient, zones []string) ([]string, error) {
+	if len(zones) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := client.GetCollection(config.Env.DatabaseName, "tables").Find(
+		ctx,
+		bson.D{{Key: "zone", Value: bson.M{"$in": zones}}},
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var zoneTables []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &zoneTables); err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, len(zoneTables))
+	for i, table := range zoneTables {
+		tables[i] = table.ID.Hex()
+	}
+	return tables, nil
+}
+
+func splitParam(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,97 @@
+package sse
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func TestFilterMatch(t *testing.T) {
+	order := Event{Type: OrderCreated, TableID: "t1", Stations: []string{"bar", "kitchen"}}
+	otherTable := Event{Type: OrderCreated, TableID: "t2"}
+	menu := Event{Type: MenuChanged}
+	user := Event{Type: UserCreated}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		event  Event
+		match  bool
+	}{
+		{"everything", Filter{}, user, true},
+		{"topic", Filter{Topics: []string{"order"}}, order, true},
+		{"other topic", Filter{Topics: []string{"table"}}, order, false},
+		{"no topics", Filter{Topics: []string{}}, order, false},
+		{"table", Filter{Tables: map[string]bool{"t1": true}}, order, true},
+		{"other table", Filter{Tables: map[string]bool{"t1": true}}, otherTable, false},
+		{"event without a table", Filter{Tables: map[string]bool{"t1": true}}, user, true},
+		{"strict without a table", Filter{Tables: map[string]bool{"t1": true}, Strict: true}, user, false},
+		{"strict menu change", Filter{Tables: map[string]bool{"t1": true}, Strict: true}, menu, true},
+		{"station", Filter{Stations: []string{"bar"}}, order, true},
+		{"other station", Filter{Stations: []string{"pastry"}}, order, false},
+		{"event without stations", Filter{Stations: []string{"pastry"}}, otherTable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.filter.Match(tt.event))
+		})
+	}
+}
+
+func TestCustomerFilter(t *testing.T) {
+	filter := CustomerFilter("t1")
+
+	assert.True(t, filter.Match(Event{Type: BillUpdated, TableID: "t1"}))
+	assert.True(t, filter.Match(Event{Type: MenuChanged}))
+	assert.False(t, filter.Match(Event{Type: BillUpdated, TableID: "t2"}))
+	assert.False(t, filter.Match(Event{Type: SessionUpdated, TableID: "t1"}))
+	assert.False(t, filter.Match(Event{Type: UserCreated}))
+}
+
+func TestParseFilter(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	terrace := primitive.NewObjectID()
+
+	parse := func(mt *mtest.T, query string) (Filter, error) {
+		values, _ := url.ParseQuery(query)
+		return ParseFilter(context.Background(), db.NewMockMongoClient(mt.Coll), values.Get)
+	}
+
+	mt.Run("topics and stations", func(mt *mtest.T) {
+		filter, err := parse(mt, "topic=order,%20table,&station=bar")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Filter{Topics: []string{"order", "table"}, Stations: []string{"bar"}}, filter)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("tables and zones", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.tables", mtest.FirstBatch, bson.D{{Key: "_id", Value: terrace}}))
+
+		filter, err := parse(mt, "table=t1&zone=terrace")
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]bool{"t1": true, terrace.Hex(): true}, filter.Tables)
+		zones := mt.GetStartedEvent().Command.Lookup("filter", "zone", "$in").Array()
+		assert.Equal(t, "terrace", zones.Index(0).Value().StringValue())
+	})
+
+	mt.Run("zone without tables", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.tables", mtest.FirstBatch))
+
+		filter, err := parse(mt, "zone=patio")
+
+		assert.NoError(t, err)
+		// Nothing matches rather than everything
+		assert.NotNil(t, filter.Tables)
+		assert.False(t, filter.Match(Event{Type: OrderCreated, TableID: "t1"}))
+	})
+}
@@ -1,57 +1,165 @@
 package sse
 
 import (
+	"context"
 	"fmt"
-	"sync"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-)
 
-// Map to store SSE client connections
-var (
-	clients = make(map[chan string]bool)
-	mutex   = sync.Mutex{}
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
-// SseHandler handles Server-Sent Events (SSE) connections.
+// retryInterval is how long EventSource waits before reconnecting.
+const retryInterval = 3 * time.Second
+
+// SseHandler handles Server-Sent Events (SSE) connections of staff devices.
 //
 // @Summary Handle SSE connection
-// @Description Establishes an SSE connection to receive real-time updates.
+// @Description Establishes an SSE connection to receive real-time updates. Every message has an id, an event type
+// @Description such as order.created or table.status, and a JSON data field with the event and the entity it concerns.
+// @Description The token can be sent as the access_token query parameter or cookie, since EventSource can't set headers.
+// @Description Filters are comma separated and combined: topics, tables (or the tables of zones) and stations.
 // @Tags SSE
 // @Produce text/event-stream
+// @Param access_token query string false "Staff token, when not sent in the Authorization header or a cookie"
+// @Param topic query string false "Topics to receive, e.g. order,table"
+// @Param table query string false "Table IDs to receive events of"
+// @Param zone query string false "Zones whose tables to receive events of"
+// @Param station query string false "Stations whose order events to receive, e.g. kitchen"
+// @Security bearerToken
 // @Success 200 {string} string "SSE stream opened"
+// @Failure 401 "Token missing or invalid"
 // @Router /events [get]
-func SseHandler(c *gin.Context) {
+func SseHandler(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := ParseFilter(c.Request.Context(), client, c.Query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		Stream(c, filter, func(ctx context.Context) bool { return auth.Revoked(ctx, c) })
+	}
+}
+
+// Stream sends the events matching the filter to the client until it
+// disconnects or, checked with every heartbeat, its token was revoked. A
+// client reconnecting with Last-Event-ID first gets the events it missed, or a
+// resync event when they are no longer logged.
+func Stream(c *gin.Context, filter Filter, revoked func(context.Context) bool) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
 
-	messageChan := make(chan string)
-	mutex.Lock()
-	clients[messageChan] = true
-	mutex.Unlock()
+	// Subscribe before replaying so no event falls between the two
+	subscriber, ok := broker.Subscribe(filter)
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+		return
+	}
+	defer broker.Unsubscribe(subscriber)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", retryInterval.Milliseconds())
+	c.Writer.Flush()
+
+	var replayed map[int64]bool
+	if lastEventID, ok := parseLastEventID(c); ok {
+		var err error
+		replayed, err = Replay(c.Request.Context(), lastEventID, filter, func(event Event) error {
+			return writeEvent(c.Writer, event)
+		})
+		if err != nil {
+			if err != ErrLogGap {
+				log.Printf("Failed to replay events: %v", err)
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: {}\n\n", lastID.Load(), Resync)
+		}
+		c.Writer.Flush()
+	}
+
+	heartbeat := time.NewTicker(config.Env.EventHeartbeat)
+	defer heartbeat.Stop()
 
 	// Send updates while connection is open
 	for {
 		select {
-		case msg := <-messageChan:
-			fmt.Fprintf(c.Writer, "data: %s\n\n", msg)
+		case event := <-subscriber.Events():
+			// Events already replayed are not sent twice
+			if replayed[event.ID] {
+				delete(replayed, event.ID)
+				continue
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			// Logging out ends the stream, reconnecting fails with 401
+			if revoked(c.Request.Context()) {
+				return
+			}
+			// Comments keep proxies from closing idle connections
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
 			c.Writer.Flush()
-		case <-c.Writer.CloseNotify():
-			mutex.Lock()
-			delete(clients, messageChan)
-			mutex.Unlock()
-			close(messageChan)
+		case <-subscriber.Done():
+			// Fell behind or the server is shutting down, a client that
+			// reconnects catches up with Last-Event-ID
+			return
+		case <-c.Request.Context().Done():
 			return
 		}
 	}
 }
 
-// Notify all connected clients
-func Notify(message string) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	for client := range clients {
-		client <- message
+// parseLastEventID reads the ID of the last event a reconnecting client
+// received, from the Last-Event-ID header EventSource sends or the
+// lastEventId query parameter.
+func parseLastEventID(c *gin.Context) (int64, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeEvent writes an event in the SSE format.
+func writeEvent(w io.Writer, event Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.payload)
+	return err
+}
+
+// GetStats returns the number of open streams and how many events were
+// dropped for streams that fell behind.
+//
+// @Summary Get event stream statistics
+// @Description Returns the number of open event streams, events published, events dropped because a stream's queue
+// @Description was full, and streams disconnected for falling behind since the server started.
+// @Tags SSE
+// @Produce json
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "data: stream statistics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /events/stats [get]
+func GetStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": broker.Stats()})
 	}
 }
@@ -0,0 +1,200 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+const logTimeout = 5 * time.Second
+
+// ErrLogGap is returned when events a client missed are no longer in the
+// log, so it has to load everything again.
+var ErrLogGap = errors.New("missed events are no longer available")
+
+// eventLog keeps published events for clients reconnecting with
+// Last-Event-ID and passes them between instances. It is nil until Start is
+// called, events are then only delivered to this instance's subscribers.
+var eventLog db.IMongoClient
+
+// record is an event as stored in the log.
+type record struct {
+	ID       int64     `bson:"_id"`
+	Type     string    `bson:"type"`
+	TableID  string    `bson:"table_id,omitempty"`
+	Stations []string  `bson:"stations,omitempty"`
+	Payload  []byte    `bson:"payload"`
+	Time     time.Time `bson:"time"`
+	Key      string    `bson:"key,omitempty"`
+}
+
+func (r record) event() Event {
+	return Event{
+		ID:       r.ID,
+		Type:     r.Type,
+		TableID:  r.TableID,
+		Stations: r.Stations,
+		Time:     r.Time,
+		Key:      r.Key,
+		payload:  r.Payload,
+	}
+}
+
+// Start creates the capped event log if needed, makes sure event IDs continue
+// after the last one logged and starts forwarding the events published by
+// every instance to this instance's subscribers.
+func Start(ctx context.Context, client db.IMongoClient) {
+	collection := client.GetCollection(config.Env.DatabaseName, "events")
+
+	// The oldest events make room for new ones once the log is full
+	err := collection.Database().CreateCollection(
+		ctx,
+		"events",
+		options.CreateCollection().
+			SetCapped(true).
+			SetMaxDocuments(config.Env.EventLogSize).
+			SetSizeInBytes(config.Env.EventLogSize*4096),
+	)
+	var commandErr mongo.CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists") {
+		log.Printf("Failed to create the event log: %v", err)
+	}
+
+	// Events published more than once are logged once
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("Failed to create the event log index: %v", err)
+	}
+
+	var last record
+	err = collection.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Failed to read the last event ID: %v", err)
+	}
+
+	seen(last.ID)
+	eventLog = client
+
+	go publishQueued()
+	go follow(ctx, client, last.ID)
+}
+
+// nextID returns the ID following the newest event logged. An event is only
+// logged with the ID that follows, so IDs follow the order events are logged
+// in, which is the order the other instances read them in, and a client that
+// received an event has received every one logged before.
+func nextID() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+	defer cancel()
+
+	var last record
+	err := eventLog.GetCollection(config.Env.DatabaseName, "events").FindOne(
+		ctx,
+		bson.D{},
+		options.FindOne().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+	return last.ID + 1, nil
+}
+
+// keyLogged reports whether an event with the key was logged.
+func keyLogged(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+	defer cancel()
+
+	count, err := eventLog.GetCollection(config.Env.DatabaseName, "events").CountDocuments(
+		ctx,
+		bson.D{{Key: "key", Value: key}},
+		options.Count().SetLimit(1),
+	)
+	return count > 0, err
+}
+
+// appendLog stores an event for replay and for the other instances.
+func appendLog(event Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+	defer cancel()
+
+	_, err := eventLog.GetCollection(config.Env.DatabaseName, "events").InsertOne(ctx, record{
+		ID:       event.ID,
+		Type:     event.Type,
+		TableID:  event.TableID,
+		Stations: event.Stations,
+		Payload:  event.payload,
+		Time:     event.Time,
+		Key:      event.Key,
+	})
+	return err
+}
+
+// Replay sends the logged events after the given ID that match the filter
+// and returns the IDs of the events sent. It returns ErrLogGap when some of
+// the events after the ID are no longer logged.
+func Replay(ctx context.Context, afterID int64, filter Filter, send func(Event) error) (map[int64]bool, error) {
+	sent := make(map[int64]bool)
+	if afterID == lastID.Load() {
+		return sent, nil
+	}
+	if eventLog == nil {
+		return sent, ErrLogGap
+	}
+
+	collection := eventLog.GetCollection(config.Env.DatabaseName, "events")
+
+	var oldest, newest record
+	err := collection.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: 1}})).Decode(&oldest)
+	if err == nil {
+		err = collection.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&newest)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return sent, ErrLogGap
+		}
+		return sent, err
+	}
+	// A client ahead of the log missed a reset that lost events
+	if oldest.ID > afterID+1 || afterID > newest.ID {
+		return sent, ErrLogGap
+	}
+
+	cursor, err := collection.Find(
+		ctx,
+		bson.D{{Key: "_id", Value: bson.M{"$gt": afterID}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return sent, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var r record
+		if err := cursor.Decode(&r); err != nil {
+			return sent, err
+		}
+
+		event := r.event()
+		if filter.Match(event) {
+			if err := send(event); err != nil {
+				return sent, err
+			}
+			sent[event.ID] = true
+		}
+	}
+	return sent, cursor.Err()
+}
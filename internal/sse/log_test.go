@@ -0,0 +1,146 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func logged(ids ...int64) bson.D {
+	docs := make([]bson.D, len(ids))
+	for i, id := range ids {
+		table := "t1"
+		if id%2 == 0 {
+			table = "t2"
+		}
+		docs[i] = bson.D{
+			{Key: "_id", Value: id},
+			{Key: "type", Value: OrderUpdated},
+			{Key: "table_id", Value: table},
+			{Key: "payload", Value: []byte(`{}`)},
+		}
+	}
+	return mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, docs...)
+}
+
+// useLastID sets the highest event ID seen for the duration of a test.
+func useLastID(t *testing.T, id int64) {
+	last := lastID.Load()
+	lastID.Store(id)
+	t.Cleanup(func() { lastID.Store(last) })
+}
+
+func TestReplay(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tableOne := Filter{Tables: map[string]bool{"t1": true}}
+
+	var replayed []int64
+	replay := func(afterID int64) (map[int64]bool, error) {
+		replayed = nil
+		return Replay(context.Background(), afterID, tableOne, func(event Event) error {
+			replayed = append(replayed, event.ID)
+			return nil
+		})
+	}
+
+	mt.Run("missed events matching the filter", func(mt *mtest.T) {
+		useLog(mt.T, mt)
+		useLastID(mt.T, 5)
+		mt.AddMockResponses(logged(1), logged(5), logged(3, 4, 5))
+
+		sent, err := replay(2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{3, 5}, replayed)
+		assert.Equal(t, map[int64]bool{3: true, 5: true}, sent)
+	})
+
+	mt.Run("nothing missed", func(mt *mtest.T) {
+		useLog(mt.T, mt)
+		useLastID(mt.T, 5)
+
+		sent, err := replay(5)
+
+		assert.NoError(t, err)
+		assert.Empty(t, sent)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("missed events no longer logged", func(mt *mtest.T) {
+		useLog(mt.T, mt)
+		useLastID(mt.T, 40)
+		mt.AddMockResponses(logged(10), logged(40))
+
+		_, err := replay(5)
+
+		assert.Equal(t, ErrLogGap, err)
+	})
+
+	mt.Run("client ahead of the log", func(mt *mtest.T) {
+		useLog(mt.T, mt)
+		useLastID(mt.T, 40)
+		mt.AddMockResponses(logged(10), logged(40))
+
+		_, err := replay(50)
+
+		assert.Equal(t, ErrLogGap, err)
+	})
+
+	mt.Run("empty log", func(mt *mtest.T) {
+		useLog(mt.T, mt)
+		useLastID(mt.T, 40)
+		mt.AddMockResponses(logged())
+
+		_, err := replay(5)
+
+		assert.Equal(t, ErrLogGap, err)
+	})
+
+	mt.Run("no log", func(mt *mtest.T) {
+		useLastID(mt.T, 40)
+
+		_, err := replay(5)
+
+		assert.Equal(t, ErrLogGap, err)
+	})
+}
+
+func TestParseLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		header string
+		target string
+		id     int64
+		ok     bool
+	}{
+		{"header", "12", "/events", 12, true},
+		{"query", "", "/events?lastEventId=7", 7, true},
+		{"header first", "12", "/events?lastEventId=7", 12, true},
+		{"none", "", "/events", 0, false},
+		{"malformed", "abc", "/events", 0, false},
+		{"negative", "-3", "/events", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Last-Event-ID", tt.header)
+			}
+
+			id, ok := parseLastEventID(c)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.id, id)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package table
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -9,9 +12,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/config"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
@@ -46,7 +52,16 @@ func CreateTable(client db.IMongoClient) gin.HandlerFunc {
 		}
 
 		table.CreatedAt = time.Now()
-		
+
+		// Every table starts with an active ordering token
+		nonce, expiresAt, err := newTokenState()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate table token"})
+			return
+		}
+		table.TokenNonce = nonce
+		table.TokenExpiresAt = &expiresAt
+
 		// Get the collection
 		collection := client.GetCollection(config.Env.DatabaseName, "tables")
 
@@ -54,16 +69,24 @@ func CreateTable(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Insert the item into the database
-		result, err := collection.InsertOne(ctx, table)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			result, err := collection.InsertOne(sc, table)
+			if err != nil {
+				return err
+			}
+			table.ID = result.InsertedID.(primitive.ObjectID)
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.TableCreated, TableID: table.ID.Hex(), Data: table})
+		})
 		if err != nil {
 			utils.HandleMongoError(c, err)
 			return
 		}
-
+		outbox.Notify()
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Table created successfuly",
-			"id":      result.InsertedID,
+			"id":      table.ID,
 		})
 	}
 }
@@ -205,10 +228,15 @@ func DeleteTable(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Delete user from database
-		result := collection.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: docID}})
-
 		var deletedTable Table
-		err = result.Decode(&deletedTable)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			err := collection.FindOneAndDelete(sc, bson.D{{Key: "_id", Value: docID}}).Decode(&deletedTable)
+			if err != nil {
+				return err
+			}
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.TableDeleted, TableID: deletedTable.ID.Hex(), Data: deletedTable})
+		})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
@@ -217,7 +245,363 @@ func DeleteTable(client db.IMongoClient) gin.HandlerFunc {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
 
 		c.JSON(http.StatusOK, nil)
 	}
 }
+
+// GetTableQR renders the ordering QR code of a table
+//
+// @Summary Get a table's ordering QR code
+// @Description Allows admin role to render the QR code that customers scan to order from a table, as PNG or SVG
+// @Tags table
+// @Produce image/png
+// @Produce image/svg+xml
+// @Param id path string true "Table ID"
+// @Param format query string false "Image format: 'png' (default) or 'svg'"
+// @Param size query int false "Image size in pixels (default is 256)"
+// @Security bearerToken
+// @Success 200 {file} File "QR code image"
+// @Failure 400  "Invalid request"
+// @Failure 404  "Table not found"
+// @Failure 409  "Table has no active token"
+// @Failure 500  "Internal Server Error"
+// @Router /table/{id}/qr [get]
+func GetTableQR(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", "png")
+		if format != "png" && format != "svg" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use png or svg."})
+			return
+		}
+
+		size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+		if err != nil || size < 64 || size > 2048 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size. Use a value between 64 and 2048."})
+			return
+		}
+
+		// Get collection from db
+		collection := client.GetCollection(config.Env.DatabaseName, "tables")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		var table Table
+		err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: docID}}).Decode(&table)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		token, err := IssueToken(table)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Table has no active token, rotate it first",
+			})
+			return
+		}
+
+		content := OrderURL(table, token)
+
+		if format == "svg" {
+			svg, err := generateQRSVG(content, size)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR code"})
+				return
+			}
+			c.Data(http.StatusOK, "image/svg+xml", svg)
+			return
+		}
+
+		png, err := generateQRPNG(content, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+	}
+}
+
+// RotateTableToken issues a new ordering token for a table
+//
+// @Summary Rotate a table's ordering token
+// @Description Allows admin role to issue a new ordering token for a table. Previously printed QR codes stop working.
+// @Tags table
+// @Produce json
+// @Param id path string true "Table ID"
+// @Security bearerToken
+// @Success 200 {object} TokenResponse "New token"
+// @Failure 400  "Invalid ID"
+// @Failure 404  "Table not found"
+// @Failure 500  "Internal Server Error"
+// @Router /table/{id}/token [post]
+func RotateTableToken(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		nonce, expiresAt, err := newTokenState()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate table token"})
+			return
+		}
+
+		// Get collection from db
+		collection := client.GetCollection(config.Env.DatabaseName, "tables")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "token_nonce", Value: nonce},
+				{Key: "token_expires_at", Value: expiresAt},
+			}},
+		}
+
+		var table Table
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			err := collection.FindOneAndUpdate(
+				sc,
+				bson.D{{Key: "_id", Value: docID}},
+				update,
+				options.FindOneAndUpdate().SetReturnDocument(options.After),
+			).Decode(&table)
+			if err != nil {
+				return err
+			}
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.TableUpdated, TableID: table.ID.Hex(), Data: table})
+		})
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		token, err := IssueToken(table)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate table token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": TokenResponse{
+				Token:     token,
+				URL:       OrderURL(table, token),
+				ExpiresAt: *table.TokenExpiresAt,
+			},
+		})
+	}
+}
+
+// RevokeTableToken revokes the ordering token of a table
+//
+// @Summary Revoke a table's ordering token
+// @Description Allows admin role to revoke a table's ordering token. Customers can't order from the table until it is rotated again.
+// @Tags table
+// @Param id path string true "Table ID"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Token revoked successfully"
+// @Failure 400  "Invalid ID"
+// @Failure 404  "Table not found"
+// @Failure 500  "Internal Server Error"
+// @Router /table/{id}/token [delete]
+func RevokeTableToken(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		// Get collection from db
+		collection := client.GetCollection(config.Env.DatabaseName, "tables")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		update := bson.D{
+			{Key: "$unset", Value: bson.D{
+				{Key: "token_nonce", Value: ""},
+				{Key: "token_expires_at", Value: ""},
+			}},
+		}
+
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			result, err := collection.UpdateOne(sc, bson.D{{Key: "_id", Value: docID}}, update)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return mongo.ErrNoDocuments
+			}
+
+			return outbox.Publish(sc, client, sse.Event{
+				Type:    sse.TableUpdated,
+				TableID: docID.Hex(),
+				Data:    gin.H{"id": docID, "tokenRevoked": true},
+			})
+		})
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		outbox.Notify()
+
+		c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+	}
+}
+
+// GetQRSheet renders a printable PDF with the QR codes of all tables
+//
+// @Summary Print QR codes for all tables
+// @Description Allows admin role to download a PDF sheet with the ordering QR code of every table. Tables without an active token are issued a new one.
+// @Tags table
+// @Produce application/pdf
+// @Security bearerToken
+// @Success 200 {file} File "PDF sheet"
+// @Failure 500  "Internal Server Error"
+// @Router /table/qr-sheet [get]
+func GetQRSheet(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tables []Table
+
+		// Get the collection from the database
+		collection := client.GetCollection(config.Env.DatabaseName, "tables")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		cursor, err := collection.Find(
+			ctx,
+			bson.M{},
+			options.Find().SetSort(bson.D{{Key: "name", Value: 1}}),
+		)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if err := cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to parse database response.",
+			})
+			return
+		}
+
+		urls := make(map[string]string, len(tables))
+		for i := range tables {
+			// Issue a token for tables that were revoked or have expired
+			if !tables[i].HasActiveToken() {
+				nonce, expiresAt, err := newTokenState()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate table token"})
+					return
+				}
+
+				update := bson.D{
+					{Key: "$set", Value: bson.D{
+						{Key: "token_nonce", Value: nonce},
+						{Key: "token_expires_at", Value: expiresAt},
+					}},
+				}
+				if _, err := collection.UpdateByID(ctx, tables[i].ID, update); err != nil {
+					utils.HandleMongoError(c, err)
+					return
+				}
+
+				tables[i].TokenNonce = nonce
+				tables[i].TokenExpiresAt = &expiresAt
+			}
+
+			token, err := IssueToken(tables[i])
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate table token"})
+				return
+			}
+			urls[tables[i].ID.Hex()] = OrderURL(tables[i], token)
+		}
+
+		pdf, err := generateQRSheet(tables, urls)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR sheet"})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="table-qr-codes.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	}
+}
+
+// GetTableEvents streams the events of a table to a customer's device
+//
+// @Summary Stream a table's events to customers
+// @Description Establishes an SSE connection carrying only the order, bill, payment, service and table events of the
+// @Description customer's own table, and menu changes. Requires the table token from the table's QR code.
+// @Tags SSE
+// @Produce text/event-stream
+// @Param id path string true "Table ID"
+// @Param token query string true "Table token from the table's QR code (or X-Table-Token header)"
+// @Success 200 {string} string "SSE stream opened"
+// @Failure 400  "Invalid ID"
+// @Failure 401  "Invalid or expired table token"
+// @Failure 500  "Internal Server Error"
+// @Router /events/table/{id} [get]
+func GetTableEvents(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tableID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		token := TokenFromRequest(c)
+		if _, err := VerifyToken(c.Request.Context(), client, tableID, token); err != nil {
+			if errors.Is(err, ErrInvalidToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid or expired table token, please scan the table's QR code again",
+				})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		sse.Stream(c, sse.CustomerFilter(tableID.Hex()), func(ctx context.Context) bool {
+			return tokenRevoked(ctx, client, tableID, token)
+		})
+	}
+}
@@ -7,7 +7,17 @@ import (
 )
 
 type Table struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"       json:"id"`
-	Name      string             `bson:"name" json:"name" validate:"required"`
-	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+	ID             primitive.ObjectID `bson:"_id,omitempty"              json:"id"`
+	Name           string             `bson:"name"                       json:"name"                     validate:"required"`
+	Zone           string             `bson:"zone,omitempty"             json:"zone,omitempty"` // area of the floor, e.g. terrace
+	CreatedAt      time.Time          `bson:"created_at"                 json:"createdAt"`
+	TokenNonce     string             `bson:"token_nonce,omitempty"      json:"-"` // changes on every rotation, empty when revoked
+	TokenExpiresAt *time.Time         `bson:"token_expires_at,omitempty" json:"tokenExpiresAt,omitempty"`
+}
+
+// TokenResponse is returned when a table's ordering token is rotated.
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
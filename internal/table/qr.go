@@ -0,0 +1,112 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// generateQRPNG encodes content as a square PNG QR code of the given pixel size.
+func generateQRPNG(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
+
+// generateQRSVG encodes content as an SVG QR code. Each dark module is drawn
+// as a unit square and the viewBox is scaled to the requested size.
+func generateQRSVG(content string, size int) ([]byte, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(
+		&buf,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules,
+	)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, modules, modules)
+	fmt.Fprintf(&buf, `<path d="%s" fill="#000000"/>`, path.String())
+	buf.WriteString("</svg>")
+
+	return buf.Bytes(), nil
+}
+
+// generateQRSheet lays out one QR code per table on A4 pages, three columns by
+// four rows, with the table name printed under each code.
+func generateQRSheet(tables []Table, urls map[string]string) ([]byte, error) {
+	const (
+		columns  = 3
+		rows     = 4
+		margin   = 15.0
+		cellW    = 60.0
+		cellH    = 67.0
+		codeSize = 50.0
+	)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Table QR codes", true)
+	pdf.SetFont("Helvetica", "B", 14)
+
+	for i, t := range tables {
+		if i%(columns*rows) == 0 {
+			pdf.AddPage()
+		}
+
+		png, err := generateQRPNG(urls[t.ID.Hex()], 512)
+		if err != nil {
+			return nil, err
+		}
+
+		imageName := "qr-" + t.ID.Hex()
+		pdf.RegisterImageOptionsReader(
+			imageName,
+			fpdf.ImageOptions{ImageType: "PNG"},
+			bytes.NewReader(png),
+		)
+
+		slot := i % (columns * rows)
+		x := margin + float64(slot%columns)*cellW
+		y := margin + float64(slot/columns)*cellH
+
+		pdf.ImageOptions(
+			imageName,
+			x+(cellW-codeSize)/2,
+			y,
+			codeSize,
+			codeSize,
+			false,
+			fpdf.ImageOptions{ImageType: "PNG"},
+			0,
+			"",
+		)
+		pdf.SetXY(x, y+codeSize+2)
+		pdf.CellFormat(cellW, 8, pdf.UnicodeTranslatorFromDescriptor("")(t.Name), "", 0, "C", false, 0, "")
+	}
+
+	if len(tables) == 0 {
+		pdf.AddPage()
+		pdf.CellFormat(0, 10, "No tables found", "", 0, "C", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
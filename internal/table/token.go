@@ -0,0 +1,149 @@
+package table
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid table token")
+	ErrNoToken      = errors.New("table has no active token")
+)
+
+// tokenAudience sets table tokens apart from staff tokens, which are signed
+// with the same secret.
+const tokenAudience = "table"
+
+type tokenClaims struct {
+	TableID string `json:"TableID"`
+	Nonce   string `json:"Nonce"`
+	jwt.RegisteredClaims
+}
+
+// newTokenState generates a fresh nonce and expiry for a table token.
+func newTokenState() (string, time.Time, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	return hex.EncodeToString(buf), time.Now().Add(config.Env.TableTokenTTL), nil
+}
+
+// HasActiveToken reports whether the table currently has an unexpired token.
+func (t Table) HasActiveToken() bool {
+	return t.TokenNonce != "" && t.TokenExpiresAt != nil && t.TokenExpiresAt.After(time.Now())
+}
+
+// IssueToken signs the ordering token for the table's current nonce.
+// The same nonce and expiry always produce the same token, so it never
+// needs to be stored.
+func IssueToken(t Table) (string, error) {
+	if !t.HasActiveToken() {
+		return "", ErrNoToken
+	}
+
+	claims := tokenClaims{
+		TableID: t.ID.Hex(),
+		Nonce:   t.TokenNonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			ExpiresAt: jwt.NewNumericDate(*t.TokenExpiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.Env.Secret))
+}
+
+// OrderURL builds the customer ordering link that is encoded into the QR code.
+func OrderURL(t Table, token string) string {
+	return fmt.Sprintf(
+		"%s/order/%s?token=%s",
+		config.Env.ClientURL,
+		t.ID.Hex(),
+		url.QueryEscape(token),
+	)
+}
+
+// VerifyToken checks that the token is a correctly signed, unexpired table
+// token, issued for the given table and still matches the table's current
+// nonce.
+func VerifyToken(
+	ctx context.Context,
+	client db.IMongoClient,
+	tableID primitive.ObjectID,
+	tokenString string,
+) (Table, error) {
+	if tokenString == "" {
+		return Table{}, ErrInvalidToken
+	}
+
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(config.Env.Secret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(tokenAudience),
+	)
+	if err != nil || !token.Valid || claims.TableID != tableID.Hex() {
+		return Table{}, ErrInvalidToken
+	}
+
+	collection := client.GetCollection(config.Env.DatabaseName, "tables")
+
+	var table Table
+	err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: tableID}}).Decode(&table)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Table{}, ErrInvalidToken
+		}
+		return Table{}, err
+	}
+
+	if !table.HasActiveToken() || table.TokenNonce != claims.Nonce {
+		return Table{}, ErrInvalidToken
+	}
+
+	return table, nil
+}
+
+// tokenRevoked reports whether a table token that was verified has been
+// rotated, revoked or has expired since, for long-lived requests such as
+// event streams. Database errors are logged and not taken for a revocation,
+// so streams outlive a short outage.
+func tokenRevoked(ctx context.Context, client db.IMongoClient, tableID primitive.ObjectID, tokenString string) bool {
+	_, err := VerifyToken(ctx, client, tableID, tokenString)
+	if err != nil && !errors.Is(err, ErrInvalidToken) {
+		log.Printf("Failed to check the token of table %s: %v", tableID.Hex(), err)
+		return false
+	}
+	return err != nil
+}
+
+// TokenFromRequest extracts a table token from the "token" query parameter
+// or the X-Table-Token header.
+func TokenFromRequest(c *gin.Context) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	return c.GetHeader("X-Table-Token")
+}
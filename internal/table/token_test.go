@@ -0,0 +1,250 @@
+package table
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// testTable is a table with an active token.
+func testTable() Table {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	return Table{ID: primitive.NewObjectID(), Name: "T1", TokenNonce: "nonce", TokenExpiresAt: &expiresAt}
+}
+
+func tableDocument(table Table) bson.D {
+	doc := bson.D{{Key: "_id", Value: table.ID}, {Key: "name", Value: table.Name}}
+	if table.TokenNonce != "" {
+		doc = append(doc,
+			bson.E{Key: "token_nonce", Value: table.TokenNonce},
+			bson.E{Key: "token_expires_at", Value: *table.TokenExpiresAt},
+		)
+	}
+	return doc
+}
+
+func found(table Table) bson.D {
+	return mtest.CreateCursorResponse(0, "db.tables", mtest.FirstBatch, tableDocument(table))
+}
+
+func TestVerifyToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	table := testTable()
+	token, err := IssueToken(table)
+	assert.NoError(t, err)
+
+	mt.Run("valid token", func(mt *mtest.T) {
+		mt.AddMockResponses(found(table))
+
+		verified, err := VerifyToken(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, table.ID, verified.ID)
+	})
+
+	mt.Run("other table", func(mt *mtest.T) {
+		_, err := VerifyToken(context.Background(), db.NewMockMongoClient(mt.Coll), primitive.NewObjectID(), token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	mt.Run("rotated token", func(mt *mtest.T) {
+		rotated := table
+		rotated.TokenNonce = "other"
+		mt.AddMockResponses(found(rotated))
+
+		_, err := VerifyToken(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	mt.Run("revoked token", func(mt *mtest.T) {
+		revoked := table
+		revoked.TokenNonce = ""
+		mt.AddMockResponses(found(revoked))
+
+		_, err := VerifyToken(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token)
+
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	mt.Run("token without the table audience", func(mt *mtest.T) {
+		staff, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"TableID": table.ID.Hex(),
+			"Nonce":   table.TokenNonce,
+			"Role":    "admin",
+			"exp":     table.TokenExpiresAt.Unix(),
+		}).SignedString([]byte(config.Env.Secret))
+		assert.NoError(t, err)
+
+		_, err = VerifyToken(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, staff)
+
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestTokenRevoked(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	table := testTable()
+	token, err := IssueToken(table)
+	assert.NoError(t, err)
+
+	mt.Run("still valid", func(mt *mtest.T) {
+		mt.AddMockResponses(found(table))
+
+		assert.False(t, tokenRevoked(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token))
+	})
+
+	mt.Run("rotated since", func(mt *mtest.T) {
+		rotated := table
+		rotated.TokenNonce = "other"
+		mt.AddMockResponses(found(rotated))
+
+		assert.True(t, tokenRevoked(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token))
+	})
+
+	mt.Run("database down", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "down"}))
+
+		assert.False(t, tokenRevoked(context.Background(), db.NewMockMongoClient(mt.Coll), table.ID, token))
+	})
+}
+
+func TestIssueToken(t *testing.T) {
+	table := testTable()
+
+	first, err := IssueToken(table)
+	assert.NoError(t, err)
+	second, err := IssueToken(table)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	table.TokenNonce = ""
+	_, err = IssueToken(table)
+	assert.Equal(t, ErrNoToken, err)
+}
+
+// serve handles one request for a table with the handler.
+func serve(method, path string, handler gin.HandlerFunc, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestGetTableQR(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	table := testTable()
+
+	mt.Run("png", func(mt *mtest.T) {
+		mt.AddMockResponses(found(table))
+
+		w := serve(http.MethodGet, "/table/:id/qr", GetTableQR(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/qr")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	})
+
+	mt.Run("svg", func(mt *mtest.T) {
+		mt.AddMockResponses(found(table))
+
+		w := serve(http.MethodGet, "/table/:id/qr", GetTableQR(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/qr?format=svg")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "<"))
+	})
+
+	mt.Run("revoked token", func(mt *mtest.T) {
+		revoked := table
+		revoked.TokenNonce = ""
+		mt.AddMockResponses(found(revoked))
+
+		w := serve(http.MethodGet, "/table/:id/qr", GetTableQR(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/qr")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	mt.Run("invalid size", func(mt *mtest.T) {
+		w := serve(http.MethodGet, "/table/:id/qr", GetTableQR(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/qr?size=10")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRotateTableToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	table := testTable()
+
+	mt.Run("issues a token for the new nonce", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tableDocument(table)}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := serve(http.MethodPost, "/table/:id/token", RotateTableToken(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/token")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		token, _ := IssueToken(table)
+		assert.Contains(t, w.Body.String(), token)
+
+		rotate := mt.GetStartedEvent().Command
+		nonce := rotate.Lookup("update", "$set", "token_nonce").StringValue()
+		assert.Len(t, nonce, 32)
+		// The event is added to the outbox in the same transaction
+		assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("unknown table", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		w := serve(http.MethodPost, "/table/:id/token", RotateTableToken(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/token")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRevokeTableToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	table := testTable()
+
+	mt.Run("unsets the nonce", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		w := serve(http.MethodDelete, "/table/:id/token", RevokeTableToken(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/token")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		revoke := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, unset := revoke.Lookup("u", "$unset", "token_nonce").StringValueOK()
+		assert.True(t, unset)
+	})
+
+	mt.Run("unknown table", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		w := serve(http.MethodDelete, "/table/:id/token", RevokeTableToken(db.NewMockMongoClient(mt.Coll)), "/table/"+table.ID.Hex()+"/token")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,323 @@
+package tax
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// CreateRate creates a tax rate
+//
+// @Summary Create a tax rate
+// @Description Allows admin role to create a tax rate with separate eat-in and takeaway rates in basis points (2000 = 20%),
+// @Description assigned to menu categories, menu items, or as the default rate.
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param rate body rateRequest true "Tax rate details"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Tax rate created successfully"
+// @Failure 400 "Invalid request"
+// @Failure 409 "A tax rate with this code already exists"
+// @Failure 500 "Internal Server Error"
+// @Router /tax/rate [post]
+func CreateRate(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rate, ok := bindRate(c)
+		if !ok {
+			return
+		}
+		rate.CreatedAt = time.Now()
+
+		collection := client.GetCollection(config.Env.DatabaseName, "tax_rates")
+
+		// Get context from the request
+		ctx := c.Request.Context()
+
+		if !clearDefault(c, client, rate) {
+			return
+		}
+
+		result, err := collection.InsertOne(ctx, rate)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "A tax rate with this code already exists"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Tax rate created successfully",
+			"id":      result.InsertedID,
+		})
+	}
+}
+
+// GetRates lists the tax rates
+//
+// @Summary Get tax rates
+// @Description Retrieves all tax rates
+// @Tags tax
+// @Produce json
+// @Security bearerToken
+// @Success 200 {array} Rate "List of tax rates"
+// @Failure 500 "Internal Server Error"
+// @Router /tax/rate [get]
+func GetRates(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rates, err := LoadRates(c.Request.Context(), client)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": rates,
+		})
+	}
+}
+
+// UpdateRate updates a tax rate
+//
+// @Summary Update a tax rate
+// @Description Allows admin role to replace a tax rate. Orders keep the tax breakdown they were priced with.
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param id path string true "Tax rate ID"
+// @Param rate body rateRequest true "Tax rate details"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Tax rate updated successfully"
+// @Failure 400 "Invalid request"
+// @Failure 404 "Tax rate not found"
+// @Failure 409 "A tax rate with this code already exists"
+// @Failure 500 "Internal Server Error"
+// @Router /tax/rate/{id} [put]
+func UpdateRate(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		rate, ok := bindRate(c)
+		if !ok {
+			return
+		}
+		rate.ID = id
+
+		collection := client.GetCollection(config.Env.DatabaseName, "tax_rates")
+
+		if !clearDefault(c, client, rate) {
+			return
+		}
+
+		result, err := collection.UpdateByID(c.Request.Context(), id, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "code", Value: rate.Code},
+			{Key: "name", Value: rate.Name},
+			{Key: "eat_in", Value: rate.EatIn},
+			{Key: "takeaway", Value: rate.Takeaway},
+			{Key: "categories", Value: rate.Categories},
+			{Key: "menu_item_ids", Value: rate.MenuItemIDs},
+			{Key: "default", Value: rate.Default},
+		}}})
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "A tax rate with this code already exists"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Tax rate updated successfully",
+		})
+	}
+}
+
+// DeleteRate deletes a tax rate
+//
+// @Summary Delete a tax rate
+// @Description Allows admin role to delete a tax rate. Items it covered fall back to the default rate.
+// @Tags tax
+// @Param id path string true "Tax rate ID"
+// @Security bearerToken
+// @Success 200 "Tax rate deleted successfully"
+// @Failure 400 "Invalid ID"
+// @Failure 404 "Tax rate not found"
+// @Failure 500 "Internal Server Error"
+// @Router /tax/rate/{id} [delete]
+func DeleteRate(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		result, err := client.GetCollection(config.Env.DatabaseName, "tax_rates").
+			DeleteOne(c.Request.Context(), bson.D{{Key: "_id", Value: id}})
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Tax rate deleted successfully",
+		})
+	}
+}
+
+// GetSummary reports tax by rate and period
+//
+// @Summary Get the tax summary
+// @Description Sums the tax of the orders closed in a date range by rate, overall and per day, week or month.
+// @Tags tax
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date, inclusive (YYYY-MM-DD)"
+// @Param group_by query string true "Grouping interval: one of 'day', 'week', or 'month'"
+// @Security bearerToken
+// @Success 200 {object} Summary "Tax summary"
+// @Failure 400 "Invalid request"
+// @Failure 500 "Failed to fetch tax summary"
+// @Router /tax/summary [get]
+func GetSummary(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupBy := c.Query("group_by")
+		if groupBy != "day" && groupBy != "week" && groupBy != "month" {
+			c.JSON(
+				http.StatusBadRequest,
+				gin.H{"error": "Invalid 'group_by' parameter. Allowed values are 'day', 'week', or 'month'."},
+			)
+			return
+		}
+
+		from, err := time.Parse("2006-01-02", c.Query("from"))
+		if err != nil {
+			c.JSON(
+				http.StatusBadRequest,
+				gin.H{"error": "Invalid 'from' date format use YYYY-MM-DD"},
+			)
+			return
+		}
+
+		to, err := time.Parse("2006-01-02", c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format YYYY-MM-DD"})
+			return
+		}
+
+		summary, err := getSummary(
+			c,
+			client.GetCollection(config.Env.DatabaseName, "orders"),
+			from,
+			to.AddDate(0, 0, 1),
+			groupBy,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tax summary"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": summary,
+		})
+	}
+}
+
+// bindRate reads and validates a tax rate from the request body, writing
+// the error response itself on failure.
+func bindRate(c *gin.Context) (Rate, bool) {
+	var request rateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+		})
+		return Rate{}, false
+	}
+
+	if err := validateRate(validate, request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return Rate{}, false
+	}
+
+	rate := Rate{
+		Code:        strings.ToLower(request.Code),
+		Name:        request.Name,
+		EatIn:       request.EatIn,
+		Takeaway:    request.Takeaway,
+		Categories:  []string{},
+		MenuItemIDs: []primitive.ObjectID{},
+		Default:     request.Default,
+	}
+
+	for _, category := range request.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			rate.Categories = append(rate.Categories, category)
+		}
+	}
+
+	for _, idHex := range request.MenuItemIDs {
+		id, err := primitive.ObjectIDFromHex(idHex)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Menu Item ID"})
+			return Rate{}, false
+		}
+		rate.MenuItemIDs = append(rate.MenuItemIDs, id)
+	}
+
+	return rate, true
+}
+
+// clearDefault unsets the previous default rate when the rate becomes the
+// default, so there is only ever one.
+func clearDefault(c *gin.Context, client db.IMongoClient, rate Rate) bool {
+	if !rate.Default {
+		return true
+	}
+
+	_, err := client.GetCollection(config.Env.DatabaseName, "tax_rates").UpdateMany(
+		c.Request.Context(),
+		bson.D{
+			{Key: "_id", Value: bson.M{"$ne": rate.ID}},
+			{Key: "default", Value: true},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "default", Value: false}}}},
+	)
+	if err != nil {
+		utils.HandleMongoError(c, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package tax
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ServiceEatIn    = "eat_in"
+	ServiceTakeaway = "takeaway"
+
+	// CategoryServiceCharge lets a rate list the service charge among its
+	// categories, otherwise it is taxed at the default rate.
+	CategoryServiceCharge = "service_charge"
+)
+
+// Rate is a tax rate assigned to menu items directly or through their
+// category. Items matching no rate are taxed at the default rate, if any.
+// Rates are in basis points, so 2000 is 20%.
+type Rate struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Code        string               `bson:"code"          json:"code"`
+	Name        string               `bson:"name"          json:"name"`
+	EatIn       int64                `bson:"eat_in"        json:"eatIn"`
+	Takeaway    int64                `bson:"takeaway"      json:"takeaway"`
+	Categories  []string             `bson:"categories"    json:"categories"`
+	MenuItemIDs []primitive.ObjectID `bson:"menu_item_ids" json:"menuItemIds"`
+	Default     bool                 `bson:"default"       json:"default"`
+	CreatedAt   time.Time            `bson:"created_at"    json:"createdAt"`
+}
+
+// TaxLine is the tax charged at one rate on an order. Net and Gross are the
+// taxed amount without and with the tax.
+type TaxLine struct {
+	Code  string `bson:"code"  json:"code"`
+	Name  string `bson:"name"  json:"name"`
+	Rate  int64  `bson:"rate"  json:"rate"` // basis points
+	Net   int64  `bson:"net"   json:"net"`
+	Tax   int64  `bson:"tax"   json:"tax"`
+	Gross int64  `bson:"gross" json:"gross"`
+}
+
+// Line is an amount to be taxed, after discounts.
+type Line struct {
+	MenuItemID primitive.ObjectID
+	Category   string
+	Amount     int64
+}
+
+type rateRequest struct {
+	Code        string   `json:"code"        validate:"required,min=1,max=20"`
+	Name        string   `json:"name"        validate:"required,min=1,max=60"`
+	EatIn       int64    `json:"eatIn"       validate:"gte=0,lte=10000"`
+	Takeaway    int64    `json:"takeaway"    validate:"gte=0,lte=10000"`
+	Categories  []string `json:"categories"`
+	MenuItemIDs []string `json:"menuItemIds"`
+	Default     bool     `json:"default"`
+}
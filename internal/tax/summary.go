@@ -0,0 +1,157 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RateSummary struct {
+	Code   string `bson:"code"   json:"code"`
+	Name   string `bson:"name"   json:"name"`
+	Rate   int64  `bson:"rate"   json:"rate"`   // basis points
+	Orders int    `bson:"orders" json:"orders"` // orders and service charges taxed at the rate
+	Net    int64  `bson:"net"    json:"net"`
+	Tax    int64  `bson:"tax"    json:"tax"`
+	Gross  int64  `bson:"gross"  json:"gross"`
+}
+
+type PeriodSummary struct {
+	GroupKey string        `bson:"_id"   json:"groupKey"` // day/week/month as a string
+	Tax      int64         `bson:"tax"   json:"tax"`
+	Rates    []RateSummary `bson:"rates" json:"rates"`
+}
+
+type Summary struct {
+	Tax     int64           `json:"tax"`
+	Rates   []RateSummary   `json:"rates"`
+	Periods []PeriodSummary `json:"periods"`
+}
+
+// getSummary sums the tax breakdowns of the orders and service charges of
+// sessions closed in the date range per rate, overall and per period.
+// Needs orders collection
+func getSummary(
+	ctx context.Context,
+	collection *mongo.Collection,
+	from time.Time,
+	to time.Time,
+	groupBy string, // "day", "week", or "month"
+) (Summary, error) {
+	var groupKeyExpr interface{}
+
+	switch groupBy {
+	case "day":
+		groupKeyExpr = bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$closed_at"}}
+	case "week":
+		groupKeyExpr = bson.M{
+			"$concat": []interface{}{
+				bson.M{"$toString": bson.M{"$isoWeekYear": "$closed_at"}},
+				"-W",
+				bson.M{"$toString": bson.M{"$isoWeek": "$closed_at"}},
+			},
+		}
+	case "month":
+		groupKeyExpr = bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$closed_at"}}
+	default:
+		return Summary{}, fmt.Errorf("unsupported groupBy value: %s", groupBy)
+	}
+
+	rateID := bson.M{"code": "$taxes.code", "rate": "$taxes.rate"}
+	rateTotals := bson.M{
+		"name":   bson.M{"$first": "$taxes.name"},
+		"orders": bson.M{"$sum": 1},
+		"net":    bson.M{"$sum": "$taxes.net"},
+		"tax":    bson.M{"$sum": "$taxes.tax"},
+		"gross":  bson.M{"$sum": "$taxes.gross"},
+	}
+	rateFields := bson.M{
+		"_id":    0,
+		"code":   "$_id.code",
+		"rate":   "$_id.rate",
+		"name":   1,
+		"orders": 1,
+		"net":    1,
+		"tax":    1,
+		"gross":  1,
+	}
+
+	overallGroup := bson.M{"_id": rateID}
+	groupedGroup := bson.M{"_id": bson.M{"period": "$period", "code": "$taxes.code", "rate": "$taxes.rate"}}
+	for field, expr := range rateTotals {
+		overallGroup[field] = expr
+		groupedGroup[field] = expr
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"closed_at": bson.M{"$gte": from, "$lt": to},
+			"taxes.0":   bson.M{"$exists": true},
+		}}},
+		{{Key: "$unionWith", Value: bson.M{
+			"coll": "sessions",
+			"pipeline": []bson.M{
+				{"$match": bson.M{
+					"closed_at":              bson.M{"$gte": from, "$lt": to},
+					"service_charge.taxes.0": bson.M{"$exists": true},
+				}},
+				{"$project": bson.M{"closed_at": 1, "taxes": "$service_charge.taxes"}},
+			},
+		}}},
+		{{Key: "$unwind", Value: "$taxes"}},
+		{{Key: "$addFields", Value: bson.M{"period": groupKeyExpr}}},
+		{{Key: "$facet", Value: bson.M{
+			"overall": []bson.M{
+				{"$group": overallGroup},
+				{"$project": rateFields},
+				{"$sort": bson.M{"rate": -1, "code": 1}},
+			},
+			"grouped": []bson.M{
+				{"$group": groupedGroup},
+				{"$sort": bson.M{"_id.rate": -1, "_id.code": 1}},
+				{"$group": bson.M{
+					"_id": "$_id.period",
+					"tax": bson.M{"$sum": "$tax"},
+					"rates": bson.M{"$push": bson.M{
+						"code":   "$_id.code",
+						"rate":   "$_id.rate",
+						"name":   "$name",
+						"orders": "$orders",
+						"net":    "$net",
+						"tax":    "$tax",
+						"gross":  "$gross",
+					}},
+				}},
+				{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Overall []RateSummary   `bson:"overall"`
+		Grouped []PeriodSummary `bson:"grouped"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{Rates: []RateSummary{}, Periods: []PeriodSummary{}}
+	if len(results) > 0 {
+		summary.Rates = results[0].Overall
+		summary.Periods = results[0].Grouped
+	}
+	for _, rate := range summary.Rates {
+		summary.Tax += rate.Tax
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,146 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+func validateRate(v *validator.Validate, request interface{}) error {
+	// Perform validation
+	if err := v.Struct(request); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			fmt.Println(err)
+			return nil
+		}
+
+		validationErrors := err.(validator.ValidationErrors)
+		for _, fieldErr := range validationErrors {
+			switch fieldErr.Tag() {
+			case "required":
+				return fmt.Errorf("%s is required", fieldErr.Field())
+			case "min":
+				return fmt.Errorf("%s must be at least %s characters", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				return fmt.Errorf("%s must be at most %s characters", fieldErr.Field(), fieldErr.Param())
+			case "gte":
+				return fmt.Errorf("%s must be at least %s", fieldErr.Field(), fieldErr.Param())
+			case "lte":
+				return fmt.Errorf("%s must be at most %s basis points", fieldErr.Field(), fieldErr.Param())
+			default:
+				return fmt.Errorf("%s is invalid", fieldErr.Field())
+			}
+		}
+	}
+	return nil
+}
+
+// LoadRates returns all configured tax rates.
+func LoadRates(ctx context.Context, client db.IMongoClient) ([]Rate, error) {
+	cursor, err := client.GetCollection(config.Env.DatabaseName, "tax_rates").Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rates := []Rate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// resolve returns the rate of a menu item: a rate it is assigned to, else a
+// rate its category is assigned to, else the default rate. It returns nil
+// when the item is not taxed.
+func resolve(rates []Rate, line Line) *Rate {
+	var byCategory, fallback *Rate
+	for i := range rates {
+		rate := &rates[i]
+		for _, id := range rate.MenuItemIDs {
+			if id == line.MenuItemID {
+				return rate
+			}
+		}
+		for _, category := range rate.Categories {
+			if category == line.Category && byCategory == nil {
+				byCategory = rate
+			}
+		}
+		if rate.Default && fallback == nil {
+			fallback = rate
+		}
+	}
+
+	if byCategory != nil {
+		return byCategory
+	}
+	return fallback
+}
+
+// Calculate works out the tax on the lines for the service type. With
+// inclusive pricing the tax is contained in the line amounts, otherwise it is
+// added on top. Tax is rounded once per rate. It returns the breakdown per
+// rate and the total tax.
+func Calculate(rates []Rate, lines []Line, service string, inclusive bool) ([]TaxLine, int64) {
+	type rateKey struct {
+		code string
+		rate int64
+	}
+
+	amounts := make(map[rateKey]int64)
+	names := make(map[rateKey]string)
+	for _, line := range lines {
+		rate := resolve(rates, line)
+		if rate == nil {
+			continue
+		}
+
+		key := rateKey{rate.Code, rate.EatIn}
+		if service == ServiceTakeaway {
+			key.rate = rate.Takeaway
+		}
+		amounts[key] += line.Amount
+		names[key] = rate.Name
+	}
+
+	breakdown := []TaxLine{}
+	var total int64
+	for key, amount := range amounts {
+		taxLine := TaxLine{Code: key.code, Name: names[key], Rate: key.rate}
+		if inclusive {
+			taxLine.Gross = amount
+			taxLine.Tax = divRound(amount*key.rate, 10000+key.rate)
+			taxLine.Net = amount - taxLine.Tax
+		} else {
+			taxLine.Net = amount
+			taxLine.Tax = divRound(amount*key.rate, 10000)
+			taxLine.Gross = amount + taxLine.Tax
+		}
+
+		total += taxLine.Tax
+		breakdown = append(breakdown, taxLine)
+	}
+
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Rate != breakdown[j].Rate {
+			return breakdown[i].Rate > breakdown[j].Rate
+		}
+		return breakdown[i].Code < breakdown[j].Code
+	})
+	return breakdown, total
+}
+
+// divRound divides rounding half away from zero.
+func divRound(a, b int64) int64 {
+	if (a < 0) != (b < 0) {
+		return (a - b/2) / b
+	}
+	return (a + b/2) / b
+}
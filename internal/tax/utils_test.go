@@ -0,0 +1,91 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	water = primitive.NewObjectID()
+	cake  = primitive.NewObjectID()
+
+	rates = []Rate{
+		{Code: "STD", Name: "Standard", EatIn: 2000, Takeaway: 2000, Default: true},
+		{Code: "RED", Name: "Reduced", EatIn: 1000, Takeaway: 500, Categories: []string{"food"}},
+		{Code: "ZERO", Name: "Zero", MenuItemIDs: []primitive.ObjectID{water}},
+	}
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		line Line
+		code string
+	}{
+		{"menu item", Line{MenuItemID: water, Category: "food"}, "ZERO"},
+		{"category", Line{MenuItemID: cake, Category: "food"}, "RED"},
+		{"default", Line{MenuItemID: cake, Category: "drinks"}, "STD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, resolve(rates, tt.line).Code)
+		})
+	}
+
+	t.Run("untaxed without a default", func(t *testing.T) {
+		assert.Nil(t, resolve(rates[1:], Line{Category: "drinks"}))
+	})
+}
+
+func TestCalculate(t *testing.T) {
+	lines := []Line{
+		{MenuItemID: cake, Category: "food", Amount: 333},
+		{MenuItemID: cake, Category: "food", Amount: 333},
+		{MenuItemID: primitive.NewObjectID(), Category: "drinks", Amount: 1005},
+	}
+
+	t.Run("inclusive", func(t *testing.T) {
+		breakdown, total := Calculate(rates, lines, ServiceEatIn, true)
+
+		assert.Equal(t, []TaxLine{
+			{Code: "STD", Name: "Standard", Rate: 2000, Net: 837, Tax: 168, Gross: 1005},
+			// Rounded once per rate, not per line
+			{Code: "RED", Name: "Reduced", Rate: 1000, Net: 605, Tax: 61, Gross: 666},
+		}, breakdown)
+		assert.Equal(t, int64(229), total)
+	})
+
+	t.Run("exclusive", func(t *testing.T) {
+		breakdown, total := Calculate(rates, lines, ServiceEatIn, false)
+
+		assert.Equal(t, []TaxLine{
+			{Code: "STD", Name: "Standard", Rate: 2000, Net: 1005, Tax: 201, Gross: 1206},
+			{Code: "RED", Name: "Reduced", Rate: 1000, Net: 666, Tax: 67, Gross: 733},
+		}, breakdown)
+		assert.Equal(t, int64(268), total)
+	})
+
+	t.Run("takeaway rate", func(t *testing.T) {
+		breakdown, _ := Calculate(rates, lines[:2], ServiceTakeaway, false)
+
+		assert.Equal(t, []TaxLine{{Code: "RED", Name: "Reduced", Rate: 500, Net: 666, Tax: 33, Gross: 699}}, breakdown)
+	})
+
+	t.Run("no rates", func(t *testing.T) {
+		breakdown, total := Calculate(nil, lines, ServiceEatIn, true)
+
+		assert.Empty(t, breakdown)
+		assert.Equal(t, int64(0), total)
+	})
+}
+
+func TestDivRound(t *testing.T) {
+	// Halves round away from zero
+	assert.Equal(t, int64(3), divRound(5, 2))
+	assert.Equal(t, int64(-3), divRound(-5, 2))
+	assert.Equal(t, int64(1), divRound(4, 3))
+	assert.Equal(t, int64(-1), divRound(-4, 3))
+}
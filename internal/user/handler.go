@@ -14,7 +14,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/outbox"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/payment"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/service"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
 	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
 )
 
@@ -92,7 +97,15 @@ func CreateUser(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Insert the item into the database
-		result, err := collection.InsertOne(ctx, user)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			result, err := collection.InsertOne(sc, user)
+			if err != nil {
+				return err
+			}
+			user.ID = result.InsertedID.(primitive.ObjectID)
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.UserCreated, Data: publicUser(user)})
+		})
 		if err != nil {
 			if mongo.IsDuplicateKeyError(err) {
 				c.JSON(
@@ -106,10 +119,11 @@ func CreateUser(client db.IMongoClient) gin.HandlerFunc {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "User created successfuly",
-			"id":      result.InsertedID,
+			"id":      user.ID,
 		})
 	}
 }
@@ -188,13 +202,14 @@ type LoginBody struct {
 	Password string `form:"password" json:"password"`
 }
 
-// Login authenticates a user and returns a JWT token
+// Login authenticates a user and returns an access and a refresh token
 //
 // @Summary User login
-// @Description Allows users to log in by providing username and password
+// @Description Allows users to log in by providing username and password. The short-lived access token is renewed
+// @Description with the refresh token at /user/refresh.
 // @Tags user
 // @Param loginBody body LoginBody true "Login details"
-// @Success 200 {object} map[string]interface{} "JWT token and expiration time"
+// @Success 200 {object} auth.Tokens "Access token, refresh token and their lifetimes in seconds"
 // @Failure 400  "Invalid request"
 // @Failure 401 "Unauthorized"
 // @Failure 500  "Internal Server Error"
@@ -236,14 +251,7 @@ func Login(client db.IMongoClient) gin.HandlerFunc {
 			return
 		}
 
-		claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"UserID":    user.ID,
-			"Role":      user.Role,
-			"ExpiresAt": time.Now().Add(time.Hour * 10).Unix(), // 10 hours
-		})
-
-		// Sign and get the complete encoded token as a string using the secret
-		token, err := claims.SignedString([]byte(config.Env.Secret))
+		tokens, err := auth.IssueTokens(ctx, client, user.ID, user.Role, c.ClientIP(), c.Request.UserAgent())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Could not login",
@@ -251,10 +259,141 @@ func Login(client db.IMongoClient) gin.HandlerFunc {
 			return
 
 		}
-		// Return the token in a JSON response
+		// Return the tokens in a JSON response
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+type refreshBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Refresh exchanges a refresh token for new tokens
+//
+// @Summary Refresh tokens
+// @Description Returns a new access token and a new refresh token. Every refresh token can be used once; using one
+// @Description again logs its device out.
+// @Tags user
+// @Param refreshBody body refreshBody true "Refresh token"
+// @Success 200 {object} auth.Tokens "Access token, refresh token and their lifetimes in seconds"
+// @Failure 400  "Invalid request"
+// @Failure 401 "Invalid, used, expired or revoked refresh token"
+// @Failure 500  "Internal Server Error"
+// @Router /user/refresh [post]
+func Refresh(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body refreshBody
+		if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		tokens, err := auth.Refresh(c.Request.Context(), client, body.RefreshToken)
+		if err != nil {
+			if err == auth.ErrInvalidToken || err == auth.ErrTokenRevoked {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid or expired refresh token, please log in again",
+				})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Logout ends the login of the current device
+//
+// @Summary Log out
+// @Description Revokes the refresh token of the current device and every access token issued with it.
+// @Tags user
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 401 "Unauthorized"
+// @Failure 500  "Internal Server Error"
+// @Router /user/logout [post]
+func Logout(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loginID, ok := auth.GetLoginID(c)
+		if !ok {
+			return
+		}
+
+		if err := auth.Revoke(c.Request.Context(), client, loginID); err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Logged out successfully",
+		})
+	}
+}
+
+// LogoutAll ends every login of the current user
+//
+// @Summary Log out all devices
+// @Description Revokes the refresh and access tokens of every device the current user is logged in on.
+// @Tags user
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Number of devices logged out"
+// @Failure 401 "Unauthorized"
+// @Failure 500  "Internal Server Error"
+// @Router /user/logout-all [post]
+func LogoutAll(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		revoked, err := auth.RevokeAll(c.Request.Context(), client, userID)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Logged out of all devices successfully",
+			"revoked": revoked,
+		})
+	}
+}
+
+// RevokeSessions logs a user out of every device
+//
+// @Summary Revoke a user's tokens
+// @Description Allows admin role to revoke every refresh and access token of a user, e.g. when a device is lost.
+// @Tags user
+// @Param id path string true "User ID"
+// @Security bearerToken
+// @Success 200 {object} map[string]interface{} "Number of devices logged out"
+// @Failure 400  "Invalid ID"
+// @Failure 500  "Internal Server Error"
+// @Router /user/{id}/sessions [delete]
+func RevokeSessions(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid ID!",
+			})
+			return
+		}
+
+		revoked, err := auth.RevokeAll(c.Request.Context(), client, docID)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"token":     token,
-			"expiresIn": 10 * 60 * 60, // 10 hours
+			"message": "User logged out of all devices successfully",
+			"revoked": revoked,
 		})
 	}
 }
@@ -296,10 +435,15 @@ func DeleteUser(client db.IMongoClient) gin.HandlerFunc {
 		ctx := c.Request.Context()
 
 		// Delete user from database
-		result := collection.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: docID}})
-
 		var deletedUser User
-		err = result.Decode(&deletedUser)
+		err = db.WithTransaction(ctx, client, func(sc mongo.SessionContext) error {
+			err := collection.FindOneAndDelete(sc, bson.D{{Key: "_id", Value: docID}}).Decode(&deletedUser)
+			if err != nil {
+				return err
+			}
+
+			return outbox.Publish(sc, client, sse.Event{Type: sse.UserDeleted, Data: publicUser(deletedUser)})
+		})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -308,6 +452,12 @@ func DeleteUser(client db.IMongoClient) gin.HandlerFunc {
 			utils.HandleMongoError(c, err)
 			return
 		}
+		outbox.Notify()
+
+		// The user's tokens are rejected already, this drops their logins too
+		if _, err := auth.RevokeAll(ctx, client, docID); err != nil {
+			log.Printf("Failed to revoke the logins of deleted user %s: %v", docID.Hex(), err)
+		}
 
 		c.JSON(http.StatusOK, nil)
 	}
@@ -450,6 +600,8 @@ func GetUserMe(client db.IMongoClient) gin.HandlerFunc {
 //
 // @Summary Get user statistics for a given date range
 // @Description Allows admins to retrieve all user statistics. Regular users can only retrieve their own statistics.
+// @Description Waiter statistics include the tips attributed to the waiter before and after pooling, and how quickly
+// @Description they acknowledged service requests.
 // @Tags user
 // @Accept json
 // @Produce json
@@ -554,12 +706,36 @@ func GetStatistics(client db.IMongoClient) gin.HandlerFunc {
 		var stats interface{}
 
 		if user.Role == "waiter" {
-			stats, err = getWaiterStats(from, to, c, collection, user.ID, groupBy)
+			waiterStats, err := getWaiterStats(from, to, c, collection, user.ID, groupBy)
 			if err != nil {
 				log.Printf(err.Error())
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 				return
 			}
+
+			waiterStats.TotalTips, err = utils.SumField(
+				c,
+				client.GetCollection(config.Env.DatabaseName, "payments"),
+				bson.D{
+					{Key: "tip_to", Value: user.ID},
+					{Key: "created_at", Value: bson.M{"$gte": from, "$lte": to}},
+				},
+				"tip",
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+				return
+			}
+			_, waiterStats.PooledTips = payment.PoolShares(waiterStats.TotalTips)
+			waiterStats.NetTips = waiterStats.TotalTips - waiterStats.PooledTips
+
+			waiterStats.ServiceRequests, err = service.GetResponseStats(c, client, user.ID, from, to)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+				return
+			}
+
+			stats = waiterStats
 		} else if user.Role == "cashier" {
 			stats, err = getCashierStats(from, to, c, collection, user.ID, groupBy)
 			if err != nil {
@@ -8,6 +8,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/service"
 )
 
 type AggregatedWaiterStats struct {
@@ -21,18 +23,24 @@ type AggregatedCashierStats struct {
 	GroupKey          string  `bson:"group_key"           json:"groupKey"` // day, week or year
 	TotalOrdersClosed int     `bson:"total_orders_closed" json:"totalOrdersClosed"`
 	TotalRevenue      float64 `bson:"total_revenue"       json:"totalRevenue"`
+	TotalRefunds      float64 `bson:"total_refunds"       json:"totalRefunds"` // negative, already included in revenue
 }
 
 type WaiterStats struct {
 	TotalOrdersServed  int                     `bson:"total_orders_served"  json:"totalOrdersServed"`
 	AverageServingTime float64                 `bson:"average_serving_time" json:"averageServingTime"` // minutes
 	FastestServingTime float64                 `bson:"fastest_serving_time" json:"fastestServingTime"` // minutes
+	TotalTips          int64                   `                            json:"totalTips"`
+	PooledTips         int64                   `                            json:"pooledTips"` // shared with the tip pools
+	NetTips            int64                   `                            json:"netTips"`
+	ServiceRequests    service.ResponseStats   `                            json:"serviceRequests"`
 	AggregatedStats    []AggregatedWaiterStats `                            json:"aggregatedStats"`
 }
 
 type CashierStats struct {
 	TotalOrdersClosed int                      `bson:"total_orders_closed" json:"totalOrdersClosed"`
 	TotalRevenue      float64                  `bson:"total_revenue"       json:"totalRevenue"`
+	TotalRefunds      float64                  `bson:"total_refunds"       json:"totalRefunds"` // negative, already included in revenue
 	AggregatedStats   []AggregatedCashierStats `                           json:"aggregatedStats"`
 }
 
@@ -203,27 +211,54 @@ func getCashierStats(
 		return CashierStats{}, fmt.Errorf("unsupported groupBy value: %s", groupBy)
 	}
 
+	// Refunds made by the cashier count as negative revenue
+	refundEntries := bson.M{
+		"coll": "refunds",
+		"pipeline": []bson.M{
+			{"$match": bson.M{
+				"created_at": bson.M{"$gte": startDate, "$lte": endDate},
+				"created_by": userID,
+			}},
+			{"$project": bson.M{
+				"created_at":  1,
+				"total_price": "$amount",
+				"refund":      bson.M{"$literal": true},
+			}},
+		},
+	}
+	isOrder := bson.M{"$cond": []interface{}{"$refund", 0, 1}}
+	refundValue := bson.M{"$cond": []interface{}{"$refund", "$total_price", 0}}
+
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: matchFilter}},
+		{{Key: "$project", Value: bson.M{
+			"created_at":  1,
+			"total_price": 1,
+			"refund":      bson.M{"$literal": false},
+		}}},
+		{{Key: "$unionWith", Value: refundEntries}},
 		{{Key: "$facet", Value: bson.M{
 			"overall": []bson.M{
 				{"$group": bson.M{
 					"_id":                 nil,
-					"total_orders_closed": bson.M{"$sum": 1},
+					"total_orders_closed": bson.M{"$sum": isOrder},
 					"total_revenue":       bson.M{"$sum": "$total_price"},
+					"total_refunds":       bson.M{"$sum": refundValue},
 				}},
 			},
 			"grouped": []bson.M{
 				{"$group": bson.M{
 					"_id":                 groupID,
-					"total_orders_closed": bson.M{"$sum": 1},
+					"total_orders_closed": bson.M{"$sum": isOrder},
 					"total_revenue":       bson.M{"$sum": "$total_price"},
+					"total_refunds":       bson.M{"$sum": refundValue},
 					"created_at":          bson.M{"$first": "$created_at"},
 				}},
 				{"$project": bson.M{
 					"group_key":           groupKeyExpr,
 					"total_orders_closed": 1,
 					"total_revenue":       1,
+					"total_refunds":       1,
 				}},
 				{"$sort": bson.M{"group_key": 1}},
 			},
@@ -240,6 +275,7 @@ func getCashierStats(
 		Overall []struct {
 			TotalOrdersClosed int     `bson:"total_orders_closed"`
 			TotalRevenue      float64 `bson:"total_revenue"`
+			TotalRefunds      float64 `bson:"total_refunds"`
 		} `bson:"overall"`
 		Grouped []AggregatedCashierStats `bson:"grouped"`
 	}
@@ -252,6 +288,7 @@ func getCashierStats(
 	if len(results[0].Overall) > 0 {
 		stats.TotalOrdersClosed = results[0].Overall[0].TotalOrdersClosed
 		stats.TotalRevenue = results[0].Overall[0].TotalRevenue
+		stats.TotalRefunds = results[0].Overall[0].TotalRefunds
 	}
 	stats.AggregatedStats = results[0].Grouped
 
@@ -143,3 +143,15 @@ func AuthSameUserOrAdmin(
 
 	return clientID == requestID
 }
+
+// publicUser returns the fields of a user that can be pushed to every staff
+// device, leaving out the password hash and contact details.
+func publicUser(user User) gin.H {
+	return gin.H{
+		"id":       user.ID,
+		"name":     user.Name,
+		"surname":  user.Surname,
+		"username": user.Username,
+		"role":     user.Role,
+	}
+}
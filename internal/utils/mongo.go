@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -37,3 +39,38 @@ func HandleMongoError(c *gin.Context, err error) {
 		}
 	}
 }
+
+// SumField sums a numeric field over the documents of a collection that
+// match the filter. It returns 0 when nothing matches.
+func SumField(
+	ctx context.Context,
+	collection *mongo.Collection,
+	filter interface{},
+	field string,
+) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"total": bson.M{"$sum": "$" + field},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Total, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validate checks a request struct against its validate tags and returns an
+// error for the first invalid field, worded for the client.
+func Validate(v *validator.Validate, request interface{}) error {
+	err := v.Struct(request)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		// Not a struct, a programming error rather than a bad request
+		log.Printf("Failed to validate %T: %v", request, err)
+		return nil
+	}
+
+	for _, fieldErr := range validationErrors {
+		return fieldError(fieldErr)
+	}
+	return nil
+}
+
+func fieldError(fieldErr validator.FieldError) error {
+	unit := ""
+	switch fieldErr.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Errorf("%s is required", fieldErr.Field())
+	case "url":
+		return fmt.Errorf("%s must be a URL", fieldErr.Field())
+	case "min":
+		return fmt.Errorf("%s must be at least %s%s", fieldErr.Field(), fieldErr.Param(), unit)
+	case "max":
+		return fmt.Errorf("%s must be at most %s%s", fieldErr.Field(), fieldErr.Param(), unit)
+	case "oneof":
+		return fmt.Errorf("%s must be one of: %s", fieldErr.Field(), fieldErr.Param())
+	default:
+		return fmt.Errorf("%s is invalid", fieldErr.Field())
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	type request struct {
+		URL     string   `validate:"required,url"`
+		Message string   `validate:"omitempty,min=2,max=5"`
+		Items   []string `validate:"max=1"`
+		Kind    string   `validate:"omitempty,oneof=a b"`
+		Count   int      `validate:"min=1"`
+	}
+	v := validator.New()
+	valid := request{URL: "https://example.com", Count: 1}
+
+	tests := []struct {
+		name   string
+		change func(*request)
+		want   string
+	}{
+		{"valid", func(r *request) {}, ""},
+		{"required", func(r *request) { r.URL = "" }, "URL is required"},
+		{"url", func(r *request) { r.URL = "example" }, "URL must be a URL"},
+		{"string min", func(r *request) { r.Message = "a" }, "Message must be at least 2 characters"},
+		{"string max", func(r *request) { r.Message = "abcdef" }, "Message must be at most 5 characters"},
+		{"slice max", func(r *request) { r.Items = []string{"a", "b"} }, "Items must be at most 1 items"},
+		{"oneof", func(r *request) { r.Kind = "c" }, "Kind must be one of: a b"},
+		{"number min", func(r *request) { r.Count = 0 }, "Count must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.change(&r)
+
+			err := Validate(v, r)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestValidateNotAStruct(t *testing.T) {
+	assert.NoError(t, Validate(validator.New(), "not a struct"))
+}
@@ -0,0 +1,357 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+const (
+	pollInterval = time.Second
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = time.Hour
+	keptAttempts = 10               // responses kept per delivery
+	claimMargin  = 30 * time.Second // added to the timeout for how long a delivery stays claimed
+)
+
+// Headers sent with every delivery
+const (
+	HeaderDelivery  = "X-Webhook-Delivery" // the same for every attempt, for receivers to drop duplicates
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Start queues deliveries of published events for the webhooks subscribed to
+// them and posts them in the background until the context is cancelled.
+// A delivery is claimed while it is sent, and one left sending by an
+// instance that stopped is retried once its claim runs out.
+func Start(ctx context.Context, client db.IMongoClient) {
+	go follow(ctx, client)
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for processNext(ctx, client) {
+				}
+			}
+		}
+	}()
+}
+
+// follow queues a delivery of every published event. Events published while
+// it falls behind are read from the event log.
+func follow(ctx context.Context, client db.IMongoClient) {
+	last := sse.LastID()
+	queue := func(event sse.Event) error {
+		enqueue(ctx, client, event)
+		last = max(last, event.ID)
+		return nil
+	}
+
+	for ctx.Err() == nil {
+		subscriber, ok := sse.Subscribe(sse.Filter{})
+		if !ok {
+			return
+		}
+
+		_, err := sse.Replay(ctx, last, sse.Filter{}, queue)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to queue webhook deliveries of missed events: %v", err)
+		}
+
+	receive:
+		for {
+			select {
+			case event := <-subscriber.Events():
+				queue(event)
+			case <-subscriber.Done():
+				break receive
+			case <-ctx.Done():
+				break receive
+			}
+		}
+		sse.Unsubscribe(subscriber)
+	}
+}
+
+// enqueue adds a delivery of the event for every active webhook subscribed
+// to it. Each event is delivered once per webhook, even when queued by
+// several instances or replayed.
+func enqueue(ctx context.Context, client db.IMongoClient, event sse.Event) {
+	cursor, err := client.GetCollection(config.Env.DatabaseName, "webhooks").Find(ctx, bson.D{
+		{Key: "active", Value: true},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "events", Value: bson.D{{Key: "$size", Value: 0}}}},
+			bson.D{{Key: "events", Value: bson.D{{Key: "$in", Value: bson.A{event.Type, event.Topic()}}}}},
+		}},
+	})
+	if err != nil {
+		log.Printf("Failed to find webhooks for %s event %d: %v", event.Type, event.ID, err)
+		return
+	}
+
+	var webhooks []Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		log.Printf("Failed to find webhooks for %s event %d: %v", event.Type, event.ID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	deliveries := make([]interface{}, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = Delivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       event.Payload(),
+			Status:        StatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+	}
+
+	_, err = client.GetCollection(config.Env.DatabaseName, "webhook_deliveries").
+		InsertMany(ctx, deliveries, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Failed to queue webhook deliveries of %s event %d: %v", event.Type, event.ID, err)
+	}
+}
+
+// processNext claims the oldest delivery that is due, or whose claim ran
+// out, and posts it. It reports whether a delivery was claimed.
+func processNext(ctx context.Context, client db.IMongoClient) bool {
+	collection := client.GetCollection(config.Env.DatabaseName, "webhook_deliveries")
+
+	now := time.Now()
+	var delivery Delivery
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "status", Value: StatusPending},
+				{Key: "next_attempt_at", Value: bson.M{"$lte": now}},
+			},
+			bson.D{
+				{Key: "status", Value: StatusSending},
+				{Key: "claimed_until", Value: bson.M{"$lt": now}},
+			},
+		}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusSending},
+			{Key: "claimed_until", Value: now.Add(config.Env.WebhookTimeout + claimMargin)},
+		}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Printf("Failed to claim webhook delivery: %v", err)
+		}
+		return false
+	}
+
+	var webhook Webhook
+	err = client.GetCollection(config.Env.DatabaseName, "webhooks").
+		FindOne(ctx, bson.D{{Key: "_id", Value: delivery.WebhookID}}).
+		Decode(&webhook)
+	if err != nil && err != mongo.ErrNoDocuments {
+		// Try again later
+		log.Printf("Failed to load webhook %s: %v", delivery.WebhookID.Hex(), err)
+		setDelivery(ctx, client, delivery, bson.D{
+			{Key: "status", Value: StatusPending},
+			{Key: "next_attempt_at", Value: time.Now().Add(baseBackoff)},
+		}, nil)
+		return true
+	}
+
+	// Deliveries of deleted or disabled webhooks fail without being sent
+	var attempt Attempt
+	final := true
+	if err == mongo.ErrNoDocuments || !webhook.Active {
+		attempt = Attempt{Error: "webhook is disabled", At: time.Now()}
+	} else {
+		attempt = send(ctx, webhook, delivery)
+		delivery.Attempts++
+		final = delivery.Attempts >= config.Env.WebhookRetries
+	}
+
+	switch {
+	case attempt.OK():
+		setDelivery(ctx, client, delivery, bson.D{
+			{Key: "status", Value: StatusDelivered},
+			{Key: "attempts", Value: delivery.Attempts},
+			{Key: "delivered_at", Value: attempt.At},
+		}, &attempt)
+		recordResult(ctx, client, webhook, true)
+	case final:
+		setDelivery(ctx, client, delivery, bson.D{
+			{Key: "status", Value: StatusFailed},
+			{Key: "attempts", Value: delivery.Attempts},
+		}, &attempt)
+		if webhook.Active {
+			recordResult(ctx, client, webhook, false)
+		}
+	default:
+		setDelivery(ctx, client, delivery, bson.D{
+			{Key: "status", Value: StatusPending},
+			{Key: "attempts", Value: delivery.Attempts},
+			{Key: "next_attempt_at", Value: time.Now().Add(backoff(delivery.Attempts))},
+		}, &attempt)
+	}
+	return true
+}
+
+// setDelivery updates a delivery claimed by processNext, releasing the
+// claim, and logs the attempt made, if any. A delivery whose claim ran out
+// and was taken over is left to the new claim.
+func setDelivery(ctx context.Context, client db.IMongoClient, delivery Delivery, set bson.D, attempt *Attempt) {
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$unset", Value: bson.D{{Key: "claimed_until", Value: ""}}},
+	}
+	if attempt != nil {
+		update = append(update, bson.E{Key: "$push", Value: bson.D{{Key: "responses", Value: bson.D{
+			{Key: "$each", Value: bson.A{attempt}},
+			{Key: "$slice", Value: -keptAttempts},
+		}}}})
+	}
+
+	result, err := client.GetCollection(config.Env.DatabaseName, "webhook_deliveries").UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: delivery.ID}, {Key: "claimed_until", Value: delivery.ClaimedUntil}},
+		update,
+	)
+	if err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", delivery.ID.Hex(), err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("Webhook delivery %s was claimed again before it was updated", delivery.ID.Hex())
+	}
+}
+
+// recordResult resets a webhook's failure count after a delivery, or counts
+// a delivery that failed every attempt and disables the webhook once too
+// many failed in a row.
+func recordResult(ctx context.Context, client db.IMongoClient, webhook Webhook, delivered bool) {
+	collection := client.GetCollection(config.Env.DatabaseName, "webhooks")
+
+	if delivered {
+		if webhook.Failures == 0 {
+			return
+		}
+		_, err := collection.UpdateByID(ctx, webhook.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "failures", Value: 0}}}})
+		if err != nil {
+			log.Printf("Failed to reset failures of webhook %s: %v", webhook.ID.Hex(), err)
+		}
+		return
+	}
+
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "_id", Value: webhook.ID}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "failures", Value: 1}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&webhook)
+	if err != nil {
+		log.Printf("Failed to count failures of webhook %s: %v", webhook.ID.Hex(), err)
+		return
+	}
+	if webhook.Failures < config.Env.WebhookMaxFailures || !webhook.Active {
+		return
+	}
+
+	_, err = collection.UpdateByID(ctx, webhook.ID, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "active", Value: false},
+		{Key: "disabled_at", Value: time.Now()},
+	}}})
+	if err != nil {
+		log.Printf("Failed to disable webhook %s: %v", webhook.ID.Hex(), err)
+		return
+	}
+	log.Printf("Disabled webhook %s after %d failed deliveries", webhook.ID.Hex(), webhook.Failures)
+}
+
+// send posts a delivery to its webhook, signed with the webhook's secret.
+func send(ctx context.Context, webhook Webhook, delivery Delivery) Attempt {
+	ctx, cancel := context.WithTimeout(ctx, config.Env.WebhookTimeout)
+	defer cancel()
+
+	start := time.Now()
+	attempt := Attempt{At: start}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cafe-orderAPI-webhooks")
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := http.DefaultClient.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	// Read a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	attempt.StatusCode = resp.StatusCode
+	if !attempt.OK() {
+		attempt.Error = fmt.Sprintf("receiver answered %s", resp.Status)
+	}
+	return attempt
+}
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the webhook's secret. Receivers
+// compute it the same way and should reject old timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after every failed attempt, up to an hour.
+func backoff(attempts int64) time.Duration {
+	wait := baseBackoff << min(max(attempts-1, 0), 7)
+	return min(wait, maxBackoff)
+}
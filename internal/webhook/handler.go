@@ -0,0 +1,403 @@
+package webhook
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+var validate = validator.New()
+
+// deliveryPageSize is the number of deliveries listed per webhook.
+const deliveryPageSize = 50
+
+// CreateWebhook adds a webhook
+//
+// @Summary Create a webhook
+// @Description Subscribes a URL to events, posted to it as the JSON sent over SSE. Events lists event types such as
+// @Description order.created or topics such as order, and is empty for all events. Deliveries are signed with the
+// @Description secret, which is generated when not given and only returned here.
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param webhook body webhookRequest true "Webhook"
+// @Security bearerToken
+// @Success 201 {object} map[string]interface{} "id and secret of the webhook"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook [post]
+func CreateWebhook(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request webhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if err := utils.Validate(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkURL(request.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkEvents(request.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, ok := auth.GetUserID(c)
+		if !ok {
+			return
+		}
+
+		secret := request.Secret
+		if secret == "" {
+			var err error
+			secret, err = newSecret()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate webhook secret"})
+				return
+			}
+		}
+
+		webhook := Webhook{
+			URL:       request.URL,
+			Events:    request.Events,
+			Secret:    secret,
+			Active:    true,
+			CreatedBy: userID,
+			CreatedAt: time.Now(),
+		}
+		if webhook.Events == nil {
+			webhook.Events = []string{}
+		}
+
+		result, err := client.GetCollection(config.Env.DatabaseName, "webhooks").
+			InsertOne(c.Request.Context(), webhook)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Webhook created successfully",
+			"id":      result.InsertedID,
+			"secret":  secret,
+		})
+	}
+}
+
+// GetWebhooks lists the webhooks
+//
+// @Summary Get all webhooks
+// @Description Lists the webhooks with whether they are active and their failed deliveries in a row.
+// @Tags webhook
+// @Produce json
+// @Security bearerToken
+// @Success 200 {array} Webhook "Webhooks"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook [get]
+func GetWebhooks(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		cursor, err := client.GetCollection(config.Env.DatabaseName, "webhooks").Find(
+			ctx,
+			bson.D{},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		webhooks := []Webhook{}
+		if err := cursor.All(ctx, &webhooks); err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": webhooks})
+	}
+}
+
+// UpdateWebhook changes a webhook
+//
+// @Summary Update a webhook
+// @Description Changes the URL, events or secret of a webhook, or disables or re-enables it. Re-enabling resets its
+// @Description failure count.
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param webhook body updateWebhookRequest true "Fields to change"
+// @Security bearerToken
+// @Success 200 {object} Webhook "Updated webhook"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook/{id} [patch]
+func UpdateWebhook(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID!"})
+			return
+		}
+
+		var request updateWebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if err := utils.Validate(validate, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := bson.D{}
+		unset := bson.D{}
+		if request.URL != nil {
+			if err := checkURL(*request.URL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			set = append(set, bson.E{Key: "url", Value: *request.URL})
+		}
+		if request.Events != nil {
+			if err := checkEvents(*request.Events); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			set = append(set, bson.E{Key: "events", Value: *request.Events})
+		}
+		if request.Secret != nil {
+			set = append(set, bson.E{Key: "secret", Value: *request.Secret})
+		}
+		if request.Active != nil {
+			set = append(set, bson.E{Key: "active", Value: *request.Active})
+			if *request.Active {
+				set = append(set, bson.E{Key: "failures", Value: 0})
+				unset = append(unset, bson.E{Key: "disabled_at", Value: ""})
+			} else {
+				set = append(set, bson.E{Key: "disabled_at", Value: time.Now()})
+			}
+		}
+		if len(set) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+
+		update := bson.D{{Key: "$set", Value: set}}
+		if len(unset) > 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+
+		var webhook Webhook
+		err = client.GetCollection(config.Env.DatabaseName, "webhooks").FindOneAndUpdate(
+			c.Request.Context(),
+			bson.D{{Key: "_id", Value: id}},
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&webhook)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": webhook})
+	}
+}
+
+// DeleteWebhook removes a webhook
+//
+// @Summary Delete a webhook
+// @Description Removes a webhook and its delivery log. Deliveries still queued are dropped.
+// @Tags webhook
+// @Param id path string true "Webhook ID"
+// @Security bearerToken
+// @Success 200 "Webhook deleted"
+// @Failure 400 {object} map[string]string "Invalid ID"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook/{id} [delete]
+func DeleteWebhook(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID!"})
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		result, err := client.GetCollection(config.Env.DatabaseName, "webhooks").
+			DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		_, err = client.GetCollection(config.Env.DatabaseName, "webhook_deliveries").
+			DeleteMany(ctx, bson.D{{Key: "webhook_id", Value: id}})
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+// GetDeliveries lists the latest deliveries of a webhook
+//
+// @Summary Get webhook deliveries
+// @Description Lists the latest deliveries of a webhook, newest first, with the response code or error of their
+// @Description latest attempts.
+// @Tags webhook
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "Only deliveries with this status: pending, sending, delivered or failed"
+// @Security bearerToken
+// @Success 200 {array} Delivery "Deliveries"
+// @Failure 400 {object} map[string]string "Invalid ID"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook/{id}/deliveries [get]
+func GetDeliveries(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID!"})
+			return
+		}
+
+		filter := bson.D{{Key: "webhook_id", Value: id}}
+		if status := c.Query("status"); status != "" {
+			filter = append(filter, bson.E{Key: "status", Value: status})
+		}
+
+		ctx := c.Request.Context()
+
+		cursor, err := client.GetCollection(config.Env.DatabaseName, "webhook_deliveries").Find(
+			ctx,
+			filter,
+			options.Find().
+				SetSort(bson.D{{Key: "created_at", Value: -1}}).
+				SetLimit(deliveryPageSize),
+		)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		deliveries := []Delivery{}
+		if err := cursor.All(ctx, &deliveries); err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": deliveries})
+	}
+}
+
+// RedeliverDelivery queues a delivery again
+//
+// @Summary Redeliver a webhook delivery
+// @Description Queues a delivered or failed delivery to be posted again right away, with a fresh set of attempts.
+// @Tags webhook
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Security bearerToken
+// @Success 200 {object} Delivery "Queued delivery"
+// @Failure 400 {object} map[string]string "Invalid ID"
+// @Failure 404 {object} map[string]string "Delivery not found"
+// @Failure 409 {object} map[string]string "Delivery is queued or its webhook is disabled"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhook/delivery/{id}/redeliver [post]
+func RedeliverDelivery(client db.IMongoClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID!"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		collection := client.GetCollection(config.Env.DatabaseName, "webhook_deliveries")
+
+		var delivery Delivery
+		err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&delivery)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		var webhook Webhook
+		err = client.GetCollection(config.Env.DatabaseName, "webhooks").
+			FindOne(ctx, bson.D{{Key: "_id", Value: delivery.WebhookID}}).
+			Decode(&webhook)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+		if !webhook.Active {
+			c.JSON(http.StatusConflict, gin.H{"error": "Webhook is disabled, enable it first"})
+			return
+		}
+
+		// Queued deliveries are left alone so they aren't posted twice at once
+		err = collection.FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: id},
+				{Key: "status", Value: bson.M{"$in": []string{StatusDelivered, StatusFailed}}},
+			},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: StatusPending},
+				{Key: "attempts", Value: 0},
+				{Key: "next_attempt_at", Value: time.Now()},
+			}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&delivery)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusConflict, gin.H{"error": "Delivery is already queued"})
+				return
+			}
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": delivery})
+	}
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSending   = "sending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Webhook is a URL events are posted to. Events lists event types such as
+// order.created or topics such as order, and is empty for all events.
+type Webhook struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"         json:"id"`
+	URL        string             `bson:"url"                   json:"url"`
+	Events     []string           `bson:"events"                json:"events"`
+	Secret     string             `bson:"secret"                json:"-"`
+	Active     bool               `bson:"active"                json:"active"`
+	Failures   int64              `bson:"failures"              json:"failures"` // failed deliveries in a row
+	DisabledAt *time.Time         `bson:"disabled_at,omitempty" json:"disabledAt,omitempty"`
+	CreatedBy  primitive.ObjectID `bson:"created_by"            json:"createdBy"`
+	CreatedAt  time.Time          `bson:"created_at"            json:"createdAt"`
+}
+
+// Delivery is an event to be posted to a webhook, with the responses to its
+// attempts so far.
+type Delivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"          json:"id"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id"             json:"webhookId"`
+	EventID       int64              `bson:"event_id"               json:"eventId"`
+	EventType     string             `bson:"event_type"             json:"eventType"`
+	Payload       []byte             `bson:"payload"                json:"-"`
+	Status        string             `bson:"status"                 json:"status"`
+	Attempts      int64              `bson:"attempts"               json:"attempts"`
+	Responses     []Attempt          `bson:"responses,omitempty"    json:"responses"` // latest attempts
+	NextAttemptAt time.Time          `bson:"next_attempt_at"        json:"nextAttemptAt"`
+	ClaimedUntil  *time.Time         `bson:"claimed_until,omitempty" json:"-"` // while being sent
+	CreatedAt     time.Time          `bson:"created_at"             json:"createdAt"`
+	DeliveredAt   *time.Time         `bson:"delivered_at,omitempty" json:"deliveredAt"`
+}
+
+// Attempt is the outcome of posting a delivery once.
+type Attempt struct {
+	StatusCode int       `bson:"status_code,omitempty" json:"statusCode,omitempty"`
+	Error      string    `bson:"error,omitempty"       json:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms"           json:"durationMs"`
+	At         time.Time `bson:"at"                    json:"at"`
+}
+
+// OK reports whether the receiver accepted the delivery.
+func (a Attempt) OK() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"    validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"dive,required"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=256"` // generated when empty
+}
+
+type updateWebhookRequest struct {
+	URL    *string   `json:"url"    validate:"omitempty,url,max=2048"`
+	Events *[]string `json:"events" validate:"omitempty,dive,required"`
+	Secret *string   `json:"secret" validate:"omitempty,min=16,max=256"`
+	Active *bool     `json:"active"` // re-enabling resets the failure count
+}
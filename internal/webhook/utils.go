@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+// checkURL makes sure events are posted over HTTP or HTTPS.
+func checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	return nil
+}
+
+// checkEvents makes sure every entry is a topic or an event type of one.
+func checkEvents(events []string) error {
+	for _, event := range events {
+		topic, _, _ := strings.Cut(event, ".")
+		if !slices.Contains(sse.Topics, topic) {
+			return fmt.Errorf("unknown event %s", event)
+		}
+	}
+	return nil
+}
+
+// newSecret generates a signing secret for webhooks created without one.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
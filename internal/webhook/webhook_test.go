@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// receiver is a webhook endpoint answering with the given status and handing
+// over every request it gets with its body.
+func receiver(t *testing.T, status int) (string, <-chan *http.Request, <-chan []byte) {
+	t.Helper()
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, requests, bodies
+}
+
+func testDelivery() Delivery {
+	return Delivery{
+		ID:        primitive.NewObjectID(),
+		EventID:   42,
+		EventType: "order.created",
+		Payload:   []byte(`{"id":42,"type":"order.created","data":{}}`),
+	}
+}
+
+func TestSend(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		url, requests, bodies := receiver(t, http.StatusNoContent)
+		webhook := Webhook{URL: url, Secret: "0123456789abcdef"}
+		delivery := testDelivery()
+
+		attempt := send(context.Background(), webhook, delivery)
+
+		assert.True(t, attempt.OK())
+		assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+		assert.Empty(t, attempt.Error)
+
+		r := <-requests
+		body := <-bodies
+		assert.Equal(t, delivery.Payload, body)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, delivery.ID.Hex(), r.Header.Get(HeaderDelivery))
+		assert.Equal(t, "order.created", r.Header.Get(HeaderEvent))
+
+		// The receiver can verify the signature with the shared secret
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), 5*time.Second)
+		expected := Sign(webhook.Secret, timestamp, body)
+		assert.True(t, hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderSignature))))
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		url, _, _ := receiver(t, http.StatusInternalServerError)
+
+		attempt := send(context.Background(), Webhook{URL: url}, testDelivery())
+
+		assert.False(t, attempt.OK())
+		assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+		assert.Equal(t, "receiver answered 500 Internal Server Error", attempt.Error)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		url := server.URL
+		server.Close()
+
+		attempt := send(context.Background(), Webhook{URL: url}, testDelivery())
+
+		assert.False(t, attempt.OK())
+		assert.Zero(t, attempt.StatusCode)
+		assert.NotEmpty(t, attempt.Error)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		timeout := config.Env.WebhookTimeout
+		config.Env.WebhookTimeout = 50 * time.Millisecond
+		t.Cleanup(func() { config.Env.WebhookTimeout = timeout })
+
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		t.Cleanup(server.Close)
+		t.Cleanup(func() { close(release) })
+
+		attempt := send(context.Background(), Webhook{URL: server.URL}, testDelivery())
+
+		assert.False(t, attempt.OK())
+		assert.Contains(t, attempt.Error, "deadline exceeded")
+	})
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+
+	signature := Sign("secret", 1700000000, body)
+
+	assert.Equal(t, signature, Sign("secret", 1700000000, body))
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.NotEqual(t, signature, Sign("other", 1700000000, body))
+	assert.NotEqual(t, signature, Sign("secret", 1700000001, body))
+	assert.NotEqual(t, signature, Sign("secret", 1700000000, []byte(`{"id":2}`)))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, time.Minute, backoff(2))
+	assert.Equal(t, 2*time.Minute, backoff(3))
+	assert.Equal(t, 32*time.Minute, backoff(7))
+	assert.Equal(t, time.Hour, backoff(8))
+	assert.Equal(t, time.Hour, backoff(20))
+}
+
+func TestProcessNext(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("nothing due", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		assert.False(t, processNext(context.Background(), db.NewMockMongoClient(mt.Coll)))
+
+		claim := mt.GetStartedEvent().Command
+		filter := claim.Lookup("query", "$or").Array()
+		assert.Equal(t, StatusPending, filter.Index(0).Value().Document().Lookup("status").StringValue())
+		assert.Equal(t, StatusSending, filter.Index(1).Value().Document().Lookup("status").StringValue())
+		_, claimed := claim.Lookup("update", "$set", "claimed_until").TimeOK()
+		assert.True(t, claimed)
+	})
+
+	mt.Run("updates the delivery while it is claimed", func(mt *mtest.T) {
+		claimedUntil := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+		delivery := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "webhook_id", Value: primitive.NewObjectID()},
+			{Key: "status", Value: StatusSending},
+			{Key: "claimed_until", Value: claimedUntil},
+		}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: delivery}),
+			// The webhook was deleted
+			mtest.CreateCursorResponse(0, "db.webhooks", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		assert.True(t, processNext(context.Background(), db.NewMockMongoClient(mt.Coll)))
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, claimedUntil, update.Lookup("q", "claimed_until").Time())
+		assert.Equal(t, StatusFailed, update.Lookup("u", "$set", "status").StringValue())
+		_, released := update.Lookup("u", "$unset", "claimed_until").StringValueOK()
+		assert.True(t, released)
+	})
+}
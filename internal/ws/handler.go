@@ -0,0 +1,468 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/auth"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/utils"
+)
+
+const (
+	writeTimeout   = 10 * time.Second
+	commandTimeout = 10 * time.Second
+	maxMessageSize = 4096
+	ackTimeout     = 5 * time.Second // unacknowledged events are sent again after
+	maxResends     = 3               // before the connection is closed
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin keeps other sites from connecting with the access_token cookie
+// the browser sends along. Tokens in the Authorization header or the URL are
+// never sent by the browser on its own, so connections without the cookie
+// may come from anywhere, as with CORS.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if _, err := r.Cookie("access_token"); err != nil {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || slices.Contains(config.Env.WebSocketOrigins, origin)
+}
+
+// pending is an event waiting to be acknowledged.
+type pending struct {
+	event   sse.Event
+	sentAt  time.Time
+	resends int
+}
+
+// session is an open WebSocket connection. Messages are read by the
+// handler's goroutine and written by a second one, the only one writing.
+type session struct {
+	client      db.IMongoClient
+	commands    map[string]Command
+	conn        *websocket.Conn
+	subscriber  *sse.Subscriber
+	mu          sync.Mutex // guards filter, changed by the reader while the writer replays
+	filter      sse.Filter
+	caller      Caller
+	revoked     func(context.Context) bool // whether the caller's login was revoked since connecting
+	requireAcks bool
+
+	replies chan ServerMessage
+	acks    chan int64
+	done    chan struct{} // closed when the writer stops
+}
+
+// Handler handles WebSocket connections of staff devices. They receive the
+// same events as SSE streams and can change their subscriptions, acknowledge
+// events and run commands over the connection.
+//
+// @Summary Open a WebSocket connection
+// @Description Upgrades to a WebSocket receiving the same events as /events, with the same token and filter
+// @Description parameters. Clients send JSON messages to subscribe to or unsubscribe from topics, tables, zones and
+// @Description stations, to acknowledge events and to run commands such as bumping order lines. See the README for
+// @Description the message protocol.
+// @Tags SSE
+// @Param access_token query string false "Staff token, when not sent in the Authorization header or a cookie"
+// @Param topic query string false "Topics to receive, e.g. order,table"
+// @Param table query string false "Table IDs to receive events of"
+// @Param zone query string false "Zones whose tables to receive events of"
+// @Param station query string false "Stations whose order events to receive, e.g. kitchen"
+// @Param ack query bool false "Whether events must be acknowledged, unacknowledged ones are sent again"
+// @Param lastEventId query int false "ID of the last event received, to receive the ones missed since"
+// @Security bearerToken
+// @Success 101 {string} string "Switching protocols"
+// @Failure 401 "Token missing or invalid"
+// @Router /ws [get]
+func Handler(client db.IMongoClient, commands map[string]Command) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := sse.ParseFilter(c.Request.Context(), client, c.Query)
+		if err != nil {
+			utils.HandleMongoError(c, err)
+			return
+		}
+
+		subscriber, ok := sse.Subscribe(filter)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+			return
+		}
+		defer sse.Unsubscribe(subscriber)
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has responded with the error
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The writer gets what it needs of the request before it starts
+		// rather than reading the gin.Context alongside the handler
+		claims, _ := c.Get("claims")
+		jwtClaims, _ := claims.(jwt.MapClaims)
+
+		s := &session{
+			client:      client,
+			commands:    commands,
+			conn:        conn,
+			subscriber:  subscriber,
+			filter:      filter,
+			caller:      callerOf(c),
+			revoked:     func(ctx context.Context) bool { return auth.ClaimsRevoked(ctx, jwtClaims) },
+			requireAcks: c.Query("ack") == "true",
+			replies:     make(chan ServerMessage, 16),
+			acks:        make(chan int64, 16),
+			done:        make(chan struct{}),
+		}
+
+		lastEventID, err := strconv.ParseInt(c.Query("lastEventId"), 10, 64)
+		resume := err == nil && lastEventID >= 0
+
+		go s.write(ctx, lastEventID, resume)
+		s.read(ctx)
+
+		// The writer stops before the handler returns and gin reuses the
+		// request's context
+		cancel()
+		<-s.done
+	}
+}
+
+// callerOf returns the staff member authenticated for the request.
+func callerOf(c *gin.Context) Caller {
+	caller := Caller{IP: c.ClientIP()}
+
+	claims, _ := c.Get("claims")
+	if jwtClaims, ok := claims.(jwt.MapClaims); ok {
+		userIDHex, _ := jwtClaims["UserID"].(string)
+		caller.UserID, _ = primitive.ObjectIDFromHex(userIDHex)
+		caller.Role, _ = jwtClaims["Role"].(string)
+	}
+	return caller
+}
+
+// read handles the client's messages until the connection is closed.
+func (s *session) read(ctx context.Context) {
+	// The client has to answer the writer's pings in time
+	pongWait := 2 * config.Env.EventHeartbeat
+	s.conn.SetReadLimit(maxMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket connection failed: %v", err)
+			}
+			return
+		}
+
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.reply(ServerMessage{Type: TypeError, Error: "Invalid message"})
+			continue
+		}
+
+		switch msg.Type {
+		case TypeSubscribe:
+			s.subscribe(ctx, msg)
+		case TypeUnsubscribe:
+			s.unsubscribe(msg)
+		case TypeAck:
+			select {
+			case s.acks <- msg.ID:
+			case <-s.done:
+			}
+		case TypeCommand:
+			s.command(ctx, msg)
+		default:
+			s.reply(ServerMessage{Type: TypeError, Ref: msg.Ref, Error: "Unknown message type"})
+		}
+	}
+}
+
+// reply queues a message for the writer.
+func (s *session) reply(msg ServerMessage) {
+	select {
+	case s.replies <- msg:
+	case <-s.done:
+	}
+}
+
+// subscribe adds topics, tables and stations to the connection's
+// subscriptions. Those it receives all of stay that way.
+func (s *session) subscribe(ctx context.Context, msg ClientMessage) {
+	for _, topic := range msg.Topics {
+		if !slices.Contains(sse.Topics, topic) {
+			s.reply(ServerMessage{Type: TypeError, Ref: msg.Ref, Error: "Unknown topic " + topic})
+			return
+		}
+	}
+
+	zoneTables, err := sse.ZoneTables(ctx, s.client, msg.Zones)
+	if err != nil {
+		log.Printf("Failed to load the tables of zones %v: %v", msg.Zones, err)
+		s.reply(ServerMessage{Type: TypeError, Ref: msg.Ref, Error: "Failed to load the tables of the zones"})
+		return
+	}
+
+	// The broker may be reading the current filter, so a new one is built
+	filter := s.currentFilter()
+	if filter.Topics != nil {
+		filter.Topics = union(filter.Topics, msg.Topics)
+	}
+	if filter.Tables != nil {
+		tables := make(map[string]bool, len(filter.Tables))
+		for _, table := range append(append(tableList(filter.Tables), msg.Tables...), zoneTables...) {
+			tables[table] = true
+		}
+		filter.Tables = tables
+	}
+	if filter.Stations != nil {
+		filter.Stations = union(filter.Stations, msg.Stations)
+	}
+
+	s.setFilter(msg.Ref, filter)
+}
+
+// unsubscribe removes topics, tables and stations from the connection's
+// subscriptions. Only topics can be removed while receiving all of them.
+func (s *session) unsubscribe(msg ClientMessage) {
+	filter := s.currentFilter()
+	if (len(msg.Tables) > 0 && filter.Tables == nil) || (len(msg.Stations) > 0 && filter.Stations == nil) {
+		s.reply(ServerMessage{
+			Type:  TypeError,
+			Ref:   msg.Ref,
+			Error: "Connection receives all tables or stations, reconnect with table or station filters",
+		})
+		return
+	}
+
+	topics := filter.Topics
+	if topics == nil {
+		topics = sse.Topics
+	}
+	filter.Topics = without(topics, msg.Topics)
+
+	if filter.Tables != nil {
+		tables := make(map[string]bool, len(filter.Tables))
+		for _, table := range without(tableList(filter.Tables), msg.Tables) {
+			tables[table] = true
+		}
+		filter.Tables = tables
+	}
+	if filter.Stations != nil {
+		filter.Stations = without(filter.Stations, msg.Stations)
+	}
+
+	s.setFilter(msg.Ref, filter)
+}
+
+func (s *session) currentFilter() sse.Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter
+}
+
+func (s *session) setFilter(ref string, filter sse.Filter) {
+	s.mu.Lock()
+	s.filter = filter
+	s.mu.Unlock()
+	sse.SetFilter(s.subscriber, filter)
+
+	subscriptions := &Subscriptions{Topics: filter.Topics, Stations: filter.Stations}
+	if filter.Tables != nil {
+		subscriptions.Tables = tableList(filter.Tables)
+	}
+	s.reply(ServerMessage{Type: TypeOK, Ref: ref, Subscriptions: subscriptions})
+}
+
+// command runs a command and sends its result back.
+func (s *session) command(ctx context.Context, msg ClientMessage) {
+	command, ok := s.commands[msg.Command]
+	if !ok {
+		s.reply(ServerMessage{Type: TypeError, Ref: msg.Ref, Error: "Unknown command"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	result, err := command(ctx, s.client, s.caller, msg.Data)
+	if err != nil {
+		var commandErr *Error
+		if !errors.As(err, &commandErr) {
+			log.Printf("Command %s failed: %v", msg.Command, err)
+			commandErr = &Error{Message: "Command failed"}
+		}
+		s.reply(ServerMessage{Type: TypeError, Ref: msg.Ref, Error: commandErr.Message})
+		return
+	}
+	s.reply(ServerMessage{Type: TypeResult, Ref: msg.Ref, Data: result})
+}
+
+// write sends the missed events when resuming, then events, replies and
+// pings until the connection or the subscription ends.
+func (s *session) write(ctx context.Context, lastEventID int64, resume bool) {
+	defer close(s.done)
+	// Closing the connection stops the reader as well
+	defer s.conn.Close()
+
+	unacked := make(map[int64]*pending)
+	send := func(event sse.Event) error {
+		if s.requireAcks {
+			unacked[event.ID] = &pending{event: event, sentAt: time.Now()}
+		}
+		return s.writeJSON(ServerMessage{Type: TypeEvent, ID: event.ID, Event: event.Payload()})
+	}
+
+	var replayed map[int64]bool
+	if resume {
+		var err error
+		replayed, err = sse.Replay(ctx, lastEventID, s.currentFilter(), send)
+		if err != nil {
+			if err != sse.ErrLogGap {
+				log.Printf("Failed to replay events: %v", err)
+			}
+			if s.writeJSON(ServerMessage{Type: TypeResync, ID: sse.LastID()}) != nil {
+				return
+			}
+		}
+	}
+
+	ping := time.NewTicker(config.Env.EventHeartbeat)
+	defer ping.Stop()
+	resend := time.NewTicker(ackTimeout)
+	defer resend.Stop()
+
+	for {
+		select {
+		case event := <-s.subscriber.Events():
+			// Events already replayed are not sent twice
+			if replayed[event.ID] {
+				delete(replayed, event.ID)
+				continue
+			}
+			if send(event) != nil {
+				return
+			}
+		case msg := <-s.replies:
+			if s.writeJSON(msg) != nil {
+				return
+			}
+		case id := <-s.acks:
+			delete(unacked, id)
+		case <-resend.C:
+			for _, p := range unacked {
+				if time.Since(p.sentAt) < ackTimeout {
+					continue
+				}
+				if p.resends == maxResends {
+					s.close(websocket.ClosePolicyViolation, "Events were not acknowledged")
+					return
+				}
+				p.resends++
+				p.sentAt = time.Now()
+				if s.writeJSON(ServerMessage{Type: TypeEvent, ID: p.event.ID, Event: p.event.Payload()}) != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			if s.revoked(ctx) {
+				s.close(websocket.ClosePolicyViolation, "Token has been revoked, please log in again")
+				return
+			}
+			if s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)) != nil {
+				return
+			}
+		case <-s.subscriber.Done():
+			// Fell behind or the server is shutting down, a client that
+			// reconnects with lastEventId catches up
+			s.close(websocket.CloseTryAgainLater, "Reconnect with lastEventId")
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *session) writeJSON(msg ServerMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *session) close(code int, reason string) {
+	s.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(writeTimeout),
+	)
+}
+
+func tableList(tables map[string]bool) []string {
+	list := make([]string, 0, len(tables))
+	for table := range tables {
+		list = append(list, table)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// union returns the values of a followed by those of b not in a.
+func union(a, b []string) []string {
+	result := slices.Clone(a)
+	for _, v := range b {
+		if !slices.Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// without returns the values of a not in b. The result is never nil.
+func without(a, b []string) []string {
+	result := []string{}
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
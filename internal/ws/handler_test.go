@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/config"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/sse"
+)
+
+// connect opens a connection to a server running the handler with an echo
+// and a failing command.
+func connect(t *testing.T, query string) *websocket.Conn {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", Handler(nil, map[string]Command{
+		"echo": func(ctx context.Context, client db.IMongoClient, caller Caller, data json.RawMessage) (any, error) {
+			return data, nil
+		},
+		"fail": func(ctx context.Context, client db.IMongoClient, caller Caller, data json.RawMessage) (any, error) {
+			return nil, Errorf("Order not found.")
+		},
+	}))
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn *websocket.Conn) ServerMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg ServerMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	return msg
+}
+
+func TestSubscriptions(t *testing.T) {
+	conn := connect(t, "topic=order")
+
+	conn.WriteJSON(ClientMessage{Type: TypeSubscribe, Ref: "1", Topics: []string{"menu"}})
+	reply := receive(t, conn)
+	assert.Equal(t, TypeOK, reply.Type)
+	assert.Equal(t, "1", reply.Ref)
+	assert.Equal(t, []string{"order", "menu"}, reply.Subscriptions.Topics)
+
+	conn.WriteJSON(ClientMessage{Type: TypeUnsubscribe, Ref: "2", Topics: []string{"order"}})
+	reply = receive(t, conn)
+	assert.Equal(t, []string{"menu"}, reply.Subscriptions.Topics)
+
+	sse.Publish(sse.OrderCreated, "", nil)
+	sse.Publish(sse.MenuChanged, "", nil)
+
+	event := receive(t, conn)
+	assert.Equal(t, TypeEvent, event.Type)
+	var payload sse.Event
+	assert.NoError(t, json.Unmarshal(event.Event, &payload))
+	assert.Equal(t, sse.MenuChanged, payload.Type)
+	assert.Equal(t, event.ID, payload.ID)
+
+	conn.WriteJSON(ClientMessage{Type: TypeSubscribe, Ref: "3", Topics: []string{"coffee"}})
+	reply = receive(t, conn)
+	assert.Equal(t, TypeError, reply.Type)
+	assert.Equal(t, "Unknown topic coffee", reply.Error)
+}
+
+func TestSubscribeWhileResuming(t *testing.T) {
+	conn := connect(t, "topic=order&lastEventId=0")
+
+	// The writer replays with the filter the reader is changing
+	conn.WriteJSON(ClientMessage{Type: TypeSubscribe, Ref: "1", Topics: []string{"menu"}})
+
+	assert.Equal(t, TypeResync, receive(t, conn).Type)
+	reply := receive(t, conn)
+	assert.Equal(t, TypeOK, reply.Type)
+	assert.Equal(t, []string{"order", "menu"}, reply.Subscriptions.Topics)
+}
+
+func TestCommands(t *testing.T) {
+	conn := connect(t, "topic=menu")
+
+	conn.WriteJSON(ClientMessage{Type: TypeCommand, Ref: "1", Command: "echo", Data: json.RawMessage(`{"a":1}`)})
+	reply := receive(t, conn)
+	assert.Equal(t, TypeResult, reply.Type)
+	assert.Equal(t, "1", reply.Ref)
+	assert.Equal(t, map[string]any{"a": float64(1)}, reply.Data)
+
+	conn.WriteJSON(ClientMessage{Type: TypeCommand, Ref: "2", Command: "fail"})
+	reply = receive(t, conn)
+	assert.Equal(t, TypeError, reply.Type)
+	assert.Equal(t, "Order not found.", reply.Error)
+
+	conn.WriteJSON(ClientMessage{Type: TypeCommand, Ref: "3", Command: "unknown"})
+	assert.Equal(t, "Unknown command", receive(t, conn).Error)
+
+	conn.WriteMessage(websocket.TextMessage, []byte("{"))
+	assert.Equal(t, "Invalid message", receive(t, conn).Error)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	config.Env.WebSocketOrigins = []string{"https://staff.example.com"}
+	t.Cleanup(func() { config.Env.WebSocketOrigins = nil })
+
+	request := func(origin string, cookie bool) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if cookie {
+			r.AddCookie(&http.Cookie{Name: "access_token", Value: "token"})
+		}
+		return r
+	}
+
+	assert.True(t, checkOrigin(request("", true)), "clients other than browsers send no origin")
+	assert.True(t, checkOrigin(request("https://evil.example.com", false)), "tokens in the URL can't be forged")
+	assert.True(t, checkOrigin(request("http://api.example.com", true)))
+	assert.True(t, checkOrigin(request("https://staff.example.com", true)))
+	assert.False(t, checkOrigin(request("https://evil.example.com", true)))
+}
@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kerimcanbalkan/cafe-orderAPI/internal/db"
+)
+
+// Message types sent by clients
+const (
+	TypeSubscribe   = "subscribe"   // receive more topics, tables, zones or stations
+	TypeUnsubscribe = "unsubscribe" // stop receiving topics, tables or stations
+	TypeAck         = "ack"         // an event was received
+	TypeCommand     = "command"     // run a command such as bumping an order line
+)
+
+// Message types sent by the server
+const (
+	TypeEvent  = "event"  // an event matching the connection's subscriptions
+	TypeResync = "resync" // missed events are gone, reload everything
+	TypeOK     = "ok"     // a subscribe or unsubscribe message was applied
+	TypeResult = "result" // the result of a command
+	TypeError  = "error"  // a message could not be handled
+)
+
+// ClientMessage is a message sent by a client. Ref is an ID of the client's
+// choosing, sent back in the reply to the message.
+type ClientMessage struct {
+	Type     string          `json:"type"`
+	Ref      string          `json:"ref,omitempty"`
+	Topics   []string        `json:"topics,omitempty"`   // subscribe and unsubscribe
+	Tables   []string        `json:"tables,omitempty"`   // subscribe and unsubscribe
+	Zones    []string        `json:"zones,omitempty"`    // subscribe
+	Stations []string        `json:"stations,omitempty"` // subscribe and unsubscribe
+	ID       int64           `json:"id,omitempty"`       // ack: the event received
+	Command  string          `json:"command,omitempty"`  // command: its name
+	Data     json.RawMessage `json:"data,omitempty"`     // command: its arguments
+}
+
+// ServerMessage is a message sent to a client.
+type ServerMessage struct {
+	Type          string          `json:"type"`
+	Ref           string          `json:"ref,omitempty"`
+	ID            int64           `json:"id,omitempty"`            // event and resync: the event ID
+	Event         json.RawMessage `json:"event,omitempty"`         // event: as sent over SSE
+	Subscriptions *Subscriptions  `json:"subscriptions,omitempty"` // ok: the connection's subscriptions
+	Data          any             `json:"data,omitempty"`          // result: the command's result
+	Error         string          `json:"error,omitempty"`
+}
+
+// Subscriptions are what a connection receives. Nil lists mean all topics,
+// tables or stations.
+type Subscriptions struct {
+	Topics   []string `json:"topics"`
+	Tables   []string `json:"tables"`
+	Stations []string `json:"stations"`
+}
+
+// Caller is the staff member a command was sent by.
+type Caller struct {
+	UserID primitive.ObjectID
+	Role   string
+	IP     string
+}
+
+// Command handles a command sent over a connection. The result is sent back
+// to the client.
+type Command func(ctx context.Context, client db.IMongoClient, caller Caller, data json.RawMessage) (any, error)
+
+// Error is a command error whose message is sent to the client. Other errors
+// are logged and reported as a failed command.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an Error with a formatted message.
+func Errorf(format string, args ...any) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}